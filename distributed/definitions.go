@@ -1,6 +1,13 @@
 package distributed
 
-import "github.com/dbogatov/dac-lib/dac"
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-amcl/amcl"
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
 
 // KeysHolder ...
 type KeysHolder struct {
@@ -8,6 +15,27 @@ type KeysHolder struct {
 	sk dac.SK
 }
 
+// randomness is the stream an actor derives from the master seed; its RPC handlers run concurrently,
+// so each of them forks a stream of its own
+type randomness struct {
+	prg   *amcl.RAND
+	mutex *sync.Mutex
+}
+
+func makeRandomness(prg *amcl.RAND) randomness {
+	return randomness{
+		prg:   prg,
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (random randomness) fork() *amcl.RAND {
+	random.mutex.Lock()
+	defer random.mutex.Unlock()
+
+	return helpers.NewRandSeed(helpers.RandomBytes(random.prg, 32))
+}
+
 // CredentialsHolder ...
 type CredentialsHolder struct {
 	KeysHolder
@@ -27,6 +55,42 @@ type Credentials struct {
 	Creds []byte
 }
 
+// CertificateRequest ...
+type CertificateRequest struct {
+	PK   []byte
+	Peer int // position in the peer addresses
+}
+
+// Certificate is the X.509-like identity an organization issues to its peer
+type Certificate struct {
+	Org       int
+	Peer      int
+	Role      string
+	PK        []byte
+	Signature []byte // dac.SchnorrSignature by the organization
+}
+
+func (certificate *Certificate) getMessage() (message []byte) {
+
+	message = make([]byte, 16)
+	binary.BigEndian.PutUint64(message[:8], uint64(certificate.Org))
+	binary.BigEndian.PutUint64(message[8:], uint64(certificate.Peer))
+	message = append(message, []byte(certificate.Role)...)
+	message = append(message, certificate.PK...)
+
+	return
+}
+
+func (certificate *Certificate) wire() helpers.WireCertificate {
+	return helpers.WireCertificate{
+		Org:       certificate.Org,
+		Peer:      certificate.Peer,
+		Role:      certificate.Role,
+		PK:        certificate.PK,
+		Signature: certificate.Signature,
+	}
+}
+
 // NonRevocationRequest ...
 type NonRevocationRequest struct {
 	PK []byte
@@ -40,12 +104,15 @@ type NonRevocationHandle struct {
 // TransactionProposal ...
 type TransactionProposal struct {
 	Hash       []byte
-	AuthorID   int // for checking auditing correctness
+	AuthorID   int    // for checking auditing correctness
+	Class      string // of the author, disclosed so that peers know whether to expect a non-revocation proof
 	Chaincode  string
 	Signature  []byte // dac.NymSignature
 	Author     []byte // marshalled dac.Proof
 	PkNym      []byte
 	IndexValue []byte
+	Keys       []string // as many as the chaincode touches
+	Payload    []byte   // chaincode argument of a trace record; the hash if nil
 }
 
 // Transaction ...
@@ -55,7 +122,60 @@ type Transaction struct {
 	AuditProof         []byte // dac.AuditingProof
 	AuditEnc           []byte // dac.AuditingEncryption
 	Endorsements       []Endorsement
+	RWSet              helpers.ReadWriteSet
 	NonRevocationProof []byte // dac.RevocationProof
 	Epoch              int
 	AuthorPK           []byte
+	Sequence           int // position in the ledger, assigned at ordering
+}
+
+func (tp *TransactionProposal) wire() helpers.WireProposal {
+	return helpers.WireProposal{
+		Hash:       tp.Hash,
+		Class:      tp.Class,
+		Chaincode:  tp.Chaincode,
+		Signature:  tp.Signature,
+		Author:     tp.Author,
+		PkNym:      tp.PkNym,
+		IndexValue: tp.IndexValue,
+		Keys:       tp.Keys,
+		Payload:    tp.Payload,
+	}
+}
+
+func (transaction *Transaction) wire() (message helpers.WireTransaction) {
+
+	message = helpers.WireTransaction{
+		Signature:          transaction.Signature,
+		Proposal:           transaction.Proposal.wire(),
+		AuditProof:         transaction.AuditProof,
+		AuditEnc:           transaction.AuditEnc,
+		RWSet:              transaction.RWSet,
+		NonRevocationProof: transaction.NonRevocationProof,
+		Epoch:              transaction.Epoch,
+	}
+
+	// endorsements carry the same read/write set, which is only included once
+	for _, endorsement := range transaction.Endorsements {
+		message.Endorsements = append(message.Endorsements, helpers.WireEndorsement{
+			Signature:   endorsement.Signature,
+			Certificate: endorsement.Certificate.wire(),
+		})
+	}
+
+	return
+}
+
+// size is that of the canonical encoding, the one the simulator takes
+func (transaction *Transaction) size() int {
+	return helpers.EncodedSize(transaction.wire())
+}
+
+// LedgerHead ...
+type LedgerHead struct {
+	Height    int
+	Hash      []byte
+	Bytes     int
+	StateHash []byte
+	Invalid   int
 }
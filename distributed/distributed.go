@@ -1,6 +1,7 @@
 package distributed
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"net"
@@ -26,34 +27,32 @@ func Simulate(rootSk, auditSk dac.SK, params *helpers.SystemParameters, root boo
 
 	sysParams = *params
 
-	prg := helpers.NewRand()
-
 	if root {
 		logger.Noticef("Running as ROOT")
 
-		rpcRoot := MakeRPCRoot(prg, rootSk)
+		rpcRoot := MakeRPCRoot(helpers.NewRandDerived(sysParams.Seed, "root"), rootSk)
 
 		runRPCServer(rpcRoot)
 	} else if organization > 0 {
 		logger.Noticef("Running as ORGANIZATION %d", organization)
 
-		rpcOrg := MakeRPCOrganization(prg, organization)
+		rpcOrg := MakeRPCOrganization(helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("org-%d", organization)), organization)
 
 		runRPCServer(rpcOrg)
 	} else if peer > 0 {
 		logger.Noticef("Running as PEER %d", peer)
 
-		rpcPeer := MakeRPCPeer(prg, peer, auditSk)
+		rpcPeer := MakeRPCPeer(helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("peer-%d", peer)), peer, auditSk)
 
 		runRPCServer(rpcPeer)
 	} else if user > 0 {
 		logger.Noticef("Running as USER %d", organization)
 
-		MakeUser(prg, user)
+		MakeUser(helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("user-%d", user)), user)
 	} else if revocation {
 		logger.Notice("Running as REVOCATION")
 
-		rpcRevocation := MakeRPCRevocation(prg)
+		rpcRevocation := MakeRPCRevocation(helpers.NewRandDerived(sysParams.Seed, "revocation-authority"))
 
 		runRPCServer(rpcRevocation)
 	} else if auditor {
@@ -62,20 +61,34 @@ func Simulate(rootSk, auditSk dac.SK, params *helpers.SystemParameters, root boo
 		auditCallClients := make([]rpcCallClient, 0)
 		for _, peer := range sysParams.PeerRPCAddresses {
 
-			callClient := makeRPCCall(peer, "RPCPeer.Audit", new(int), new(bool))
+			callClient := makeRPCCall(peer, "RPCPeer.Audit", new(int), new(LedgerHead))
 			auditCallClients = append(auditCallClients, callClient)
 		}
 
+		heads := make([]*LedgerHead, 0)
 		for _, auditCallClient := range auditCallClients {
 
 			<-auditCallClient.call.Done
 			if auditCallClient.call.Error != nil {
 				logger.Fatal(auditCallClient.call.Error)
 			}
+			heads = append(heads, auditCallClient.call.Reply.(*LedgerHead))
 			auditCallClient.client.Close()
 		}
 
-		logger.Notice("Audit completed on all peers; ledgers cleared")
+		logger.Notice("Audit completed on all peers")
+
+		// the heads are hashes of the whole chains
+		for peer, head := range heads[1:] {
+			if head.Height != heads[0].Height || !bytes.Equal(head.Hash, heads[0].Hash) {
+				logger.Fatalf("Ledgers of %s (%d blocks) and %s (%d blocks) differ", sysParams.PeerRPCAddresses[0], heads[0].Height, sysParams.PeerRPCAddresses[peer+1], head.Height)
+			}
+			if !bytes.Equal(head.StateHash, heads[0].StateHash) {
+				logger.Fatalf("World states of %s and %s differ", sysParams.PeerRPCAddresses[0], sysParams.PeerRPCAddresses[peer+1])
+			}
+		}
+
+		logger.Noticef("All peers have the same ledger of %d blocks (%d bytes, %d invalid transactions)", heads[0].Height, heads[0].Bytes, heads[0].Invalid)
 	}
 
 	return
@@ -11,6 +11,7 @@ import (
 // RPCOrganization ...
 type RPCOrganization struct {
 	CredentialsHolder
+	random randomness
 }
 
 const orgLevel = 1
@@ -44,6 +45,7 @@ func MakeRPCOrganization(prg *amcl.RAND, id int) (rpcOrg *RPCOrganization) {
 			kind:        fmt.Sprintf("org-%d", id),
 			id:          id,
 		},
+		makeRandomness(prg),
 	}
 
 	logger.Info("Received credentials")
@@ -53,7 +55,7 @@ func MakeRPCOrganization(prg *amcl.RAND, id int) (rpcOrg *RPCOrganization) {
 
 // GetNonce ...
 func (rpcOrg *RPCOrganization) GetNonce(args *int, reply *[]byte) (e error) {
-	prg := helpers.NewRand()
+	prg := rpcOrg.random.fork()
 
 	*reply = helpers.RandomBytes(prg, helpers.NonceSize)
 
@@ -62,11 +64,41 @@ func (rpcOrg *RPCOrganization) GetNonce(args *int, reply *[]byte) (e error) {
 	return
 }
 
+// GetPK returns the key peers and users trust certificates of this organization with
+func (rpcOrg *RPCOrganization) GetPK(args *int, reply *[]byte) (e error) {
+
+	*reply = dac.PointToBytes(rpcOrg.pk)
+
+	logger.Debug("PK requested")
+
+	return
+}
+
+// ProcessCertificateRequest ...
+func (rpcOrg *RPCOrganization) ProcessCertificateRequest(args *CertificateRequest, reply *Certificate) (e error) {
+
+	// organization IDs start at 1, policies number organizations from 0
+	*reply = Certificate{
+		Org:  rpcOrg.id - 1,
+		Peer: args.Peer,
+		Role: helpers.PeerRole,
+		PK:   args.PK,
+	}
+
+	// organization keys live in the other group
+	signature := dac.MakeSchnorr(rpcOrg.random.fork(), true).Sign(rpcOrg.sk, reply.getMessage())
+	reply.Signature = signature.ToBytes()
+
+	logger.Debugf("Certificate issued to peer-%d", args.Peer)
+
+	return
+}
+
 // ProcessCredRequest ...
 func (rpcOrg *RPCOrganization) ProcessCredRequest(args *CredRequest, reply *Credentials) (e error) {
 
 	credRequest := dac.CredRequestFromBytes(args.Request)
-	prg := helpers.NewRand()
+	prg := rpcOrg.random.fork()
 
 	if e := credRequest.Validate(); e != nil {
 		logger.Fatal("credRequest.Validate():", e)
@@ -9,6 +9,7 @@ import (
 	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
 	"github.com/dbogatov/fabric-simulator/helpers"
+	"golang.org/x/exp/rand"
 )
 
 // RPCPeer ...
@@ -19,16 +20,40 @@ type RPCPeer struct {
 
 	cache [][32]byte
 
+	certificate      Certificate // issued by the organization at the org address
+	orgPK            dac.PK      // the only organization of a distributed run
+	certificates     [][32]byte  // verified already
+	certificateMutex *sync.Mutex
+
 	revocationPK dac.PK
 	auditSK      dac.SK
 
-	transactions  []*Transaction
-	txRecordMutex *sync.Mutex
+	// every block holds a single transaction
+	ledger      helpers.Ledger
+	blocks      []*Transaction
+	pending     map[int]*Transaction // validated, waiting for the preceding ones
+	audited     int                  // height up to which the ledger has been audited
+	state       *helpers.WorldState
+	invalid     int         // transactions that failed the MVCC check or whose endorsers disagree
+	ledgerMutex *sync.Mutex // also guards the state and the chaincode source
+
+	chaincodes      *helpers.ChaincodeMix
+	chaincodeSource rand.Source // execution times
+
+	random randomness
+
+	sequence      int // next ledger position, used by the first peer only
+	sequenceMutex *sync.Mutex
 }
 
 // MakeRPCPeer ...
 func MakeRPCPeer(prg *amcl.RAND, id int, auditSk dac.SK) (rpcPeer *RPCPeer) {
-	sk, pk := dac.GenerateKeys(helpers.NewRand(), 0)
+	sk, pk := dac.GenerateKeys(prg, 0)
+
+	chaincodes, e := helpers.MakeChaincodeMix(&sysParams)
+	if e != nil {
+		logger.Fatal(e)
+	}
 
 	rpcPeer = &RPCPeer{
 		id: id,
@@ -36,10 +61,20 @@ func MakeRPCPeer(prg *amcl.RAND, id int, auditSk dac.SK) (rpcPeer *RPCPeer) {
 			sk: sk,
 			pk: pk,
 		},
-		cache:         make([][32]byte, 0),
-		auditSK:       auditSk,
-		transactions:  make([]*Transaction, 0),
-		txRecordMutex: &sync.Mutex{},
+		cache:            make([][32]byte, 0),
+		certificates:     make([][32]byte, 0),
+		certificateMutex: &sync.Mutex{},
+		auditSK:          auditSk,
+		blocks:           make([]*Transaction, 0),
+		pending:          make(map[int]*Transaction),
+		state:            helpers.MakeWorldState(),
+		ledgerMutex:      &sync.Mutex{},
+		sequenceMutex:    &sync.Mutex{},
+
+		chaincodes:      chaincodes,
+		chaincodeSource: rand.NewSource(helpers.RandomULong(helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("peer-%d-chaincodes", id)))),
+
+		random: makeRandomness(prg),
 	}
 
 	revocationPk := makeRPCCallSync(sysParams.RevocationRPCAddress, "RPCRevocation.GetPK", new(int), new([]byte)).(*[]byte)
@@ -47,15 +82,31 @@ func MakeRPCPeer(prg *amcl.RAND, id int, auditSk dac.SK) (rpcPeer *RPCPeer) {
 
 	rpcPeer.revocationPK = revocationAuthorityPk
 
+	orgPk := makeRPCCallSync(sysParams.OrgRPCAddress, "RPCOrganization.GetPK", new(int), new([]byte)).(*[]byte)
+	rpcPeer.orgPK, _ = dac.PointFromBytes(*orgPk)
+
+	// peer IDs start at 1, policies number peers as their addresses
+	certificateRequest := &CertificateRequest{
+		PK:   dac.PointToBytes(pk),
+		Peer: id - 1,
+	}
+	rpcPeer.certificate = *makeRPCCallSync(sysParams.OrgRPCAddress, "RPCOrganization.ProcessCertificateRequest", certificateRequest, new(Certificate)).(*Certificate)
+	rpcPeer.validateCertificate(&rpcPeer.certificate)
+
+	logger.Infof("Received certificate of peer-%d in org-%d", rpcPeer.certificate.Peer, rpcPeer.certificate.Org)
+
 	return
 }
 
-// Audit ...
-func (peer *RPCPeer) Audit(args *int, reply *bool) (e error) {
+// Audit checks the blocks committed since the previous audit and replies with the head of the ledger
+func (peer *RPCPeer) Audit(args *int, reply *LedgerHead) (e error) {
 
-	logger.Noticef("Audit started over %d transactions", len(peer.transactions))
+	peer.ledgerMutex.Lock()
+	defer peer.ledgerMutex.Unlock()
 
-	for _, transaction := range peer.transactions {
+	logger.Noticef("Audit started over %d transactions", len(peer.blocks)-peer.audited)
+
+	for _, transaction := range peer.blocks[peer.audited:] {
 		auditEnc := dac.AuditingEncryptionFromBytes(transaction.AuditEnc)
 		decryptedPK := auditEnc.AuditingDecrypt(peer.auditSK)
 		authorPK, _ := dac.PointFromBytes(transaction.AuthorPK)
@@ -65,11 +116,27 @@ func (peer *RPCPeer) Audit(args *int, reply *bool) (e error) {
 		}
 	}
 
+	peer.audited = len(peer.blocks)
+
 	logger.Notice("Audit completed")
 
-	peer.transactions = make([]*Transaction, 0)
+	reply.Height = peer.ledger.Height()
+	reply.Hash = peer.ledger.Head()
+	reply.Bytes = peer.ledger.Bytes()
+	reply.StateHash = peer.state.Hash()
+	reply.Invalid = peer.invalid
+
+	return
+}
+
+// Sequence hands out ledger positions so that all peers commit in the same order
+func (peer *RPCPeer) Sequence(args *int, reply *int) (e error) {
 
-	logger.Notice("Ledger cleared")
+	peer.sequenceMutex.Lock()
+	defer peer.sequenceMutex.Unlock()
+
+	*reply = peer.sequence
+	peer.sequence++
 
 	return
 }
@@ -91,17 +158,27 @@ func (peer *RPCPeer) Validate(args *Transaction, reply *bool) (e error) {
 		panic(e)
 	}
 
-	if len(args.Endorsements) < sysParams.Endorsements {
-		logger.Fatal("RPCPeer.Validate(): too few endorsements")
-	}
-
-	schnorr := dac.MakeSchnorr(helpers.NewRand(), false)
+	// endorsers are known only by the certificates their organization issued
+	endorsers := make([]helpers.Identity, 0, len(args.Endorsements))
+	schnorr := dac.MakeSchnorr(peer.random.fork(), false)
 	for _, endorsement := range args.Endorsements {
-		endorserPK, _ := dac.PointFromBytes(endorsement.PK)
+		peer.validateCertificate(&endorsement.Certificate)
+
+		endorserPK, _ := dac.PointFromBytes(endorsement.Certificate.PK)
 		endorserSignature := dac.SchnorrSignatureFromBytes(endorsement.Signature)
 		if e := schnorr.Verify(endorserPK, *endorserSignature, args.Proposal.getMessage()); e != nil {
 			logger.Fatal("RPCPeer.Validate(): endorsement is invalid")
 		}
+		endorsers = append(endorsers, helpers.Identity{Peer: endorsement.Certificate.Peer, Org: endorsement.Certificate.Org})
+	}
+	chaincode := peer.chaincodes.Get(args.Proposal.Chaincode)
+	if chaincode == nil {
+		logger.Fatalf("RPCPeer.Validate(): unknown chaincode \"%s\"", args.Proposal.Chaincode)
+	}
+	if satisfied, e := chaincode.Policy().Satisfied(endorsers); e != nil {
+		logger.Fatalf("RPCPeer.Validate(): %v", e)
+	} else if !satisfied {
+		logger.Fatal("RPCPeer.Validate(): endorsements do not satisfy the endorsement policy")
 	}
 
 	peer.validateIdentity(args.Proposal.Author, pkNym, indices)
@@ -114,21 +191,21 @@ func (peer *RPCPeer) Validate(args *Transaction, reply *bool) (e error) {
 		}
 	}
 
-	if sysParams.Revoke {
+	// a class peers do not know could dodge the non-revocation proof
+	if _, found := sysParams.Class(args.Proposal.Class); !found {
+		logger.Fatalf("RPCPeer.Validate(): unknown class \"%s\"", args.Proposal.Class)
+	}
+	if args.Proposal.revocable() {
 		nrhProof := dac.RevocationProofFromBytes(args.NonRevocationProof)
 		if e := nrhProof.Verify(pkNym, FP256BN.NewBIGint(args.Epoch), sysParams.H, peer.revocationPK, sysParams.Ys[1]); e != nil {
 			logger.Fatal("RPCPeer.Validate(): NRH is invalid")
 		}
 	}
 
-	// somewhere here are read/write conflict check and ledger update
-	// but they are negligible in comparison to crypto
-
-	executeChaincode()
+	// charged again as in endorsement, the outcome is already in the transaction
+	peer.executeChaincode(&args.Proposal)
 
-	peer.txRecordMutex.Lock()
-	peer.transactions = append(peer.transactions, args)
-	peer.txRecordMutex.Unlock()
+	peer.commit(args)
 
 	*reply = true
 
@@ -137,6 +214,51 @@ func (peer *RPCPeer) Validate(args *Transaction, reply *bool) (e error) {
 	return
 }
 
+// transactions are validated concurrently, but go into the ledger in the order of their sequence numbers
+func (peer *RPCPeer) commit(tx *Transaction) {
+
+	peer.ledgerMutex.Lock()
+	defer peer.ledgerMutex.Unlock()
+
+	peer.pending[tx.Sequence] = tx
+
+	for next, exists := peer.pending[peer.ledger.Height()]; exists; next, exists = peer.pending[peer.ledger.Height()] {
+		delete(peer.pending, next.Sequence)
+
+		// MVCC check in ledger order; it is negligible in comparison to crypto
+		if peer.check(next) {
+			peer.state.Apply(next.RWSet, helpers.Version{Block: next.Sequence})
+		} else {
+			peer.invalid++
+			logger.Infof("Transaction %d is invalid", next.Sequence)
+		}
+
+		header := helpers.BlockHeader{
+			Number:       next.Sequence,
+			PreviousHash: peer.ledger.Head(),
+			DataHash:     helpers.DataHash([][]byte{next.Proposal.Hash}),
+		}
+		if e := peer.ledger.Append(header, next.size()); e != nil {
+			logger.Fatal("RPCPeer.commit():", e)
+		}
+		peer.blocks = append(peer.blocks, next)
+
+		logger.Debugf("Block %d committed", header.Number)
+	}
+}
+
+func (peer *RPCPeer) check(tx *Transaction) bool {
+
+	// all endorsers must have simulated the same outcome
+	for _, endorsement := range tx.Endorsements {
+		if !endorsement.RWSet.Equal(tx.RWSet) {
+			return false
+		}
+	}
+
+	return peer.state.Validate(tx.RWSet)
+}
+
 // Order ...
 func (peer *RPCPeer) Order(args *Transaction, reply *bool) (e error) {
 
@@ -152,7 +274,9 @@ func (peer *RPCPeer) Order(args *Transaction, reply *bool) (e error) {
 
 	peer.validateIdentity(args.Proposal.Author, pkNym, indices)
 
-	logger.Debug("Validate TX identity, sending to others")
+	args.Sequence = *makeRPCCallSync(sysParams.PeerRPCAddresses[0], "RPCPeer.Sequence", new(int), new(int)).(*int)
+
+	logger.Debugf("Validate TX identity, sending to others as %d", args.Sequence)
 
 	// SEND TO OTHERS (including self)
 	validateCallClients := make([]rpcCallClient, 0)
@@ -206,20 +330,44 @@ func (peer *RPCPeer) Endorse(args *TransactionProposal, reply *Endorsement) (e e
 	peer.validateIdentity(args.Author, pkNym, indices)
 
 	// Execute proposal
-	executeChaincode()
+	reply.RWSet = peer.executeChaincode(args)
 
 	// All set!
-	schnorr := dac.MakeSchnorr(helpers.NewRand(), false)
+	schnorr := dac.MakeSchnorr(peer.random.fork(), false)
 	schnorrSignature := schnorr.Sign(peer.keys.sk, args.getMessage())
 
 	logger.Debugf("peer-%d endorsed transaction payload %s", peer.id, fmt.Sprintf("user-%d", args.AuthorID))
 	reply.Signature = schnorrSignature.ToBytes()
-	reply.PK = dac.PointToBytes(peer.keys.pk)
-	reply.ID = peer.id
+	reply.Certificate = peer.certificate
 
 	return
 }
 
+func (peer *RPCPeer) validateCertificate(certificate *Certificate) {
+
+	var key [32]byte
+	copy(key[:], helpers.Sha3(append(certificate.getMessage(), certificate.Signature...)))
+
+	peer.certificateMutex.Lock()
+	defer peer.certificateMutex.Unlock()
+
+	for _, cached := range peer.certificates {
+		if cached == key {
+			return
+		}
+	}
+
+	if certificate.Org != peer.certificate.Org {
+		logger.Fatalf("RPCPeer.validateCertificate(): org-%d is not known", certificate.Org)
+	}
+	signature := dac.SchnorrSignatureFromBytes(certificate.Signature)
+	if e := dac.MakeSchnorr(peer.random.fork(), true).Verify(peer.orgPK, *signature, certificate.getMessage()); e != nil {
+		logger.Fatal("RPCPeer.validateCertificate():", e)
+	}
+
+	peer.certificates = append(peer.certificates, key)
+}
+
 func (peer *RPCPeer) validateIdentity(proof []byte, pkNym interface{}, indices dac.Indices) {
 
 	var key [32]byte
@@ -238,13 +386,25 @@ func (peer *RPCPeer) validateIdentity(proof []byte, pkNym interface{}, indices d
 	peer.cache = append(peer.cache, key)
 }
 
-func executeChaincode() {
-	time.Sleep(50 * time.Millisecond)
+func (peer *RPCPeer) executeChaincode(tp *TransactionProposal) (rwset helpers.ReadWriteSet) {
+
+	chaincode := peer.chaincodes.Get(tp.Chaincode)
+	if chaincode == nil {
+		logger.Fatalf("RPCPeer.executeChaincode(): peer does not have chaincode %s", tp.Chaincode)
+	}
+
+	peer.ledgerMutex.Lock()
+	rwset, cost := chaincode.Execute(helpers.Invocation{Keys: tp.Keys, Argument: tp.argument()}, peer.state, peer.chaincodeSource)
+	peer.ledgerMutex.Unlock()
+
+	time.Sleep(cost)
+
+	return
 }
 
 // Endorsement ...
 type Endorsement struct {
-	Signature []byte // dac.SchnorrSignature
-	PK        []byte
-	ID        int
+	Signature   []byte // dac.SchnorrSignature
+	Certificate Certificate
+	RWSet       helpers.ReadWriteSet
 }
@@ -6,12 +6,12 @@ import (
 	"github.com/dbogatov/dac-lib/dac"
 	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
-	"github.com/dbogatov/fabric-simulator/helpers"
 )
 
 // RPCRevocation ...
 type RPCRevocation struct {
-	keys KeysHolder
+	keys   KeysHolder
+	random randomness
 }
 
 var epoch int = 1
@@ -19,7 +19,7 @@ var epoch int = 1
 // MakeRPCRevocation ...
 func MakeRPCRevocation(prg *amcl.RAND) (rpcRevocation *RPCRevocation) {
 
-	groth := dac.MakeGroth(helpers.NewRand(), true, sysParams.Ys[1])
+	groth := dac.MakeGroth(prg, true, sysParams.Ys[1])
 	sk, pk := groth.Generate()
 
 	rpcRevocation = &RPCRevocation{
@@ -27,6 +27,7 @@ func MakeRPCRevocation(prg *amcl.RAND) (rpcRevocation *RPCRevocation) {
 			pk: pk,
 			sk: sk,
 		},
+		random: makeRandomness(prg),
 	}
 
 	go func() {
@@ -66,7 +67,7 @@ func (rpcRevocation *RPCRevocation) GetPK(args *int, reply *[]byte) (e error) {
 // ProcessNRR ...
 func (rpcRevocation *RPCRevocation) ProcessNRR(args *NonRevocationRequest, reply *NonRevocationHandle) (e error) {
 
-	prg := helpers.NewRand()
+	prg := rpcRevocation.random.fork()
 	nrr, _ := dac.PointFromBytes(args.PK)
 
 	nrh := dac.SignNonRevoke(prg, rpcRevocation.keys.sk, nrr, FP256BN.NewBIGint(epoch), sysParams.Ys[1])
@@ -12,6 +12,7 @@ import (
 type RPCRoot struct {
 	creds   CredentialsHolder
 	starter []byte
+	random  randomness
 }
 
 // MakeRPCRoot ...
@@ -27,6 +28,7 @@ func MakeRPCRoot(prg *amcl.RAND, rootSk dac.SK) (rpcRoot *RPCRoot) {
 			id:          0,
 		},
 		starter: nil,
+		random:  makeRandomness(prg),
 	}
 
 	rpcRoot.starter = rpcRoot.creds.credentials.ToBytes()
@@ -36,7 +38,7 @@ func MakeRPCRoot(prg *amcl.RAND, rootSk dac.SK) (rpcRoot *RPCRoot) {
 
 // GetNonce ...
 func (rpcRoot *RPCRoot) GetNonce(args *int, reply *[]byte) (e error) {
-	prg := helpers.NewRand()
+	prg := rpcRoot.random.fork()
 
 	*reply = helpers.RandomBytes(prg, helpers.NonceSize)
 
@@ -49,7 +51,7 @@ func (rpcRoot *RPCRoot) GetNonce(args *int, reply *[]byte) (e error) {
 func (rpcRoot *RPCRoot) ProcessCredRequest(args *CredRequest, reply *Credentials) (e error) {
 
 	credRequest := dac.CredRequestFromBytes(args.Request)
-	prg := helpers.NewRand()
+	prg := rpcRoot.random.fork()
 
 	if e := credRequest.Validate(); e != nil {
 		logger.Fatal("credRequest.Validate():", e)
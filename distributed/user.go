@@ -2,12 +2,14 @@ package distributed
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dbogatov/dac-lib/dac"
 	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
 	"github.com/dbogatov/fabric-simulator/helpers"
+	"golang.org/x/exp/rand"
 	"gonum.org/v1/gonum/stat/distuv"
 )
 
@@ -15,8 +17,15 @@ import (
 type User struct {
 	creds   CredentialsHolder
 	epoch   int
+	class   helpers.ClassParameters
 	poisson distuv.Poisson
 	nrh     dac.GrothSignature
+	prg     *amcl.RAND
+	mutex   *sync.Mutex // guards the randomness and the handle while transactions overlap
+
+	keySpace   *helpers.KeySpace
+	chaincodes *helpers.ChaincodeMix
+	keys       *amcl.RAND // separate, so that key contention does not change the rest of the run
 
 	revocationAuthorityPk dac.PK
 	revocationPk          dac.PK
@@ -46,6 +55,21 @@ func MakeUser(prg *amcl.RAND, id int) (user *User) {
 	revocationPk := makeRPCCallSync(sysParams.RevocationRPCAddress, "RPCRevocation.GetPK", new(int), new([]byte)).(*[]byte)
 	revocationAuthorityPk, _ := dac.PointFromBytes(*revocationPk)
 
+	keySpace, e := helpers.MakeKeySpace(sysParams.KeyAccess, sysParams.Keys, sysParams.Zipf, sysParams.HotKeys, sysParams.HotShare)
+	if e != nil {
+		logger.Fatal(e)
+	}
+	chaincodes, e := helpers.MakeChaincodeMix(&sysParams)
+	if e != nil {
+		logger.Fatal(e)
+	}
+	class, found := sysParams.Class(sysParams.ProcessClass)
+	if !found {
+		logger.Fatalf("class \"%s\" is not in workload.classes", sysParams.ProcessClass)
+	}
+
+	arrivals := sysParams.UserArrivals(id)
+
 	user = &User{
 		creds: CredentialsHolder{
 			KeysHolder: KeysHolder{
@@ -57,9 +81,16 @@ func MakeUser(prg *amcl.RAND, id int) (user *User) {
 			id:          id,
 		},
 		epoch: -1,
+		class: class,
+		mutex: &sync.Mutex{},
 		poisson: distuv.Poisson{
-			Lambda: 3600.0 / float64(sysParams.Frequency),
+			Lambda: 3600.0 / float64(arrivals.Frequency),
+			Src:    rand.NewSource(helpers.RandomULong(prg)),
 		},
+		prg:        prg,
+		keySpace:   keySpace,
+		chaincodes: chaincodes.Reweighted(class.Mix),
+		keys:       helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("user-%d-keys", id)),
 
 		revocationAuthorityPk: revocationAuthorityPk,
 		revocationPk:          FP256BN.ECP_generator().Mul(userSk),
@@ -74,38 +105,82 @@ func MakeUser(prg *amcl.RAND, id int) (user *User) {
 
 func (user *User) runTransactions() {
 
-	for i := 0; i < sysParams.Transactions; i++ {
+	arrivals := sysParams.UserArrivals(user.creds.id)
+
+	if arrivals.Open() {
+		if e := sysParams.LoadArrivals(); e != nil {
+			logger.Fatal(e)
+		}
+		src := rand.NewSource(helpers.RandomULong(helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("user-%d-arrivals", user.creds.id))))
+		start := time.Now()
+
+		var wg sync.WaitGroup
+		for _, arrival := range sysParams.UserSchedule(user.creds.id, src) {
+			time.Sleep(time.Until(start.Add(arrival.At)))
+
+			user.mutex.Lock()
+			message := helpers.RandomString(user.prg, 16)
+			user.mutex.Unlock()
+
+			wg.Add(1)
+			arrival := arrival
+			go func() {
+				defer wg.Done()
+				user.submitTransaction(message, arrival)
+			}()
+		}
+		wg.Wait()
+
+		return
+	}
+
+	for i := 0; i < user.class.Transactions; i++ {
 
 		// subsequent sleeps Poisson
-		if sysParams.Frequency > 0 {
+		if arrivals.Frequency > 0 {
 			sleep := time.Duration((3600.0/user.poisson.Rand())*1000) * time.Millisecond
 			logger.Debugf("Will wait %d ms", sleep.Milliseconds())
 			time.Sleep(sleep)
 		}
 
-		message := helpers.RandomString(helpers.NewRand(), 16)
-		user.submitTransaction(message)
+		message := helpers.RandomString(user.prg, 16)
+		user.submitTransaction(message, helpers.Arrival{})
 	}
 }
 
-func (user *User) submitTransaction(message string) {
+// submitTransaction invokes the chaincode of the arrival with its payload, if they are set
+func (user *User) submitTransaction(message string, arrival helpers.Arrival) {
 
 	startTime := time.Now()
 
 	logger.Noticef("Transaction \"%s\" started", message)
 
-	prg := helpers.NewRand()
+	prg := user.prg
+
+	user.mutex.Lock()
 
 	hash := helpers.Sha3([]byte(message))
-	endorsers := make([]int, 0)
+	var chaincode helpers.Chaincode
+	if arrival.Chaincode != "" {
+		chaincode = user.chaincodes.Get(arrival.Chaincode)
+	} else {
+		chaincode = user.chaincodes.Choose(user.keys)
+	}
 
 	firstEndorser := helpers.PeerByHash(helpers.Sha3([]byte(message)), sysParams.Peers)
 
-	for peer := 0; peer < sysParams.Endorsements; peer++ {
-		endorsers = append(endorsers, (firstEndorser+peer)%sysParams.Peers)
+	endorsers, e := chaincode.Policy().Endorsers(&sysParams, firstEndorser)
+	if e != nil {
+		logger.Fatal(e)
 	}
+	keys := user.keySpace.Choose(user.keys, chaincode.Keys())
 
-	proposal, pkNym, skNym := user.MakeTransactionProposal(hash)
+	var payload []byte
+	if arrival.Payload > 0 {
+		payload = helpers.PayloadFrom(hash, arrival.Payload)
+	}
+
+	proposal, pkNym, skNym := user.MakeTransactionProposal(hash, chaincode.Name(), keys, payload)
 	endorsements := make([]Endorsement, 0)
 
 	schnorr := dac.MakeSchnorr(prg, false)
@@ -115,6 +190,8 @@ func (user *User) submitTransaction(message string) {
 		endorseCallClients = append(endorseCallClients, callClient)
 	}
 
+	user.mutex.Unlock()
+
 	for _, endorseCallClient := range endorseCallClients {
 
 		<-endorseCallClient.call.Done
@@ -126,26 +203,30 @@ func (user *User) submitTransaction(message string) {
 
 		endorsements = append(endorsements, *endorsement)
 
-		logger.Infof("Got endorsement from %d", endorsement.ID)
+		logger.Infof("Got endorsement from peer-%d of org-%d", endorsement.Certificate.Peer, endorsement.Certificate.Org)
 
-		endorserPK, _ := dac.PointFromBytes(endorsement.PK)
+		// the client trusts the key in the certificate, the chain is checked at validation
+		endorserPK, _ := dac.PointFromBytes(endorsement.Certificate.PK)
 		endorserSignature := dac.SchnorrSignatureFromBytes(endorsement.Signature)
 		if e := schnorr.Verify(endorserPK, *endorserSignature, proposal.getMessage()); e != nil {
 			logger.Fatal("schnorr.Verify():", e)
 		}
 	}
 
+	user.mutex.Lock()
+
 	txSignature := dac.SignNym(prg, pkNym, skNym, user.creds.sk, sysParams.H, proposal.getMessage())
 
 	tx := &Transaction{
 		Signature:    txSignature.ToBytes(),
 		Proposal:     *proposal,
 		Endorsements: endorsements,
+		RWSet:        endorsements[0].RWSet, // peers check that the endorsers agree
 		Epoch:        user.epoch,
 		AuthorPK:     dac.PointToBytes(user.creds.pk),
 	}
 
-	if sysParams.Revoke {
+	if user.class.Revoke {
 		user.updateNRH()
 
 		nrhProof := dac.RevocationProve(prg, user.nrh, user.creds.sk, skNym, FP256BN.NewBIGint(user.epoch), sysParams.H, sysParams.Ys[0])
@@ -155,13 +236,15 @@ func (user *User) submitTransaction(message string) {
 	if sysParams.Audit {
 
 		// fresh auditing encryption and proof every transaction
-		auditEnc, auditR := dac.AuditingEncrypt(helpers.NewRand(), sysParams.AuditPK, user.creds.pk)
+		auditEnc, auditR := dac.AuditingEncrypt(prg, sysParams.AuditPK, user.creds.pk)
 
 		tx.AuditEnc = auditEnc.ToBytes()
 		auditProof := dac.AuditingProve(prg, auditEnc, user.creds.pk, user.creds.sk, pkNym, skNym, sysParams.AuditPK, auditR, sysParams.H)
 		tx.AuditProof = auditProof.ToBytes()
 	}
 
+	user.mutex.Unlock()
+
 	orderer := helpers.PeerByHash(helpers.Sha3([]byte(fmt.Sprintf("%s-order", message))), sysParams.Peers)
 
 	makeRPCCallSync(sysParams.PeerRPCAddresses[orderer], "RPCPeer.Order", tx, new(bool))
@@ -185,7 +268,7 @@ func (user *User) updateNRH() {
 		nrh := makeRPCCallSync(sysParams.RevocationRPCAddress, "RPCRevocation.ProcessNRR", nrr, new(NonRevocationHandle)).(*NonRevocationHandle)
 
 		handle := dac.GrothSignatureFromBytes(nrh.Handle)
-		groth := dac.MakeGroth(helpers.NewRand(), true, sysParams.Ys[1])
+		groth := dac.MakeGroth(user.prg, true, sysParams.Ys[1])
 
 		if e := groth.Verify(user.revocationAuthorityPk, *handle, []interface{}{user.revocationPk, FP256BN.ECP_generator().Mul(FP256BN.NewBIGint(user.epoch))}); e != nil {
 			logger.Fatal("groth.Verify():", e)
@@ -198,9 +281,9 @@ func (user *User) updateNRH() {
 }
 
 // MakeTransactionProposal ...
-func (user *User) MakeTransactionProposal(hash []byte) (tp *TransactionProposal, pkNym interface{}, skNym dac.SK) {
+func (user *User) MakeTransactionProposal(hash []byte, chaincode string, keys []string, payload []byte) (tp *TransactionProposal, pkNym interface{}, skNym dac.SK) {
 
-	prg := helpers.NewRand()
+	prg := user.prg
 
 	skNym, pkNym = dac.GenerateNymKeys(prg, user.creds.sk, sysParams.H)
 	indices := dac.Indices{
@@ -228,12 +311,15 @@ func (user *User) MakeTransactionProposal(hash []byte) (tp *TransactionProposal,
 	author := proof.ToBytes()
 
 	tp = &TransactionProposal{
-		Chaincode:  "chaincode: hash | policy: write",
+		Chaincode:  chaincode,
 		AuthorID:   user.creds.id,
+		Class:      user.class.Name,
 		Hash:       hash,
 		Author:     author,
 		PkNym:      dac.PointToBytes(pkNym),
 		IndexValue: dac.PointToBytes(indices[0].Attribute),
+		Keys:       keys,
+		Payload:    payload,
 	}
 
 	signature := dac.SignNym(prg, pkNym, skNym, user.creds.sk, sysParams.H, tp.getMessage())
@@ -249,7 +335,26 @@ func (tp *TransactionProposal) getMessage() (message []byte) {
 	message = append(message, tp.Hash...)
 	message = append(message, []byte(tp.Chaincode)...)
 	message = append(message, byte(tp.AuthorID))
+	message = append(message, []byte(tp.Class)...)
 	message = append(message, tp.Author...)
+	for _, key := range tp.Keys {
+		message = append(message, []byte(key)...)
+	}
+	message = append(message, tp.Payload...)
 
 	return
 }
+
+// revocable tells whether the transaction carries a non-revocation proof, as the class of its author does
+func (tp *TransactionProposal) revocable() bool {
+	class, _ := sysParams.Class(tp.Class)
+	return class.Revoke
+}
+
+// argument is what the chaincode writes
+func (tp *TransactionProposal) argument() []byte {
+	if tp.Payload != nil {
+		return tp.Payload
+	}
+	return tp.Hash
+}
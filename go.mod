@@ -7,7 +7,8 @@ require (
 	github.com/dbogatov/fabric-amcl v0.0.0-20190731091901-c69f438d7884
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
 	github.com/urfave/cli/v2 v2.1.1
-	golang.org/x/exp v0.0.0-20200119233911-0405dc783f0a // indirect
+	golang.org/x/exp v0.0.0-20200119233911-0405dc783f0a
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 	gonum.org/v1/gonum v0.6.2
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/exp/rand"
+)
+
+// Arrival patterns of transactions
+const (
+	ClosedArrivals  = "closed"  // every user submits its transactions one after another, thinking in between
+	OpenArrivals    = "open"    // Poisson arrivals at a target rate, whether or not the earlier transactions are done
+	BurstyArrivals  = "bursty"  // open arrivals during on periods, none during off periods
+	DiurnalArrivals = "diurnal" // open arrivals at a rate that follows a sine curve over the period
+	TraceArrivals   = "trace"   // arrivals at the times of a trace, listed or read from a file
+)
+
+// ArrivalPatterns lists the arrival patterns
+var ArrivalPatterns = []string{ClosedArrivals, OpenArrivals, BurstyArrivals, DiurnalArrivals, TraceArrivals}
+
+// DefaultDiurnalPeriod ...
+const DefaultDiurnalPeriod = 24 * time.Hour
+
+// ArrivalParameters is the arrival pattern shared by a group of users
+type ArrivalParameters struct {
+	Pattern   string
+	Frequency int     // seconds a closed-loop user thinks between transactions, on average
+	Rate      float64 // transactions per second over all users of the group
+	On        time.Duration
+	Off       time.Duration
+	Period    time.Duration
+	Amplitude float64       // of the diurnal rate, relative to the mean
+	Peak      time.Duration // into the period, when the diurnal rate is highest
+	Trace     []TraceRecord
+	TraceFile string // read into the trace by Load
+}
+
+// Open tells whether transactions arrive regardless of the earlier ones
+func (arrivals ArrivalParameters) Open() bool {
+	return arrivals.Pattern != ClosedArrivals
+}
+
+// Load reads the trace file, if any
+func (arrivals *ArrivalParameters) Load() (e error) {
+	if arrivals.TraceFile != "" && arrivals.Trace == nil {
+		arrivals.Trace, e = LoadTrace(arrivals.TraceFile)
+	}
+	return
+}
+
+// Schedule generates the arrivals of one user of the group for the open patterns but the trace;
+// the rate is shared evenly by the users, so their Poisson processes add up to it
+func (arrivals ArrivalParameters) Schedule(users, transactions int, src rand.Source) (schedule []Arrival) {
+
+	random := rand.New(src)
+	rate := arrivals.Rate / float64(users) / float64(time.Second) // per nanosecond
+
+	times := make([]time.Duration, 0, transactions)
+
+	switch arrivals.Pattern {
+	case OpenArrivals:
+		var at float64
+		for i := 0; i < transactions; i++ {
+			at += random.ExpFloat64() / rate
+			times = append(times, time.Duration(at))
+		}
+
+	case BurstyArrivals:
+		// a Poisson process in the time spent in bursts, stretched over the off periods
+		var active float64
+		for i := 0; i < transactions; i++ {
+			active += random.ExpFloat64() / rate
+			bursts := math.Floor(active / float64(arrivals.On))
+			times = append(times, time.Duration(bursts*float64(arrivals.On+arrivals.Off)+math.Mod(active, float64(arrivals.On))))
+		}
+
+	case DiurnalArrivals:
+		// thinning: candidates at the peak rate, each kept with the ratio of the current rate to the peak one
+		peak := rate * (1 + arrivals.Amplitude)
+		var at float64
+		for len(times) < transactions {
+			at += random.ExpFloat64() / peak
+			phase := 2 * math.Pi * (at - float64(arrivals.Peak)) / float64(arrivals.Period)
+			if random.Float64()*peak < rate*(1+arrivals.Amplitude*math.Cos(phase)) {
+				times = append(times, time.Duration(at))
+			}
+		}
+	}
+
+	for _, at := range times {
+		schedule = append(schedule, Arrival{At: at})
+	}
+
+	return
+}
@@ -0,0 +1,229 @@
+package helpers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/dbogatov/fabric-amcl/amcl"
+	"golang.org/x/exp/rand"
+)
+
+// Built-in chaincodes
+const (
+	NoopChaincode          = "noop"
+	KeyValueChaincode      = "kv"     // reads keys, then writes the first of them
+	KeyValuePutChaincode   = "kv-put" // blind writes
+	KeyValueGetChaincode   = "kv-get" // reads only
+	AssetTransferChaincode = "asset-transfer"
+)
+
+// Chaincodes lists the built-in chaincodes
+var Chaincodes = []string{NoopChaincode, KeyValueChaincode, KeyValuePutChaincode, KeyValueGetChaincode, AssetTransferChaincode}
+
+// InitialBalance every asset-transfer account starts with
+const InitialBalance = 100
+
+// Invocation is what a proposal asks a chaincode to do
+type Invocation struct {
+	Keys     []string // exactly as many as the chaincode touches
+	Argument []byte   // value to write for the key-value chaincodes
+}
+
+// Chaincode simulates a proposal against a world state
+type Chaincode interface {
+	Name() string
+	Keys() int // number of keys an invocation touches
+	Policy() *Policy
+	Execute(invocation Invocation, state *WorldState, src rand.Source) (rwset ReadWriteSet, cost time.Duration)
+}
+
+type builtinChaincode struct {
+	name     string
+	keys     int
+	cost     DurationDistribution
+	policy   *Policy
+	simulate func(invocation Invocation, state *WorldState) ReadWriteSet
+}
+
+func (chaincode *builtinChaincode) Name() string {
+	return chaincode.name
+}
+
+func (chaincode *builtinChaincode) Keys() int {
+	return chaincode.keys
+}
+
+func (chaincode *builtinChaincode) Policy() *Policy {
+	return chaincode.policy
+}
+
+func (chaincode *builtinChaincode) Execute(invocation Invocation, state *WorldState, src rand.Source) (rwset ReadWriteSet, cost time.Duration) {
+	return chaincode.simulate(invocation, state), chaincode.cost.Sample(src)
+}
+
+// MakeChaincode returns the built-in chaincode of that name;
+// reads and writes only matter for the key-value chaincodes
+func MakeChaincode(parameters ChaincodeParameters, reads, writes int) (chaincode Chaincode, e error) {
+
+	name := parameters.Name
+	if e = parameters.Cost.Validate(); e != nil {
+		return nil, fmt.Errorf("chaincode %s: %v", name, e)
+	}
+
+	builtin := &builtinChaincode{
+		name: name,
+		cost: parameters.Cost,
+	}
+	if builtin.policy, e = ParsePolicy(parameters.Policy); e != nil {
+		return nil, fmt.Errorf("chaincode %s: %v", name, e)
+	}
+
+	switch name {
+	case NoopChaincode:
+		builtin.simulate = func(invocation Invocation, state *WorldState) (rwset ReadWriteSet) {
+			return
+		}
+	case KeyValueChaincode:
+		builtin.keys = reads
+		if writes > reads {
+			builtin.keys = writes
+		}
+		builtin.simulate = func(invocation Invocation, state *WorldState) ReadWriteSet {
+			return state.Simulate(invocation.Keys[:reads], keyWrites(invocation.Keys[:writes], invocation.Argument))
+		}
+	case KeyValuePutChaincode:
+		builtin.keys = writes
+		builtin.simulate = func(invocation Invocation, state *WorldState) ReadWriteSet {
+			return state.Simulate(nil, keyWrites(invocation.Keys, invocation.Argument))
+		}
+	case KeyValueGetChaincode:
+		builtin.keys = reads
+		builtin.simulate = func(invocation Invocation, state *WorldState) ReadWriteSet {
+			return state.Simulate(invocation.Keys, nil)
+		}
+	case AssetTransferChaincode:
+		builtin.keys = 2
+		builtin.simulate = transferAsset
+	default:
+		return nil, fmt.Errorf("unknown chaincode \"%s\", expected one of %v", name, Chaincodes)
+	}
+
+	return builtin, nil
+}
+
+func keyWrites(keys []string, value []byte) (writes []KeyWrite) {
+	writes = make([]KeyWrite, 0, len(keys))
+	for _, key := range keys {
+		writes = append(writes, KeyWrite{Key: key, Value: value})
+	}
+	return
+}
+
+// moves one unit from the first account to the second; an account without funds writes nothing
+func transferAsset(invocation Invocation, state *WorldState) ReadWriteSet {
+
+	from, to := invocation.Keys[0], invocation.Keys[1]
+
+	balance := func(key string) uint64 {
+		value, _, exists := state.Read(key)
+		if !exists {
+			return InitialBalance
+		}
+		return binary.BigEndian.Uint64(value)
+	}
+	encode := func(balance uint64) (value []byte) {
+		value = make([]byte, 8)
+		binary.BigEndian.PutUint64(value, balance)
+		return
+	}
+
+	fromBalance, toBalance := balance(from), balance(to)
+	if fromBalance == 0 {
+		return state.Simulate([]string{from, to}, nil)
+	}
+
+	return state.Simulate([]string{from, to}, []KeyWrite{
+		{Key: from, Value: encode(fromBalance - 1)},
+		{Key: to, Value: encode(toBalance + 1)},
+	})
+}
+
+// ChaincodeMix is the set of chaincodes a workload invokes, picked by weight;
+// it is read-only once made, so users and peers share it
+type ChaincodeMix struct {
+	chaincodes []Chaincode
+	weights    []int
+	total      int
+}
+
+// MakeChaincodeMix ...
+func MakeChaincodeMix(sysParams *SystemParameters) (mix *ChaincodeMix, e error) {
+
+	mix = &ChaincodeMix{}
+
+	for _, parameters := range sysParams.Chaincodes {
+		if parameters.Policy == "" {
+			parameters.Policy = DefaultPolicy(sysParams.Endorsements, sysParams.Peers)
+		}
+
+		var chaincode Chaincode
+		if chaincode, e = MakeChaincode(parameters, sysParams.Reads, sysParams.Writes); e != nil {
+			return nil, e
+		}
+		mix.chaincodes = append(mix.chaincodes, chaincode)
+		mix.weights = append(mix.weights, parameters.Weight)
+		mix.total += parameters.Weight
+	}
+
+	if mix.total == 0 {
+		return nil, fmt.Errorf("no chaincode to invoke")
+	}
+
+	return
+}
+
+// Reweighted is the mix of the same chaincodes with the weights of a class, those it does not name left out;
+// the mix itself if the class keeps the weights of the workload
+func (mix *ChaincodeMix) Reweighted(weights map[string]int) *ChaincodeMix {
+
+	if weights == nil {
+		return mix
+	}
+
+	reweighted := &ChaincodeMix{chaincodes: mix.chaincodes}
+	for _, chaincode := range mix.chaincodes {
+		reweighted.weights = append(reweighted.weights, weights[chaincode.Name()])
+		reweighted.total += weights[chaincode.Name()]
+	}
+
+	return reweighted
+}
+
+// Choose picks a chaincode with probability proportional to its weight
+func (mix *ChaincodeMix) Choose(prg *amcl.RAND) Chaincode {
+
+	if len(mix.chaincodes) == 1 {
+		return mix.chaincodes[0]
+	}
+
+	draw := int(RandomULong(prg) % uint64(mix.total))
+	for i, weight := range mix.weights {
+		if draw < weight {
+			return mix.chaincodes[i]
+		}
+		draw -= weight
+	}
+
+	return mix.chaincodes[len(mix.chaincodes)-1]
+}
+
+// Get returns the chaincode of that name, or nil if the workload does not invoke it
+func (mix *ChaincodeMix) Get(name string) Chaincode {
+	for _, chaincode := range mix.chaincodes {
+		if chaincode.Name() == name {
+			return chaincode
+		}
+	}
+	return nil
+}
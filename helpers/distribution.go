@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Distributions of a duration
+const (
+	ConstantDistribution  = "constant"
+	NormalDistribution    = "normal"
+	LogNormalDistribution = "lognormal"
+	EmpiricalDistribution = "empirical"
+)
+
+// DurationDistribution describes how long something takes, e.g. a crypto event or a chaincode execution
+type DurationDistribution struct {
+	Distribution string
+	Samples      int
+	Mean         time.Duration
+	StdDev       time.Duration
+	Min          time.Duration
+	Max          time.Duration
+	Percentiles  []Percentile // sorted, required for empirical distribution
+}
+
+// Percentile ...
+type Percentile struct {
+	Percentile float64 // 0 to 100
+	Duration   time.Duration
+}
+
+// ConstantDuration ...
+func ConstantDuration(mean time.Duration) DurationDistribution {
+	return DurationDistribution{
+		Distribution: ConstantDistribution,
+		Mean:         mean,
+	}
+}
+
+// Validate ...
+func (distribution DurationDistribution) Validate() (e error) {
+
+	if distribution.Mean < 0 || distribution.StdDev < 0 {
+		return fmt.Errorf("negative mean or standard deviation")
+	}
+
+	switch distribution.Distribution {
+	case ConstantDistribution, NormalDistribution:
+	case LogNormalDistribution:
+		if distribution.Mean == 0 {
+			return fmt.Errorf("lognormal distribution needs a positive mean")
+		}
+	case EmpiricalDistribution:
+		if len(distribution.Percentiles) < 2 {
+			return fmt.Errorf("empirical distribution needs at least two percentiles")
+		}
+		if !sort.SliceIsSorted(distribution.Percentiles, func(i, j int) bool {
+			return distribution.Percentiles[i].Percentile < distribution.Percentiles[j].Percentile
+		}) {
+			return fmt.Errorf("percentiles must be sorted")
+		}
+	default:
+		return fmt.Errorf("unknown distribution \"%s\"", distribution.Distribution)
+	}
+
+	return
+}
+
+// Sample ...
+func (distribution DurationDistribution) Sample(src rand.Source) (duration time.Duration) {
+
+	switch distribution.Distribution {
+	case NormalDistribution:
+		duration = time.Duration(distuv.Normal{
+			Mu:    float64(distribution.Mean),
+			Sigma: float64(distribution.StdDev),
+			Src:   src,
+		}.Rand())
+	case LogNormalDistribution:
+		mean := float64(distribution.Mean)
+		variance := float64(distribution.StdDev) * float64(distribution.StdDev)
+		sigma2 := math.Log(1 + variance/(mean*mean))
+		duration = time.Duration(distuv.LogNormal{
+			Mu:    math.Log(mean) - sigma2/2,
+			Sigma: math.Sqrt(sigma2),
+			Src:   src,
+		}.Rand())
+	case EmpiricalDistribution:
+		// inverse CDF, linear between the measured percentiles
+		u := 100 * rand.New(src).Float64()
+		points := distribution.Percentiles
+		if u <= points[0].Percentile {
+			return points[0].Duration
+		}
+		for i := 1; i < len(points); i++ {
+			if u <= points[i].Percentile {
+				fraction := (u - points[i-1].Percentile) / (points[i].Percentile - points[i-1].Percentile)
+				return points[i-1].Duration + time.Duration(fraction*float64(points[i].Duration-points[i-1].Duration))
+			}
+		}
+		return points[len(points)-1].Duration
+	default:
+		duration = distribution.Mean
+	}
+
+	if duration < 0 {
+		duration = 0
+	}
+
+	return
+}
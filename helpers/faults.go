@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kinds of actors faults and traces can name; a kind stands for every actor of it, "*" for all actors
+const (
+	OrganizationActor        = "org"
+	UserActor                = "user"
+	PeerActor                = "peer"
+	OrdererActor             = "orderer"
+	RevocationAuthorityActor = "revocation-authority"
+	AnyActor                 = "*"
+)
+
+// Byzantine behaviours of a peer
+const (
+	ForgedEndorsement = "forged-endorsement" // endorses with a certificate no organization has issued
+	WrongKey          = "wrong-key"          // signs endorsements with a key other than the certified one
+	TamperedProposal  = "tampered-proposal"  // simulates the proposal on other keys and endorses the outcome
+	Replay            = "replay"             // submits the transactions it commits to the orderers again
+)
+
+// Behaviours lists the Byzantine behaviours
+var Behaviours = []string{ForgedEndorsement, WrongKey, TamperedProposal, Replay}
+
+// MatchActor tells whether an actor (e.g. peer-3) is named by a pattern: the actor itself, its kind or "*"
+func MatchActor(pattern, actor string) bool {
+	if pattern == AnyActor || pattern == actor {
+		return true
+	}
+	kind, _, indexed := splitActor(actor)
+	return indexed && pattern == kind
+}
+
+// splitActor separates the kind and the index of an actor like peer-3
+func splitActor(actor string) (kind string, index int, indexed bool) {
+	dash := strings.LastIndexByte(actor, '-')
+	if dash < 0 {
+		return actor, 0, false
+	}
+	index, e := strconv.Atoi(actor[dash+1:])
+	if e != nil || index < 0 {
+		return actor, 0, false
+	}
+	return actor[:dash], index, true
+}
+
+// checkActorPattern makes sure a pattern names existing actors, given how many there are of each kind
+func checkActorPattern(pattern string, counts map[string]int) error {
+	if pattern == AnyActor || pattern == RevocationAuthorityActor {
+		return nil
+	}
+	if _, exists := counts[pattern]; exists {
+		return nil
+	}
+	kind, index, indexed := splitActor(pattern)
+	if count, exists := counts[kind]; indexed && exists {
+		if index >= count {
+			return fmt.Errorf("there are %d actors of kind %s, got \"%s\"", count, kind, pattern)
+		}
+		return nil
+	}
+	return fmt.Errorf("must be %s, %s-N, %s, %s-N, %s, %s-N, %s or %s, got \"%s\"", UserActor, UserActor, PeerActor, PeerActor, OrdererActor, OrdererActor, RevocationAuthorityActor, AnyActor, pattern)
+}
@@ -98,3 +98,29 @@ func NewRandSeed(seed []byte) (prg *amcl.RAND) {
 
 	return
 }
+
+// SeedFromInt ...
+func SeedFromInt(seed int) []byte {
+	var raw [8]byte
+	binary.BigEndian.PutUint64(raw[:], uint64(seed))
+	return raw[:]
+}
+
+// DeriveSeed walks down the seed hierarchy, e.g. DeriveSeed(master, "user-3")
+func DeriveSeed(seed []byte, labels ...string) (derived []byte) {
+
+	derived = seed
+	for _, label := range labels {
+		input := make([]byte, 0, len(derived)+len(label))
+		input = append(input, derived...)
+		input = append(input, []byte(label)...)
+		derived = Sha3(input)
+	}
+
+	return
+}
+
+// NewRandDerived ...
+func NewRandDerived(seed []byte, labels ...string) (prg *amcl.RAND) {
+	return NewRandSeed(DeriveSeed(seed, labels...))
+}
@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/dbogatov/fabric-amcl/amcl"
+)
+
+// Key access distributions
+const (
+	UniformAccess = "uniform"
+	ZipfAccess    = "zipf"
+	HotspotAccess = "hotspot"
+)
+
+// KeySpace draws the keys a transaction touches; it is read-only once made,
+// so users share it and draw with their own randomness
+type KeySpace struct {
+	keys int
+	cdf  []float64 // cumulative probabilities of keys in order; nil for uniform access
+}
+
+// MakeKeySpace ...
+func MakeKeySpace(access string, keys int, zipf float64, hotKeys int, hotShare float64) (space *KeySpace, e error) {
+
+	space = &KeySpace{keys: keys}
+
+	weights := make([]float64, keys)
+	switch access {
+	case UniformAccess:
+		return
+	case ZipfAccess:
+		for key := range weights {
+			weights[key] = 1 / math.Pow(float64(key+1), zipf)
+		}
+	case HotspotAccess:
+		for key := range weights {
+			if key < hotKeys {
+				weights[key] = hotShare / float64(hotKeys)
+			} else {
+				weights[key] = (1 - hotShare) / float64(keys-hotKeys)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown key access \"%s\", expected %s, %s or %s", access, UniformAccess, ZipfAccess, HotspotAccess)
+	}
+
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	space.cdf = make([]float64, keys)
+	sum := 0.0
+	for key, weight := range weights {
+		sum += weight
+		space.cdf[key] = sum / total
+	}
+
+	return
+}
+
+// Choose draws n distinct keys; n must not exceed the number of keys
+func (space *KeySpace) Choose(prg *amcl.RAND, n int) (keys []string) {
+
+	chosen := make(map[int]bool, n)
+	for len(keys) < n {
+		key := space.draw(prg)
+		if !chosen[key] {
+			chosen[key] = true
+			keys = append(keys, fmt.Sprintf("key-%d", key))
+		}
+	}
+
+	return
+}
+
+func (space *KeySpace) draw(prg *amcl.RAND) int {
+
+	// 53 random bits make a uniform float in [0, 1)
+	uniform := float64(RandomULong(prg)>>11) / (1 << 53)
+
+	if space.cdf == nil {
+		return int(uniform * float64(space.keys))
+	}
+
+	key := sort.SearchFloat64s(space.cdf, uniform)
+	if key == space.keys {
+		key--
+	}
+	return key
+}
@@ -0,0 +1,86 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// BlockHeader chains a block to the previous one
+type BlockHeader struct {
+	Number       int
+	PreviousHash []byte
+	DataHash     []byte
+}
+
+// Hash ...
+func (header BlockHeader) Hash() []byte {
+
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(header.Number))
+	raw = append(raw, header.PreviousHash...)
+	raw = append(raw, header.DataHash...)
+
+	return Sha3(raw)
+}
+
+// DataHash hashes the concatenation of the (already hashed) transactions of a block
+func DataHash(transactions [][]byte) []byte {
+	return Sha3(bytes.Join(transactions, []byte{}))
+}
+
+// Ledger is a peer's hash chain of block headers; it is not safe for concurrent use
+type Ledger struct {
+	headers []BlockHeader
+	bytes   int
+}
+
+// Append adds the next block, refusing one that does not extend the chain
+func (ledger *Ledger) Append(header BlockHeader, size int) (e error) {
+
+	if header.Number != ledger.Height() {
+		return fmt.Errorf("block %d does not follow block %d", header.Number, ledger.Height()-1)
+	}
+	if !bytes.Equal(header.PreviousHash, ledger.Head()) {
+		return fmt.Errorf("block %d does not point to the hash of block %d", header.Number, ledger.Height()-1)
+	}
+
+	ledger.headers = append(ledger.headers, header)
+	ledger.bytes += size
+
+	return
+}
+
+// Height is the number of blocks in the ledger
+func (ledger *Ledger) Height() int {
+	return len(ledger.headers)
+}
+
+// Head is the hash of the last block, or nil for an empty ledger
+func (ledger *Ledger) Head() []byte {
+	if len(ledger.headers) == 0 {
+		return nil
+	}
+	return ledger.headers[len(ledger.headers)-1].Hash()
+}
+
+// Bytes is the total size of the blocks in the ledger
+func (ledger *Ledger) Bytes() int {
+	return ledger.bytes
+}
+
+// Compare reports the first block where two ledgers differ
+func (ledger *Ledger) Compare(other *Ledger) (e error) {
+
+	for number := 0; number < ledger.Height() && number < other.Height(); number++ {
+		if !bytes.Equal(ledger.headers[number].Hash(), other.headers[number].Hash()) {
+			return fmt.Errorf("ledgers diverge at block %d", number)
+		}
+	}
+
+	if ledger.Height() != other.Height() {
+		return fmt.Errorf("ledgers have %d and %d blocks", ledger.Height(), other.Height())
+	}
+
+	return
+}
@@ -0,0 +1,114 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+)
+
+// GlobalLink is the link every message shares without regions
+const GlobalLink = "global"
+
+// Route is how a message travels from one actor to another
+type Route struct {
+	Uplink    int    // B/s of the sender
+	Downlink  int    // B/s of the receiver
+	Link      string // shared by the messages between the same regions
+	Bandwidth int    // B/s of the link
+	Latency   time.Duration
+	Duplex    bool // actors send and receive at once; without regions one local link does both
+}
+
+// Route takes a message through the regions of the actors, or over the global link without regions
+func (sysParams *SystemParameters) Route(from, to string) (route Route) {
+
+	network := sysParams.Network
+	if len(network.Regions) == 0 {
+		return Route{
+			Uplink:    sysParams.BandwidthLocal,
+			Downlink:  sysParams.BandwidthLocal,
+			Link:      GlobalLink,
+			Bandwidth: sysParams.BandwidthGlobal,
+		}
+	}
+
+	source, uplink, _ := sysParams.place(from)
+	destination, _, downlink := sysParams.place(to)
+
+	route = Route{
+		Uplink:   uplink,
+		Downlink: downlink,
+		Duplex:   true,
+	}
+
+	if source == destination {
+		route.Link = source.Name
+		route.Bandwidth = source.Bandwidth
+		route.Latency = time.Duration(source.Latency) * time.Millisecond
+		return
+	}
+
+	for _, link := range network.Links {
+		if (link.From == source.Name && link.To == destination.Name) || (link.From == destination.Name && link.To == source.Name) {
+			route.Link = fmt.Sprintf("%s<->%s", link.From, link.To)
+			route.Bandwidth = link.Bandwidth
+			route.Latency = time.Duration(link.Latency) * time.Millisecond
+			return
+		}
+	}
+
+	panic(fmt.Sprintf("no link between regions %s and %s", source.Name, destination.Name))
+}
+
+// place finds the region of an actor and the bandwidth of its links: users and peers are where their organizations are,
+// unless the placement says otherwise; actors nothing places are in the first region
+func (sysParams *SystemParameters) place(actor string) (region Region, uplink, downlink int) {
+
+	network := sysParams.Network
+
+	org := -1
+	switch kind, index, indexed := splitActor(actor); {
+	case indexed && kind == UserActor:
+		org = sysParams.UserOrganization(index)
+	case indexed && kind == PeerActor:
+		org = sysParams.PeerOrganization(index)
+	case indexed && kind == OrganizationActor:
+		org = index
+	}
+
+	name := network.Regions[0].Name
+	if org >= 0 && org < len(sysParams.Organizations) && sysParams.Organizations[org].Region != "" {
+		name = sysParams.Organizations[org].Region
+	}
+
+	for _, placement := range network.Placement {
+		for _, pattern := range placement.Actors {
+			if places(pattern, actor, org) {
+				name, uplink, downlink = placement.Region, placement.Uplink, placement.Downlink
+				break
+			}
+		}
+	}
+
+	for _, candidate := range network.Regions {
+		if candidate.Name == name {
+			region = candidate
+		}
+	}
+	if uplink == 0 {
+		uplink = region.Uplink
+	}
+	if downlink == 0 {
+		downlink = region.Downlink
+	}
+
+	return
+}
+
+// places tells whether a placement pattern names an actor; an organization stands for its users and peers too
+func places(pattern, actor string, org int) bool {
+	if MatchActor(pattern, actor) {
+		return true
+	}
+	kind, index, indexed := splitActor(pattern)
+	return indexed && kind == OrganizationActor && index == org
+}
@@ -0,0 +1,401 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Roles of an organization principal; every endorser is a peer, so both are satisfied by any peer of the organization
+const (
+	MemberRole = "member"
+	PeerRole   = "peer"
+)
+
+// MaxEndorsements a transaction can carry for its policy to be checked; assignments are bit masks of endorsers
+const MaxEndorsements = 64
+
+// Membership tells which peers an organization owns
+type Membership interface {
+	OrganizationPeers(org int) []int
+	PeerOrganization(peer int) int // -1 if no organization owns the peer
+}
+
+// Identity is what the certificate of an endorser says about it
+type Identity struct {
+	Peer int
+	Org  int
+}
+
+// Principal is either a role of an organization ('org-1.member') or a single peer ('peer-3')
+type Principal struct {
+	Org  int // -1 for a single peer
+	Role string
+	Peer int // -1 for an organization
+}
+
+func (principal Principal) String() string {
+	if principal.Peer >= 0 {
+		return fmt.Sprintf("'peer-%d'", principal.Peer)
+	}
+	return fmt.Sprintf("'org-%d.%s'", principal.Org, principal.Role)
+}
+
+func (principal Principal) matches(identity Identity) bool {
+	if principal.Peer >= 0 {
+		return principal.Peer == identity.Peer
+	}
+	return principal.Org == identity.Org
+}
+
+func (principal Principal) candidates(membership Membership) []int {
+	if principal.Peer >= 0 {
+		return []int{principal.Peer}
+	}
+	return membership.OrganizationPeers(principal.Org)
+}
+
+// Policy is a Fabric signature policy: a principal, or N out of the sub-policies;
+// AND and OR are OutOf with N equal to all and one of the rules
+type Policy struct {
+	N         int
+	Rules     []*Policy
+	Principal *Principal // set for a leaf
+}
+
+// DefaultPolicy is any endorsements out of all peers
+func DefaultPolicy(endorsements, peers int) string {
+	principals := make([]string, 0, peers)
+	for peer := 0; peer < peers; peer++ {
+		principals = append(principals, fmt.Sprintf("'peer-%d'", peer))
+	}
+	return fmt.Sprintf("OutOf(%d, %s)", endorsements, strings.Join(principals, ", "))
+}
+
+func (policy *Policy) String() string {
+	if policy.Principal != nil {
+		return policy.Principal.String()
+	}
+	rules := make([]string, 0, len(policy.Rules))
+	for _, rule := range policy.Rules {
+		rules = append(rules, rule.String())
+	}
+	return fmt.Sprintf("OutOf(%d, %s)", policy.N, strings.Join(rules, ", "))
+}
+
+// Principals lists the leaves of the policy
+func (policy *Policy) Principals() (principals []Principal) {
+	if policy.Principal != nil {
+		return []Principal{*policy.Principal}
+	}
+	for _, rule := range policy.Rules {
+		principals = append(principals, rule.Principals()...)
+	}
+	return
+}
+
+// Endorsers picks distinct peers that satisfy the policy; start rotates the choice
+// among rules and among the peers of an organization, so that clients spread the load
+func (policy *Policy) Endorsers(membership Membership, start int) (endorsers []int, e error) {
+
+	if endorsers = policy.choose(membership, start, nil, func(chosen []int) []int { return chosen }); endorsers == nil {
+		return nil, fmt.Errorf("no set of distinct peers satisfies %s", policy)
+	}
+
+	return
+}
+
+// Alternates picks the fewest peers, neither kept nor excluded, that satisfy the policy together with the kept ones;
+// start rotates the choice like in Endorsers, so that retrying clients spread the load
+func (policy *Policy) Alternates(membership Membership, start int, kept, excluded []int) (alternates []int, e error) {
+
+	candidates := make([]int, 0)
+	for _, principal := range policy.Principals() {
+		for _, peer := range principal.candidates(membership) {
+			if !containsInt(kept, peer) && !containsInt(excluded, peer) && !containsInt(candidates, peer) {
+				candidates = append(candidates, peer)
+			}
+		}
+	}
+	sort.Ints(candidates)
+	rotated := make([]int, len(candidates))
+	for i := range candidates {
+		rotated[i] = candidates[(start+i)%len(candidates)]
+	}
+
+	satisfied := func(added []int) (bool, error) {
+		identities := make([]Identity, 0, len(kept)+len(added))
+		for _, peer := range append(append([]int{}, kept...), added...) {
+			identities = append(identities, Identity{Peer: peer, Org: membership.PeerOrganization(peer)})
+		}
+		return policy.Satisfied(identities)
+	}
+
+	if all, e := satisfied(rotated); e != nil {
+		return nil, e
+	} else if !all {
+		return nil, fmt.Errorf("no peers left to satisfy %s", policy)
+	}
+
+	// subsets of candidates in rotation order, smallest first; the check above bounds the search, and the size of every subset
+	var search func(size, next int, added []int) []int
+	search = func(size, next int, added []int) []int {
+		if len(added) == size {
+			if found, _ := satisfied(added); found {
+				return added
+			}
+			return nil
+		}
+		for i := next; i < len(rotated); i++ {
+			if found := search(size, i+1, append(append([]int{}, added...), rotated[i])); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	for size := 0; size <= len(rotated); size++ {
+		if alternates = search(size, 0, []int{}); alternates != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// choose satisfies the policy with peers not chosen yet, then the rest of the search;
+// it backtracks when the rest fails, so the first assignment in rotation order wins
+func (policy *Policy) choose(membership Membership, start int, chosen []int, rest func(chosen []int) []int) []int {
+
+	if policy.Principal != nil {
+		candidates := policy.Principal.candidates(membership)
+		for i := range candidates {
+			if peer := candidates[(start+i)%len(candidates)]; !containsInt(chosen, peer) {
+				if endorsers := rest(append(append([]int{}, chosen...), peer)); endorsers != nil {
+					return endorsers
+				}
+			}
+		}
+		return nil
+	}
+
+	return policy.chooseRules(membership, start, 0, policy.N, chosen, rest)
+}
+
+func (policy *Policy) chooseRules(membership Membership, start, next, needed int, chosen []int, rest func(chosen []int) []int) []int {
+
+	if needed == 0 {
+		return rest(chosen)
+	}
+	if len(policy.Rules)-next < needed {
+		return nil
+	}
+
+	rule := policy.Rules[(start+next)%len(policy.Rules)]
+	if endorsers := rule.choose(membership, start, chosen, func(chosen []int) []int {
+		return policy.chooseRules(membership, start, next+1, needed-1, chosen, rest)
+	}); endorsers != nil {
+		return endorsers
+	}
+
+	return policy.chooseRules(membership, start, next+1, needed, chosen, rest)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Satisfied checks that the endorsers satisfy the policy, each endorsement counting for a single principal;
+// unlike the greedy Fabric evaluator, it tries every assignment, so the order of endorsements does not matter
+func (policy *Policy) Satisfied(endorsers []Identity) (satisfied bool, e error) {
+
+	if len(endorsers) > MaxEndorsements {
+		return false, fmt.Errorf("%d endorsements are more than the %d that %s can be checked against", len(endorsers), MaxEndorsements, policy)
+	}
+
+	return len(policy.assignments(endorsers, 0)) > 0, nil
+}
+
+// assignments are the sets (bit masks) of endorsers that can satisfy the policy, given the ones already used
+func (policy *Policy) assignments(endorsers []Identity, used uint64) (masks []uint64) {
+
+	if policy.Principal != nil {
+		for i, endorser := range endorsers {
+			if used&(1<<uint(i)) == 0 && policy.Principal.matches(endorser) {
+				masks = append(masks, 1<<uint(i))
+			}
+		}
+		return
+	}
+
+	type partial struct {
+		mask  uint64
+		rules int
+	}
+	partials := map[partial]bool{{mask: 0, rules: 0}: true}
+	found := make(map[uint64]bool)
+
+	for _, rule := range policy.Rules {
+		next := make(map[partial]bool, len(partials))
+		for state := range partials {
+			next[state] = true
+			for _, mask := range rule.assignments(endorsers, used|state.mask) {
+				extended := partial{mask: state.mask | mask, rules: state.rules + 1}
+				if extended.rules == policy.N {
+					found[extended.mask] = true
+				} else {
+					next[extended] = true
+				}
+			}
+		}
+		partials = next
+	}
+
+	for mask := range found {
+		masks = append(masks, mask)
+	}
+
+	return
+}
+
+// ParsePolicy reads the Fabric policy syntax, e.g. OutOf(2, 'org-0.member', AND('org-1.peer', 'peer-4'))
+func ParsePolicy(text string) (policy *Policy, e error) {
+
+	parser := &policyParser{text: text}
+	if policy, e = parser.parse(); e != nil {
+		return nil, fmt.Errorf("policy \"%s\": %v", text, e)
+	}
+	if parser.skipSpaces(); parser.position < len(text) {
+		return nil, fmt.Errorf("policy \"%s\": unexpected \"%s\"", text, text[parser.position:])
+	}
+
+	return
+}
+
+type policyParser struct {
+	text     string
+	position int
+}
+
+func (parser *policyParser) skipSpaces() {
+	for parser.position < len(parser.text) && unicode.IsSpace(rune(parser.text[parser.position])) {
+		parser.position++
+	}
+}
+
+func (parser *policyParser) expect(token byte) (e error) {
+	if parser.skipSpaces(); parser.position >= len(parser.text) || parser.text[parser.position] != token {
+		return fmt.Errorf("expected '%c' at position %d", token, parser.position)
+	}
+	parser.position++
+	return
+}
+
+func (parser *policyParser) word() string {
+	parser.skipSpaces()
+	start := parser.position
+	for parser.position < len(parser.text) {
+		char := rune(parser.text[parser.position])
+		if !unicode.IsLetter(char) && !unicode.IsDigit(char) {
+			break
+		}
+		parser.position++
+	}
+	return parser.text[start:parser.position]
+}
+
+func (parser *policyParser) parse() (policy *Policy, e error) {
+
+	if parser.skipSpaces(); parser.position < len(parser.text) && (parser.text[parser.position] == '\'' || parser.text[parser.position] == '"') {
+		return parser.principal()
+	}
+
+	operator := parser.word()
+	if e = parser.expect('('); e != nil {
+		return
+	}
+
+	policy = &Policy{}
+	if strings.EqualFold(operator, "OutOf") {
+		number := parser.word()
+		if policy.N, e = strconv.Atoi(number); e != nil {
+			return nil, fmt.Errorf("OutOf needs a number first, got \"%s\"", number)
+		}
+		if e = parser.expect(','); e != nil {
+			return
+		}
+	} else if !strings.EqualFold(operator, "AND") && !strings.EqualFold(operator, "OR") {
+		return nil, fmt.Errorf("unknown operator \"%s\", expected AND, OR or OutOf", operator)
+	}
+
+	for {
+		var rule *Policy
+		if rule, e = parser.parse(); e != nil {
+			return
+		}
+		policy.Rules = append(policy.Rules, rule)
+
+		if parser.skipSpaces(); parser.position < len(parser.text) && parser.text[parser.position] == ',' {
+			parser.position++
+			continue
+		}
+		if e = parser.expect(')'); e != nil {
+			return
+		}
+		break
+	}
+
+	switch {
+	case strings.EqualFold(operator, "AND"):
+		policy.N = len(policy.Rules)
+	case strings.EqualFold(operator, "OR"):
+		policy.N = 1
+	}
+	if policy.N < 1 || policy.N > len(policy.Rules) {
+		return nil, fmt.Errorf("OutOf(%d, ...) needs between 1 and %d", policy.N, len(policy.Rules))
+	}
+
+	return
+}
+
+func (parser *policyParser) principal() (policy *Policy, e error) {
+
+	quote := parser.text[parser.position]
+	end := strings.IndexByte(parser.text[parser.position+1:], quote)
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated principal at position %d", parser.position)
+	}
+	name := parser.text[parser.position+1 : parser.position+1+end]
+	parser.position += end + 2
+
+	principal := Principal{Org: -1, Peer: -1}
+	if _, e = fmt.Sscanf(name, "peer-%d", &principal.Peer); e == nil && fmt.Sprintf("peer-%d", principal.Peer) == name {
+		return &Policy{Principal: &principal}, nil
+	}
+
+	principal.Peer = -1
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) == 2 && (parts[1] == MemberRole || parts[1] == PeerRole) {
+		if _, e = fmt.Sscanf(parts[0], "org-%d", &principal.Org); e == nil && fmt.Sprintf("org-%d", principal.Org) == parts[0] {
+			principal.Role = parts[1]
+			return &Policy{Principal: &principal}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("principal '%s' is neither 'org-N.%s', 'org-N.%s' nor 'peer-N'", name, MemberRole, PeerRole)
+}
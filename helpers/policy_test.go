@@ -0,0 +1,207 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// peers 0 and 1 belong to org-0, 2 and 3 to org-1, 4 to org-2
+type testMembership [][]int
+
+func (membership testMembership) OrganizationPeers(org int) []int {
+	if org < 0 || org >= len(membership) {
+		return nil
+	}
+	return membership[org]
+}
+
+func (membership testMembership) PeerOrganization(peer int) int {
+	for org, peers := range membership {
+		if containsInt(peers, peer) {
+			return org
+		}
+	}
+	return -1
+}
+
+var testOrganizations = testMembership{{0, 1}, {2, 3}, {4}}
+
+func mustParsePolicy(t *testing.T, text string) *Policy {
+	t.Helper()
+
+	policy, e := ParsePolicy(text)
+	if e != nil {
+		t.Fatalf("%s: %v", text, e)
+	}
+	return policy
+}
+
+func TestParsePolicy(t *testing.T) {
+
+	tests := []struct {
+		text   string
+		parsed string
+	}{
+		{"'peer-3'", "'peer-3'"},
+		{"AND('org-0.member', 'org-1.peer')", "OutOf(2, 'org-0.member', 'org-1.peer')"},
+		{"OR('peer-1', 'peer-3', 'org-2.member')", "OutOf(1, 'peer-1', 'peer-3', 'org-2.member')"},
+		{"OutOf(2, 'org-0.member', 'org-1.member', 'org-2.member')", "OutOf(2, 'org-0.member', 'org-1.member', 'org-2.member')"},
+		{"OutOf(2, 'org-0.member', AND('org-1.peer', 'peer-4'), 'org-2.member')", "OutOf(2, 'org-0.member', OutOf(2, 'org-1.peer', 'peer-4'), 'org-2.member')"},
+		{" and ( \"org-0.member\" ,'peer-2' ) ", "OutOf(2, 'org-0.member', 'peer-2')"},
+		{"outof(1, or('peer-0'))", "OutOf(1, OutOf(1, 'peer-0'))"},
+	}
+
+	for _, test := range tests {
+		if parsed := mustParsePolicy(t, test.text).String(); parsed != test.parsed {
+			t.Errorf("%s: parsed as %s, expected %s", test.text, parsed, test.parsed)
+		}
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+
+	tests := []struct {
+		text  string
+		error string
+	}{
+		{"", "expected '('"},
+		{"XOR('peer-1', 'peer-2')", "unknown operator \"XOR\""},
+		{"OutOf(two, 'peer-1', 'peer-2')", "OutOf needs a number first"},
+		{"OutOf(2 'peer-1', 'peer-2')", "expected ','"},
+		{"OutOf(0, 'peer-1')", "needs between 1 and 1"},
+		{"OutOf(3, 'peer-1', 'peer-2')", "needs between 1 and 2"},
+		{"AND('peer-1', 'peer-2'", "expected ')'"},
+		{"AND()", "expected '('"},
+		{"AND('peer-1') 'peer-2'", "unexpected \"'peer-2'\""},
+		{"AND('peer-1", "unterminated principal"},
+		{"'org-1.admin'", "principal 'org-1.admin' is neither"},
+		{"'peer-01'", "principal 'peer-01' is neither"},
+		{"'org-x.member'", "principal 'org-x.member' is neither"},
+	}
+
+	for _, test := range tests {
+		policy, e := ParsePolicy(test.text)
+		if e == nil {
+			t.Errorf("%s: parsed as %s, expected an error", test.text, policy)
+			continue
+		}
+		if !strings.Contains(e.Error(), test.error) {
+			t.Errorf("%s: error \"%v\" does not mention \"%s\"", test.text, e, test.error)
+		}
+	}
+}
+
+func TestSatisfied(t *testing.T) {
+
+	peer := func(peer int) Identity {
+		return Identity{Peer: peer, Org: testOrganizations.PeerOrganization(peer)}
+	}
+
+	tests := []struct {
+		policy    string
+		endorsers []Identity
+		satisfied bool
+	}{
+		{"AND('org-0.member', 'org-1.member')", []Identity{peer(0), peer(2)}, true},
+		{"AND('org-0.member', 'org-1.member')", []Identity{peer(0), peer(1)}, false},
+		{"AND('org-0.member', 'org-1.member')", []Identity{peer(3), peer(4), peer(1)}, true},
+		{"OR('org-0.member', 'org-1.member')", []Identity{peer(4)}, false},
+		{"OR('org-0.member', 'org-1.member')", []Identity{peer(4), peer(3)}, true},
+		{"OR('peer-3')", []Identity{}, false},
+		{"OutOf(2, 'org-0.member', 'org-1.member', 'org-2.member')", []Identity{peer(1), peer(4)}, true},
+		{"OutOf(2, 'org-0.member', 'org-1.member', 'org-2.member')", []Identity{peer(2), peer(3)}, false},
+
+		// an endorsement counts for a single principal
+		{"AND('org-0.member', 'peer-1')", []Identity{peer(1)}, false},
+		{"AND('org-0.member', 'peer-1')", []Identity{peer(0), peer(1)}, true},
+
+		// in any order, unlike the greedy Fabric evaluator
+		{"AND('org-0.member', 'peer-1')", []Identity{peer(1), peer(0)}, true},
+		{"OutOf(2, AND('org-0.member', 'org-1.member'), 'peer-2', 'peer-0')", []Identity{peer(0), peer(2), peer(1), peer(3)}, true},
+		{"OutOf(2, AND('org-0.member', 'org-1.member'), 'peer-2', 'peer-0')", []Identity{peer(0), peer(2)}, true},
+		{"OutOf(3, AND('org-0.member', 'org-1.member'), 'peer-2', 'peer-0')", []Identity{peer(0), peer(2), peer(1)}, false},
+	}
+
+	for _, test := range tests {
+		satisfied, e := mustParsePolicy(t, test.policy).Satisfied(test.endorsers)
+		if e != nil {
+			t.Errorf("%s by %v: %v", test.policy, test.endorsers, e)
+			continue
+		}
+		if satisfied != test.satisfied {
+			t.Errorf("%s by %v: satisfied is %v, expected %v", test.policy, test.endorsers, satisfied, test.satisfied)
+		}
+	}
+}
+
+func TestSatisfiedTooManyEndorsements(t *testing.T) {
+
+	endorsers := make([]Identity, MaxEndorsements+1)
+	for i := range endorsers {
+		endorsers[i] = Identity{Peer: i, Org: -1}
+	}
+
+	policy := mustParsePolicy(t, "OR('peer-0')")
+	if _, e := policy.Satisfied(endorsers[:MaxEndorsements]); e != nil {
+		t.Errorf("%d endorsements: %v", MaxEndorsements, e)
+	}
+	if satisfied, e := policy.Satisfied(endorsers); e == nil {
+		t.Errorf("%d endorsements: satisfied is %v, expected an error", len(endorsers), satisfied)
+	}
+}
+
+func TestAlternates(t *testing.T) {
+
+	tests := []struct {
+		policy     string
+		start      int
+		kept       []int
+		excluded   []int
+		alternates []int
+	}{
+		// nothing is missing
+		{"AND('org-0.member', 'org-1.member')", 0, []int{1, 2}, []int{}, []int{}},
+
+		// the fewest peers, first in rotation order
+		{"OutOf(2, 'peer-0', 'peer-1', 'peer-2', 'peer-3')", 0, []int{0}, []int{1}, []int{2}},
+		{"OutOf(2, 'peer-0', 'peer-1', 'peer-2', 'peer-3')", 1, []int{0}, []int{1}, []int{3}},
+		{"AND('org-0.member', 'org-1.member')", 0, []int{}, []int{0}, []int{1, 2}},
+		{"AND('org-0.member', 'org-1.member')", 0, []int{3}, []int{0}, []int{1}},
+		{"OR(AND('org-0.member', 'org-1.member', 'org-2.member'), 'peer-3')", 0, []int{}, []int{}, []int{3}},
+		{"OR(AND('org-0.member', 'org-1.member', 'org-2.member'), 'peer-3')", 0, []int{}, []int{3}, []int{0, 2, 4}},
+
+		// kept peers are not picked again, even if they could count for another principal
+		{"AND('org-0.member', 'peer-1')", 0, []int{1}, []int{}, []int{0}},
+	}
+
+	for _, test := range tests {
+		alternates, e := mustParsePolicy(t, test.policy).Alternates(testOrganizations, test.start, test.kept, test.excluded)
+		if e != nil {
+			t.Errorf("%s keeping %v without %v: %v", test.policy, test.kept, test.excluded, e)
+			continue
+		}
+		if fmt.Sprint(alternates) != fmt.Sprint(test.alternates) {
+			t.Errorf("%s keeping %v without %v: alternates are %v, expected %v", test.policy, test.kept, test.excluded, alternates, test.alternates)
+		}
+	}
+}
+
+func TestAlternatesErrors(t *testing.T) {
+
+	tests := []struct {
+		policy   string
+		kept     []int
+		excluded []int
+	}{
+		{"AND('peer-0', 'peer-1')", []int{0}, []int{1}},
+		{"AND('org-0.member', 'org-1.member')", []int{}, []int{2, 3}},
+		{"OutOf(2, 'org-2.member', 'peer-4')", []int{}, []int{}},
+	}
+
+	for _, test := range tests {
+		if alternates, e := mustParsePolicy(t, test.policy).Alternates(testOrganizations, 0, test.kept, test.excluded); e == nil {
+			t.Errorf("%s keeping %v without %v: alternates are %v, expected an error", test.policy, test.kept, test.excluded, alternates)
+		}
+	}
+}
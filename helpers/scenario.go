@@ -0,0 +1,1027 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Scenario is the declarative description of a simulated network.
+// Command line defaults fill in the fields the file leaves out; a zero it sets is kept.
+type Scenario struct {
+	Seed        int                 `yaml:"seed" json:"seed"`
+	Topology    TopologyScenario    `yaml:"topology" json:"topology"`
+	Workload    WorkloadScenario    `yaml:"workload" json:"workload"`
+	Ordering    OrderingScenario    `yaml:"ordering" json:"ordering"`
+	Bandwidth   BandwidthScenario   `yaml:"bandwidth" json:"bandwidth"`
+	Network     NetworkScenario     `yaml:"network" json:"network"`
+	Gossip      GossipScenario      `yaml:"gossip" json:"gossip"`
+	Faults      FaultScenario       `yaml:"faults" json:"faults"`
+	Byzantine   []ByzantinePeer     `yaml:"byzantine" json:"byzantine"`
+	Client      ClientScenario      `yaml:"client" json:"client"`
+	Hardware    HardwareScenario    `yaml:"hardware" json:"hardware"`
+	Concurrency ConcurrencyScenario `yaml:"concurrency" json:"concurrency"`
+	Revocation  RevocationScenario  `yaml:"revocation" json:"revocation"`
+	Audit       AuditScenario       `yaml:"audit" json:"audit"`
+	Crypto      CryptoScenario      `yaml:"crypto" json:"crypto"`
+	RPC         RPCScenario         `yaml:"rpc" json:"rpc"`
+
+	present map[string]bool // dotted paths of the fields the file sets
+}
+
+// TopologyScenario is either uniform (orgs, users per org, total peers)
+// or an explicit list of organizations
+type TopologyScenario struct {
+	Orgs          int                    `yaml:"orgs" json:"orgs"`
+	Users         int                    `yaml:"users" json:"users"` // per organization
+	Peers         int                    `yaml:"peers" json:"peers"` // total
+	Organizations []OrganizationScenario `yaml:"organizations" json:"organizations"`
+}
+
+// OrganizationScenario ...
+type OrganizationScenario struct {
+	Users    int                         `yaml:"users" json:"users"` // of the default class, or the sum of the classes
+	Peers    int                         `yaml:"peers" json:"peers"`
+	Arrivals *ArrivalScenario            `yaml:"arrivals" json:"arrivals"` // the users of the organization share their own pattern if set
+	Classes  []OrganizationClassScenario `yaml:"classes" json:"classes"`   // users by class, numbered in this order
+	Region   string                      `yaml:"region" json:"region"`     // of the organization, its users and peers; one of network.regions
+}
+
+// OrganizationClassScenario is how many users of a class an organization has
+type OrganizationClassScenario struct {
+	Class string `yaml:"class" json:"class"` // one of workload.classes
+	Users int    `yaml:"users" json:"users"`
+}
+
+// WorkloadScenario ...
+type WorkloadScenario struct {
+	Transactions int  `yaml:"transactions" json:"transactions"` // per user
+	Frequency    *int `yaml:"frequency" json:"frequency"`       // seconds; 0 submits without waiting
+	Endorsements int  `yaml:"endorsements" json:"endorsements"`
+
+	Arrivals ArrivalScenario `yaml:"arrivals" json:"arrivals"` // of the users of organizations without their own
+
+	// key contention
+	Keys     int     `yaml:"keys" json:"keys"`
+	Reads    int     `yaml:"reads" json:"reads"`   // keys read per transaction
+	Writes   int     `yaml:"writes" json:"writes"` // keys written per transaction, the first ones read
+	Access   string  `yaml:"access" json:"access"` // uniform, zipf or hotspot
+	Zipf     float64 `yaml:"zipf" json:"zipf"`     // exponent
+	HotKeys  int     `yaml:"hot-keys" json:"hot-keys"`
+	HotShare float64 `yaml:"hot-share" json:"hot-share"` // of accesses that go to the hot keys
+
+	Chaincodes []ChaincodeScenario `yaml:"chaincodes" json:"chaincodes"`
+
+	Classes []ClassScenario `yaml:"classes" json:"classes"` // of users; the users organizations do not assign a class have the settings above
+}
+
+// ClassScenario is a kind of users with a workload of its own, e.g. few heavy clients next to many light ones
+type ClassScenario struct {
+	Name         string           `yaml:"name" json:"name"`
+	Transactions int              `yaml:"transactions" json:"transactions"` // per user; workload.transactions if not set
+	Arrivals     *ArrivalScenario `yaml:"arrivals" json:"arrivals"`         // shared by the users of the class in all organizations if set
+	Mix          map[string]int   `yaml:"mix" json:"mix"`                   // chaincode weights by name; those of workload.chaincodes if not set
+	Revocation   *bool            `yaml:"revocation" json:"revocation"`     // whether the users prove non-revocation; revocation.enabled if not set
+}
+
+// ArrivalScenario is how transactions arrive; closed loops of users by default
+type ArrivalScenario struct {
+	Pattern   string  `yaml:"pattern" json:"pattern"`     // closed, open, bursty, diurnal or trace
+	Frequency int     `yaml:"frequency" json:"frequency"` // seconds a closed-loop user thinks; workload.frequency if not set
+	Rate      float64 `yaml:"rate" json:"rate"`           // transactions per second over the users of the pattern
+	On        int     `yaml:"on" json:"on"`               // ms of a burst
+	Off       int     `yaml:"off" json:"off"`             // ms between bursts
+	Period    int     `yaml:"period" json:"period"`       // ms of a diurnal cycle; a day if not set
+	Amplitude float64 `yaml:"amplitude" json:"amplitude"` // of the diurnal rate relative to the mean, 0 to 1
+	Peak      int     `yaml:"peak" json:"peak"`           // ms into the period, when the diurnal rate is highest
+	Times     []int   `yaml:"times" json:"times"`         // ms since the start of the workload, one per transaction
+	File      string  `yaml:"file" json:"file"`           // CSV or JSON trace to replay instead of the times
+}
+
+// ChaincodeScenario is one of the chaincodes the workload invokes
+type ChaincodeScenario struct {
+	Name   string       `yaml:"name" json:"name"`
+	Weight int          `yaml:"weight" json:"weight"` // relative share of transactions; 1 if not set
+	Cost   CostScenario `yaml:"cost" json:"cost"`
+	Policy string       `yaml:"policy" json:"policy"` // e.g. AND('org-0.member', OR('org-1.peer', 'org-2.peer')); any endorsements peers if not set
+}
+
+// CostScenario is the distribution of a chaincode execution time
+type CostScenario struct {
+	Distribution string               `yaml:"distribution" json:"distribution"` // constant if not set
+	Mean         int                  `yaml:"mean" json:"mean"`                 // ms
+	StdDev       int                  `yaml:"stddev" json:"stddev"`             // ms
+	Percentiles  []PercentileScenario `yaml:"percentiles" json:"percentiles"`   // for the empirical distribution
+}
+
+// PercentileScenario ...
+type PercentileScenario struct {
+	Percentile float64 `yaml:"percentile" json:"percentile"`
+	Duration   int     `yaml:"duration" json:"duration"` // ms
+}
+
+// OrderingScenario ...
+type OrderingScenario struct {
+	Orderers      int `yaml:"orderers" json:"orderers"`
+	BatchSize     int `yaml:"batch-size" json:"batch-size"`       // max transactions per block
+	BatchTimeout  int `yaml:"batch-timeout" json:"batch-timeout"` // ms
+	MaxBlockBytes int `yaml:"max-block-bytes" json:"max-block-bytes"`
+
+	// Raft
+	Tick           int            `yaml:"tick" json:"tick"` // ms
+	ElectionTicks  int            `yaml:"election-ticks" json:"election-ticks"`
+	HeartbeatTicks int            `yaml:"heartbeat-ticks" json:"heartbeat-ticks"`
+	Crashes        []OrdererCrash `yaml:"crashes" json:"crashes"`
+}
+
+// OrdererCrash takes an orderer down for a while; with Leader set, whichever orderer leads at the time
+type OrdererCrash struct {
+	Orderer  int  `yaml:"orderer" json:"orderer"`
+	Leader   bool `yaml:"leader" json:"leader"`
+	At       int  `yaml:"at" json:"at"`             // ms since the start
+	Downtime int  `yaml:"downtime" json:"downtime"` // ms
+}
+
+// BandwidthScenario ...
+type BandwidthScenario struct {
+	Global int `yaml:"global" json:"global"` // B/s
+	Local  int `yaml:"local" json:"local"`   // B/s
+}
+
+// NetworkScenario places actors in regions: a message goes through the uplink of the sender, the link between
+// the regions and the downlink of the receiver, then takes the latency between the regions to arrive.
+// Without regions, actors send and receive over one local link each and share the global one, without latency.
+type NetworkScenario struct {
+	Regions   []Region     `yaml:"regions" json:"regions"` // actors nothing places are in the first one
+	Links     []RegionLink `yaml:"links" json:"links"`     // between every two regions, both ways
+	Placement []Placement  `yaml:"placement" json:"placement"`
+}
+
+// Region is a data center or a continent
+type Region struct {
+	Name      string `yaml:"name" json:"name"`
+	Latency   int    `yaml:"latency" json:"latency"`     // ms one way between actors of the region
+	Bandwidth int    `yaml:"bandwidth" json:"bandwidth"` // B/s shared by the messages within the region; bandwidth.global if not set
+	Uplink    int    `yaml:"uplink" json:"uplink"`       // B/s of an actor of the region; bandwidth.local if not set
+	Downlink  int    `yaml:"downlink" json:"downlink"`   // B/s of an actor of the region; bandwidth.local if not set
+}
+
+// RegionLink connects two regions
+type RegionLink struct {
+	From      string `yaml:"from" json:"from"`
+	To        string `yaml:"to" json:"to"`
+	Latency   int    `yaml:"latency" json:"latency"`     // ms one way
+	Bandwidth int    `yaml:"bandwidth" json:"bandwidth"` // B/s shared by the messages both ways; bandwidth.global if not set
+}
+
+// Placement puts actors in a region; later entries override earlier ones and the regions of organizations
+type Placement struct {
+	Actors   []string `yaml:"actors" json:"actors"` // actors (peer-3), kinds (peer), organizations (org-1) or "*"
+	Region   string   `yaml:"region" json:"region"`
+	Uplink   int      `yaml:"uplink" json:"uplink"`     // B/s of each actor; that of the region if not set
+	Downlink int      `yaml:"downlink" json:"downlink"` // B/s of each actor; that of the region if not set
+}
+
+// GossipScenario makes one leader peer per organization pull blocks from the orderers
+// and push them to the other peers of the organization, which also pull what they missed
+type GossipScenario struct {
+	Enabled      bool `yaml:"enabled" json:"enabled"`
+	Fanout       int  `yaml:"fanout" json:"fanout"`               // peers a block is pushed to by each peer that receives it first
+	PullInterval int  `yaml:"pull-interval" json:"pull-interval"` // ms between anti-entropy pulls
+}
+
+// ClientScenario is how users collect endorsements, like the Fabric SDK:
+// a request that times out is retried with other peers that still satisfy the policy
+type ClientScenario struct {
+	EndorsementTimeout int `yaml:"endorsement-timeout" json:"endorsement-timeout"` // ms
+	Attempts           int `yaml:"attempts" json:"attempts"`                       // endorsement requests per transaction, the first ones included
+}
+
+// FaultScenario injects failures of peers, the revocation authority and the links between actors;
+// orderer crashes are part of the ordering scenario
+type FaultScenario struct {
+	Timeout    int              `yaml:"timeout" json:"timeout"` // ms a user waits for a non-revocation handle or the commits before it gives the transaction up
+	Crashes    []CrashFault     `yaml:"crashes" json:"crashes"`
+	Links      []LinkFault      `yaml:"links" json:"links"`
+	Partitions []PartitionFault `yaml:"partitions" json:"partitions"`
+}
+
+// CrashFault takes a peer or the revocation authority down for a while
+type CrashFault struct {
+	Actor    string `yaml:"actor" json:"actor"`       // peer-N or revocation-authority
+	At       int    `yaml:"at" json:"at"`             // ms since the start
+	Downtime int    `yaml:"downtime" json:"downtime"` // ms
+}
+
+// LinkFault drops or delays messages between actors; From and To are actors (peer-3), kinds (peer) or "*"
+type LinkFault struct {
+	From     string  `yaml:"from" json:"from"`
+	To       string  `yaml:"to" json:"to"`
+	Loss     float64 `yaml:"loss" json:"loss"`         // fraction of messages dropped
+	Delay    int     `yaml:"delay" json:"delay"`       // ms added to every message
+	At       int     `yaml:"at" json:"at"`             // ms since the start
+	Duration int     `yaml:"duration" json:"duration"` // ms; until the end if not set
+}
+
+// PartitionFault cuts the actors off from all the others for a while
+type PartitionFault struct {
+	Actors   []string `yaml:"actors" json:"actors"` // actors (peer-3), kinds (peer) or "*"
+	At       int      `yaml:"at" json:"at"`         // ms since the start
+	Duration int      `yaml:"duration" json:"duration"`
+}
+
+// ByzantinePeer makes a peer misbehave on a share of the transactions it endorses or commits
+type ByzantinePeer struct {
+	Peer      int     `yaml:"peer" json:"peer"`
+	Behaviour string  `yaml:"behaviour" json:"behaviour"`
+	Share     float64 `yaml:"share" json:"share"` // all transactions if not set
+}
+
+// HardwareScenario gives peers CPUs and memory of their own; peers without a profile
+// run at the speed of the host with the limits of the concurrency section
+type HardwareScenario struct {
+	Profiles []HardwareProfile `yaml:"profiles" json:"profiles"`
+	Default  string            `yaml:"default" json:"default"` // profile of the peers not listed
+	Peers    []PeerHardware    `yaml:"peers" json:"peers"`
+}
+
+// HardwareProfile is a kind of machine a peer runs on
+type HardwareProfile struct {
+	Name   string  `yaml:"name" json:"name"`
+	Cores  int     `yaml:"cores" json:"cores"`   // shared by endorsements and validations
+	Speed  float64 `yaml:"speed" json:"speed"`   // of a core relative to the host the costs are measured on; 1 if not set
+	Memory int     `yaml:"memory" json:"memory"` // MB for the caches of verified identities and certificates; unlimited if not set
+}
+
+// PeerHardware puts a peer on a profile
+type PeerHardware struct {
+	Peer    int    `yaml:"peer" json:"peer"`
+	Profile string `yaml:"profile" json:"profile"`
+}
+
+// ConcurrencyScenario ...
+type ConcurrencyScenario struct {
+	Endorsements int `yaml:"endorsements" json:"endorsements"`
+	Validations  int `yaml:"validations" json:"validations"`
+	Revocations  int `yaml:"revocations" json:"revocations"`
+}
+
+// RevocationScenario ...
+type RevocationScenario struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	Epoch   int  `yaml:"epoch" json:"epoch"` // seconds
+}
+
+// AuditScenario ...
+type AuditScenario struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+}
+
+// CryptoScenario ...
+type CryptoScenario struct {
+	MSP         string `yaml:"msp" json:"msp"` // idemix or x509
+	CostModel   bool   `yaml:"cost-model" json:"cost-model"`
+	CostProfile string `yaml:"cost-profile" json:"cost-profile"`
+}
+
+// RPCScenario ...
+type RPCScenario struct {
+	Port         int      `yaml:"port" json:"port"`
+	Root         string   `yaml:"root" json:"root"`
+	Organization string   `yaml:"organization" json:"organization"`
+	Revocation   string   `yaml:"revocation" json:"revocation"`
+	Peers        []string `yaml:"peers" json:"peers"`
+}
+
+// LoadScenario reads a YAML or JSON (by extension) scenario; unknown fields are errors
+func LoadScenario(path string) (scenario *Scenario, e error) {
+
+	raw, e := ioutil.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+
+	scenario = &Scenario{present: make(map[string]bool)}
+
+	// decoded once more as a tree, to tell a zero the file sets from a missing field
+	var tree interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if e = decoder.Decode(scenario); e == nil {
+			e = json.Unmarshal(raw, &tree)
+		}
+	case ".yaml", ".yml":
+		if e = yaml.UnmarshalStrict(raw, scenario); e == nil {
+			e = yaml.Unmarshal(raw, &tree)
+		}
+	default:
+		return nil, fmt.Errorf("scenario %s: unknown format, expected .yaml, .yml or .json", path)
+	}
+
+	if e != nil {
+		return nil, fmt.Errorf("scenario %s: %v", path, e)
+	}
+
+	scenario.markPresent(tree, "")
+
+	return
+}
+
+// markPresent records the dotted paths of the sections and fields of a decoded tree
+func (scenario *Scenario) markPresent(node interface{}, prefix string) {
+
+	mark := func(key interface{}, child interface{}) {
+		path := fmt.Sprint(key)
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		scenario.present[path] = true
+		scenario.markPresent(child, path)
+	}
+
+	switch node := node.(type) {
+	case map[interface{}]interface{}: // YAML
+		for key, child := range node {
+			mark(key, child)
+		}
+	case map[string]interface{}: // JSON
+		for key, child := range node {
+			mark(key, child)
+		}
+	}
+}
+
+// Sets tells whether the file the scenario is loaded from sets the field at a dotted path
+// (e.g. "workload.reads"), even to a zero value
+func (scenario *Scenario) Sets(path string) bool {
+	return scenario.present[path]
+}
+
+// Override returns a copy of the scenario with the field at a dotted path
+// (e.g. "workload.endorsements") set to a YAML value
+func (scenario *Scenario) Override(path, value string) (overridden *Scenario, e error) {
+
+	raw, e := yaml.Marshal(scenario)
+	if e != nil {
+		return
+	}
+
+	tree := make(map[interface{}]interface{})
+	if e = yaml.Unmarshal(raw, &tree); e != nil {
+		return
+	}
+
+	var parsed interface{}
+	if e = yaml.Unmarshal([]byte(value), &parsed); e != nil {
+		return nil, fmt.Errorf("%s: cannot parse value \"%s\": %v", path, value, e)
+	}
+
+	keys := strings.Split(path, ".")
+	node := tree
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := node[key].(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: \"%s\" is not a section of the scenario", path, key)
+		}
+		node = child
+	}
+	if _, exists := node[keys[len(keys)-1]]; !exists {
+		return nil, fmt.Errorf("%s: \"%s\" is not a field of the scenario", path, keys[len(keys)-1])
+	}
+	node[keys[len(keys)-1]] = parsed
+
+	if raw, e = yaml.Marshal(tree); e != nil {
+		return
+	}
+
+	overridden = &Scenario{present: make(map[string]bool)}
+	if e = yaml.UnmarshalStrict(raw, overridden); e != nil {
+		return nil, fmt.Errorf("%s: %v", path, e)
+	}
+	for set := range scenario.present {
+		overridden.present[set] = true
+	}
+	for i := range keys {
+		overridden.present[strings.Join(keys[:i+1], ".")] = true
+	}
+
+	return
+}
+
+// SetUniformTopology replaces the list of organizations (if any) with equal ones
+func (scenario *Scenario) SetUniformTopology(orgs, users, peers int) {
+	scenario.Topology = TopologyScenario{
+		Orgs:  orgs,
+		Users: users,
+		Peers: peers,
+	}
+}
+
+// OrganizationParameters expands the topology into one entry per organization;
+// in a uniform topology peers are dealt to organizations round-robin
+func (scenario *Scenario) OrganizationParameters() (organizations []OrganizationParameters) {
+
+	topology := scenario.Topology
+
+	if len(topology.Organizations) > 0 {
+		for _, org := range topology.Organizations {
+			parameters := OrganizationParameters{
+				Users:  org.Users,
+				Peers:  org.Peers,
+				Region: org.Region,
+			}
+			if org.Arrivals != nil {
+				arrivals := scenario.ArrivalParameters(*org.Arrivals)
+				parameters.Arrivals = &arrivals
+			}
+			if len(org.Classes) > 0 {
+				parameters.Users = 0
+				for _, class := range org.Classes {
+					parameters.Classes = append(parameters.Classes, ClassUsers{Class: class.Class, Users: class.Users})
+					parameters.Users += class.Users
+				}
+			}
+			organizations = append(organizations, parameters)
+		}
+		return
+	}
+
+	for org := 0; org < topology.Orgs; org++ {
+		peers := topology.Peers / topology.Orgs
+		if org < topology.Peers%topology.Orgs {
+			peers++
+		}
+		organizations = append(organizations, OrganizationParameters{
+			Users: topology.Users,
+			Peers: peers,
+		})
+	}
+
+	return
+}
+
+// ArrivalParameters fills in the defaults of an arrival pattern
+func (scenario *Scenario) ArrivalParameters(arrivals ArrivalScenario) (parameters ArrivalParameters) {
+
+	milliseconds := func(value int) time.Duration {
+		return time.Duration(value) * time.Millisecond
+	}
+
+	parameters = ArrivalParameters{
+		Pattern:   arrivals.Pattern,
+		Frequency: arrivals.Frequency,
+		Rate:      arrivals.Rate,
+		On:        milliseconds(arrivals.On),
+		Off:       milliseconds(arrivals.Off),
+		Period:    milliseconds(arrivals.Period),
+		Amplitude: arrivals.Amplitude,
+		Peak:      milliseconds(arrivals.Peak),
+	}
+	if parameters.Pattern == "" {
+		parameters.Pattern = ClosedArrivals
+	}
+	if parameters.Frequency == 0 && scenario.Workload.Frequency != nil {
+		parameters.Frequency = *scenario.Workload.Frequency
+	}
+	if parameters.Period == 0 {
+		parameters.Period = DefaultDiurnalPeriod
+	}
+	for _, at := range arrivals.Times {
+		parameters.Trace = append(parameters.Trace, TraceRecord{Arrival: Arrival{At: milliseconds(at)}})
+	}
+	parameters.TraceFile = arrivals.File
+
+	return
+}
+
+// ClassParameters converts the classes of users, filling in the defaults from the workload
+func (scenario *Scenario) ClassParameters() (classes []ClassParameters) {
+
+	for _, class := range scenario.Workload.Classes {
+		parameters := ClassParameters{
+			Name:         class.Name,
+			Transactions: class.Transactions,
+			Mix:          class.Mix,
+			Revoke:       scenario.Revocation.Enabled,
+		}
+		if parameters.Transactions == 0 {
+			parameters.Transactions = scenario.Workload.Transactions
+		}
+		if class.Arrivals != nil {
+			arrivals := scenario.ArrivalParameters(*class.Arrivals)
+			parameters.Arrivals = &arrivals
+		}
+		if class.Revocation != nil {
+			parameters.Revoke = *class.Revocation
+		}
+		classes = append(classes, parameters)
+	}
+
+	return
+}
+
+// ByzantinePeers are the misbehaving peers, a share of all transactions if not set
+func (scenario *Scenario) ByzantinePeers() (peers []ByzantinePeer) {
+
+	for _, peer := range scenario.Byzantine {
+		if peer.Share == 0 {
+			peer.Share = 1
+		}
+		peers = append(peers, peer)
+	}
+
+	return
+}
+
+// NetworkParameters fills in the bandwidth of regions and links from the global and local ones
+func (scenario *Scenario) NetworkParameters() (network NetworkScenario) {
+
+	orDefault := func(value, fallback int) int {
+		if value == 0 {
+			return fallback
+		}
+		return value
+	}
+
+	network = scenario.Network
+	network.Regions = make([]Region, 0, len(scenario.Network.Regions))
+	for _, region := range scenario.Network.Regions {
+		region.Bandwidth = orDefault(region.Bandwidth, scenario.Bandwidth.Global)
+		region.Uplink = orDefault(region.Uplink, scenario.Bandwidth.Local)
+		region.Downlink = orDefault(region.Downlink, scenario.Bandwidth.Local)
+		network.Regions = append(network.Regions, region)
+	}
+	network.Links = make([]RegionLink, 0, len(scenario.Network.Links))
+	for _, link := range scenario.Network.Links {
+		link.Bandwidth = orDefault(link.Bandwidth, scenario.Bandwidth.Global)
+		network.Links = append(network.Links, link)
+	}
+
+	return
+}
+
+// HardwareParameters fills in the defaults of the hardware profiles
+func (scenario *Scenario) HardwareParameters() (hardware HardwareScenario) {
+
+	hardware = scenario.Hardware
+	hardware.Profiles = make([]HardwareProfile, 0, len(scenario.Hardware.Profiles))
+	for _, profile := range scenario.Hardware.Profiles {
+		if profile.Speed == 0 {
+			profile.Speed = 1
+		}
+		hardware.Profiles = append(hardware.Profiles, profile)
+	}
+
+	return
+}
+
+// ChaincodeParameters converts the chaincodes of the workload, filling in the defaults
+func (scenario *Scenario) ChaincodeParameters() (chaincodes []ChaincodeParameters) {
+
+	for _, chaincode := range scenario.Workload.Chaincodes {
+		parameters := ChaincodeParameters{
+			Name:   chaincode.Name,
+			Weight: chaincode.Weight,
+			Policy: chaincode.Policy,
+			Cost: DurationDistribution{
+				Distribution: chaincode.Cost.Distribution,
+				Mean:         time.Duration(chaincode.Cost.Mean) * time.Millisecond,
+				StdDev:       time.Duration(chaincode.Cost.StdDev) * time.Millisecond,
+			},
+		}
+		if parameters.Weight == 0 {
+			parameters.Weight = 1
+		}
+		if parameters.Cost.Distribution == "" {
+			parameters.Cost.Distribution = ConstantDistribution
+		}
+		for _, percentile := range chaincode.Cost.Percentiles {
+			parameters.Cost.Percentiles = append(parameters.Cost.Percentiles, Percentile{
+				Percentile: percentile.Percentile,
+				Duration:   time.Duration(percentile.Duration) * time.Millisecond,
+			})
+		}
+		chaincodes = append(chaincodes, parameters)
+	}
+
+	return
+}
+
+// Validate reports all problems at once, each prefixed with the offending field;
+// ordering, bandwidth, concurrency and crypto sections are only checked for simulated runs
+func (scenario *Scenario) Validate(simulated bool) (e error) {
+
+	problems := make([]string, 0)
+
+	check := func(ok bool, field, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	positive := func(value int, field string) {
+		check(value > 0, field, "must be positive, got %d", value)
+	}
+
+	topology := scenario.Topology
+	if len(topology.Organizations) > 0 {
+		check(topology.Orgs == 0 || topology.Orgs == len(topology.Organizations), "topology.orgs", "is %d, but %d organizations are listed", topology.Orgs, len(topology.Organizations))
+		check(topology.Users == 0, "topology.users", "cannot be combined with topology.organizations")
+		check(topology.Peers == 0, "topology.peers", "cannot be combined with topology.organizations")
+
+		classes := make(map[string]bool)
+		for _, class := range scenario.Workload.Classes {
+			classes[class.Name] = true
+		}
+
+		peers := 0
+		for i, org := range topology.Organizations {
+			if len(org.Classes) > 0 {
+				users := 0
+				for j, class := range org.Classes {
+					field := fmt.Sprintf("topology.organizations[%d].classes[%d]", i, j)
+					check(classes[class.Class], field+".class", "class \"%s\" is not in workload.classes", class.Class)
+					positive(class.Users, field+".users")
+					users += class.Users
+				}
+				check(org.Users == 0 || org.Users == users, fmt.Sprintf("topology.organizations[%d].users", i), "is %d, but the classes have %d users", org.Users, users)
+			} else {
+				positive(org.Users, fmt.Sprintf("topology.organizations[%d].users", i))
+			}
+			check(org.Peers >= 0, fmt.Sprintf("topology.organizations[%d].peers", i), "must not be negative, got %d", org.Peers)
+			if org.Arrivals != nil {
+				field := fmt.Sprintf("topology.organizations[%d].arrivals", i)
+				checkArrivals(*org.Arrivals, field, check)
+				check(org.Arrivals.File == "", field+".file", "a trace file drives every user, set it in workload.arrivals")
+				check(scenario.Workload.Arrivals.File == "", field, "cannot be combined with the trace file of workload.arrivals")
+			}
+			peers += org.Peers
+		}
+		check(peers > 0, "topology.organizations", "at least one organization must have peers")
+	} else {
+		positive(topology.Orgs, "topology.orgs")
+		positive(topology.Users, "topology.users")
+		positive(topology.Peers, "topology.peers")
+	}
+
+	peers, users := 0, 0
+	for _, org := range scenario.OrganizationParameters() {
+		peers += org.Peers
+		users += org.Users
+	}
+
+	positive(scenario.Workload.Transactions, "workload.transactions")
+	if scenario.Workload.Frequency != nil {
+		check(*scenario.Workload.Frequency >= 0, "workload.frequency", "must not be negative, got %d", *scenario.Workload.Frequency)
+	}
+	positive(scenario.Workload.Endorsements, "workload.endorsements")
+	check(scenario.Workload.Endorsements <= peers, "workload.endorsements", "%d endorsements need at least as many peers, got %d", scenario.Workload.Endorsements, peers)
+	checkArrivals(scenario.Workload.Arrivals, "workload.arrivals", check)
+
+	workload := scenario.Workload
+	positive(workload.Keys, "workload.keys")
+	check(workload.Reads >= 0, "workload.reads", "must not be negative, got %d", workload.Reads)
+	check(workload.Writes >= 0, "workload.writes", "must not be negative, got %d", workload.Writes)
+	check(workload.Reads <= workload.Keys && workload.Writes <= workload.Keys, "workload.keys", "%d keys are fewer than a transaction touches", workload.Keys)
+	switch workload.Access {
+	case UniformAccess:
+	case ZipfAccess:
+		check(workload.Zipf > 0, "workload.zipf", "must be positive, got %v", workload.Zipf)
+	case HotspotAccess:
+		check(workload.HotKeys > 0 && workload.HotKeys < workload.Keys, "workload.hot-keys", "must be between 0 and %d keys, got %d", workload.Keys, workload.HotKeys)
+		check(workload.HotShare > 0 && workload.HotShare < 1, "workload.hot-share", "must be between 0 and 1, got %v", workload.HotShare)
+	default:
+		check(false, "workload.access", "must be %s, %s or %s, got \"%s\"", UniformAccess, ZipfAccess, HotspotAccess, workload.Access)
+	}
+
+	check(scenario.Crypto.MSP == IdemixMSP || scenario.Crypto.MSP == X509MSP, "crypto.msp", "must be %s or %s, got \"%s\"", IdemixMSP, X509MSP, scenario.Crypto.MSP)
+	check(simulated || scenario.Crypto.MSP != X509MSP, "crypto.msp", "%s is only simulated", X509MSP)
+
+	membership := &SystemParameters{Organizations: scenario.OrganizationParameters(), Peers: peers}
+	if !simulated {
+		membership.Peers = len(scenario.RPC.Peers)
+		_, membership.Organizations = DistributedOrganizations(membership.Peers)
+	}
+
+	check(len(workload.Chaincodes) > 0, "workload.chaincodes", "at least one chaincode is needed")
+	names := make(map[string]bool)
+	for i, parameters := range scenario.ChaincodeParameters() {
+		field := fmt.Sprintf("workload.chaincodes[%d]", i)
+		check(!names[parameters.Name], field+".name", "chaincode %s is listed twice", parameters.Name)
+		names[parameters.Name] = true
+		check(workload.Chaincodes[i].Weight >= 0, field+".weight", "must not be negative, got %d", workload.Chaincodes[i].Weight)
+		if parameters.Policy == "" {
+			parameters.Policy = DefaultPolicy(workload.Endorsements, membership.Peers)
+		}
+		if chaincode, e := MakeChaincode(parameters, workload.Reads, workload.Writes); e != nil {
+			check(false, field, "%v", e)
+		} else {
+			check(chaincode.Keys() <= workload.Keys, "workload.keys", "%d keys are fewer than chaincode %s touches", workload.Keys, parameters.Name)
+			checkPolicy(chaincode.Policy(), membership, field+".policy", check)
+		}
+	}
+
+	classes := make(map[string]bool)
+	for i, class := range workload.Classes {
+		field := fmt.Sprintf("workload.classes[%d]", i)
+		check(class.Name != "", field+".name", "a class needs a name")
+		check(!classes[class.Name], field+".name", "class %s is listed twice", class.Name)
+		classes[class.Name] = true
+		check(class.Transactions >= 0, field+".transactions", "must not be negative, got %d", class.Transactions)
+		if class.Arrivals != nil {
+			checkArrivals(*class.Arrivals, field+".arrivals", check)
+			check(class.Arrivals.File == "", field+".arrivals.file", "a trace file drives every user, set it in workload.arrivals")
+			check(workload.Arrivals.File == "", field+".arrivals", "cannot be combined with the trace file of workload.arrivals")
+		}
+		if class.Mix != nil {
+			total := 0
+			for _, name := range mixNames(class.Mix) {
+				weight := class.Mix[name]
+				check(names[name], field+".mix", "chaincode %s is not in workload.chaincodes", name)
+				check(weight >= 0, field+".mix", "weight of %s must not be negative, got %d", name, weight)
+				total += weight
+			}
+			check(total > 0, field+".mix", "at least one chaincode needs a positive weight")
+		}
+	}
+
+	if arrivals := scenario.ArrivalParameters(workload.Arrivals); arrivals.TraceFile != "" {
+		if e := arrivals.Load(); e != nil {
+			check(false, "workload.arrivals.file", "%v", e)
+		} else {
+			// a distributed run does not know the users, its user processes pick their records
+			counts := map[string]int{UserActor: users, OrganizationActor: len(scenario.OrganizationParameters())}
+			reported := make(map[string]bool)
+			for _, record := range arrivals.Trace {
+				kind, index, indexed := splitActor(record.Actor)
+				if record.Actor != "" && simulated && !reported[record.Actor] {
+					reported[record.Actor] = true
+					count, known := counts[kind]
+					check(indexed && known && index < count, "workload.arrivals.file", "actor must be %s-N (%d users) or %s-N (%d organizations), got \"%s\"", UserActor, users, OrganizationActor, counts[OrganizationActor], record.Actor)
+				}
+				if record.Chaincode != "" && !reported[record.Chaincode] {
+					reported[record.Chaincode] = true
+					check(names[record.Chaincode], "workload.arrivals.file", "chaincode %s is not in workload.chaincodes", record.Chaincode)
+				}
+			}
+		}
+	}
+
+	positive(scenario.Revocation.Epoch, "revocation.epoch")
+
+	if simulated {
+		positive(scenario.Ordering.Orderers, "ordering.orderers")
+		positive(scenario.Ordering.BatchSize, "ordering.batch-size")
+		positive(scenario.Ordering.BatchTimeout, "ordering.batch-timeout")
+		positive(scenario.Ordering.MaxBlockBytes, "ordering.max-block-bytes")
+		positive(scenario.Ordering.Tick, "ordering.tick")
+		positive(scenario.Ordering.HeartbeatTicks, "ordering.heartbeat-ticks")
+		check(scenario.Ordering.ElectionTicks > scenario.Ordering.HeartbeatTicks, "ordering.election-ticks", "must be greater than ordering.heartbeat-ticks (%d), got %d", scenario.Ordering.HeartbeatTicks, scenario.Ordering.ElectionTicks)
+		for i, crash := range scenario.Ordering.Crashes {
+			field := fmt.Sprintf("ordering.crashes[%d]", i)
+			check(crash.Leader || (crash.Orderer >= 0 && crash.Orderer < scenario.Ordering.Orderers), field+".orderer", "must be one of %d orderers, got %d", scenario.Ordering.Orderers, crash.Orderer)
+			check(crash.At >= 0, field+".at", "must not be negative, got %d", crash.At)
+			positive(crash.Downtime, field+".downtime")
+		}
+
+		positive(scenario.Bandwidth.Global, "bandwidth.global")
+		positive(scenario.Bandwidth.Local, "bandwidth.local")
+		checkNetwork(scenario, map[string]int{UserActor: users, PeerActor: peers, OrdererActor: scenario.Ordering.Orderers, OrganizationActor: len(scenario.OrganizationParameters())}, check)
+
+		positive(scenario.Gossip.Fanout, "gossip.fanout")
+		positive(scenario.Gossip.PullInterval, "gossip.pull-interval")
+
+		positive(scenario.Faults.Timeout, "faults.timeout")
+		checkFaults(scenario.Faults, map[string]int{UserActor: users, PeerActor: peers, OrdererActor: scenario.Ordering.Orderers}, check)
+
+		for i, byzantine := range scenario.Byzantine {
+			field := fmt.Sprintf("byzantine[%d]", i)
+			check(byzantine.Peer >= 0 && byzantine.Peer < peers, field+".peer", "must be one of %d peers, got %d", peers, byzantine.Peer)
+			check(containsString(Behaviours, byzantine.Behaviour), field+".behaviour", "must be one of %s, got \"%s\"", strings.Join(Behaviours, ", "), byzantine.Behaviour)
+			check(byzantine.Share >= 0 && byzantine.Share <= 1, field+".share", "must be between 0 and 1, got %v", byzantine.Share)
+		}
+
+		positive(scenario.Client.EndorsementTimeout, "client.endorsement-timeout")
+		positive(scenario.Client.Attempts, "client.attempts")
+
+		checkHardware(scenario.Hardware, peers, check)
+
+		positive(scenario.Concurrency.Endorsements, "concurrency.endorsements")
+		positive(scenario.Concurrency.Validations, "concurrency.validations")
+		positive(scenario.Concurrency.Revocations, "concurrency.revocations")
+	}
+
+	// RPC settings are optional, since only the distributed mode needs them
+	check(scenario.RPC.Port >= 0 && scenario.RPC.Port < 1<<16, "rpc.port", "must be a valid TCP port, got %d", scenario.RPC.Port)
+	check(validAddress(scenario.RPC.Root), "rpc.root", "must be host:port, got \"%s\"", scenario.RPC.Root)
+	check(validAddress(scenario.RPC.Organization), "rpc.organization", "must be host:port, got \"%s\"", scenario.RPC.Organization)
+	check(validAddress(scenario.RPC.Revocation), "rpc.revocation", "must be host:port, got \"%s\"", scenario.RPC.Revocation)
+	for i, address := range scenario.RPC.Peers {
+		check(validAddress(address), fmt.Sprintf("rpc.peers[%d]", i), "must be host:port, got \"%s\"", address)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid scenario:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+
+	return
+}
+
+// mixNames lists the chaincodes of a mix in order, so that problems are reported the same way every time
+func mixNames(mix map[string]int) (names []string) {
+	for name := range mix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func checkArrivals(arrivals ArrivalScenario, field string, check func(ok bool, field, format string, args ...interface{})) {
+
+	pattern := arrivals.Pattern
+	if pattern == "" {
+		pattern = ClosedArrivals
+	}
+	check(containsString(ArrivalPatterns, pattern), field+".pattern", "must be one of %s, got \"%s\"", strings.Join(ArrivalPatterns, ", "), arrivals.Pattern)
+	check(arrivals.Frequency >= 0, field+".frequency", "must not be negative, got %d", arrivals.Frequency)
+
+	switch pattern {
+	case OpenArrivals, BurstyArrivals, DiurnalArrivals:
+		check(arrivals.Rate > 0, field+".rate", "must be positive for %s arrivals, got %v", pattern, arrivals.Rate)
+	}
+	switch pattern {
+	case BurstyArrivals:
+		check(arrivals.On > 0, field+".on", "must be positive for bursty arrivals, got %d", arrivals.On)
+		check(arrivals.Off >= 0, field+".off", "must not be negative, got %d", arrivals.Off)
+	case DiurnalArrivals:
+		check(arrivals.Period >= 0, field+".period", "must not be negative, got %d", arrivals.Period)
+		check(arrivals.Amplitude >= 0 && arrivals.Amplitude <= 1, field+".amplitude", "must be between 0 and 1, got %v", arrivals.Amplitude)
+		check(arrivals.Peak >= 0, field+".peak", "must not be negative, got %d", arrivals.Peak)
+	case TraceArrivals:
+		check((len(arrivals.Times) > 0) != (arrivals.File != ""), field+".times", "trace arrivals need either times or a file")
+		for i, at := range arrivals.Times {
+			check(at >= 0 && (i == 0 || at >= arrivals.Times[i-1]), fmt.Sprintf("%s.times[%d]", field, i), "must not be negative or earlier than the previous one, got %d", at)
+		}
+	}
+}
+
+// empty address is valid (not set)
+func validAddress(address string) bool {
+	if address == "" {
+		return true
+	}
+	colon := strings.LastIndex(address, ":")
+	return colon > 0 && colon < len(address)-1
+}
+
+// every principal must exist, and clients must find endorsers wherever they start
+func checkPolicy(policy *Policy, membership *SystemParameters, field string, check func(ok bool, field, format string, args ...interface{})) {
+
+	for _, principal := range policy.Principals() {
+		if principal.Peer >= 0 {
+			check(principal.Peer < membership.Peers, field, "%s does not exist, there are %d peers", principal, membership.Peers)
+		} else {
+			check(len(membership.OrganizationPeers(principal.Org)) > 0, field, "%s has no peers", principal)
+		}
+	}
+
+	for start := 0; start < membership.Peers; start++ {
+		endorsers, e := policy.Endorsers(membership, start)
+		if e != nil {
+			check(false, field, "%v", e)
+			return
+		}
+		if len(endorsers) > MaxEndorsements {
+			check(false, field, "needs %d endorsements, at most %d are supported", len(endorsers), MaxEndorsements)
+			return
+		}
+	}
+}
+
+// regions must be connected to each other and actors placed in existing ones
+func checkNetwork(scenario *Scenario, counts map[string]int, check func(ok bool, field, format string, args ...interface{})) {
+
+	network := scenario.Network
+
+	regions := make(map[string]bool)
+	for i, region := range network.Regions {
+		field := fmt.Sprintf("network.regions[%d]", i)
+		check(region.Name != "", field+".name", "a region needs a name")
+		check(!regions[region.Name], field+".name", "region %s is listed twice", region.Name)
+		regions[region.Name] = true
+		check(region.Latency >= 0, field+".latency", "must not be negative, got %d", region.Latency)
+		check(region.Bandwidth >= 0, field+".bandwidth", "must not be negative, got %d", region.Bandwidth)
+		check(region.Uplink >= 0, field+".uplink", "must not be negative, got %d", region.Uplink)
+		check(region.Downlink >= 0, field+".downlink", "must not be negative, got %d", region.Downlink)
+	}
+
+	linked := make(map[[2]string]bool)
+	for i, link := range network.Links {
+		field := fmt.Sprintf("network.links[%d]", i)
+		check(regions[link.From], field+".from", "region \"%s\" is not in network.regions", link.From)
+		check(regions[link.To], field+".to", "region \"%s\" is not in network.regions", link.To)
+		check(link.From != link.To, field, "a region is linked to itself by its latency and bandwidth")
+		check(!linked[[2]string{link.From, link.To}], field, "regions %s and %s are linked twice", link.From, link.To)
+		linked[[2]string{link.From, link.To}], linked[[2]string{link.To, link.From}] = true, true
+		check(link.Latency >= 0, field+".latency", "must not be negative, got %d", link.Latency)
+		check(link.Bandwidth >= 0, field+".bandwidth", "must not be negative, got %d", link.Bandwidth)
+	}
+	for i, from := range network.Regions {
+		for _, to := range network.Regions[i+1:] {
+			check(linked[[2]string{from.Name, to.Name}], "network.links", "regions %s and %s are not linked", from.Name, to.Name)
+		}
+	}
+
+	for i, placement := range network.Placement {
+		field := fmt.Sprintf("network.placement[%d]", i)
+		check(regions[placement.Region], field+".region", "region \"%s\" is not in network.regions", placement.Region)
+		check(len(placement.Actors) > 0, field+".actors", "at least one actor is needed")
+		for j, pattern := range placement.Actors {
+			if e := checkActorPattern(pattern, counts); e != nil {
+				check(false, fmt.Sprintf("%s.actors[%d]", field, j), "%v", e)
+			}
+		}
+		check(placement.Uplink >= 0, field+".uplink", "must not be negative, got %d", placement.Uplink)
+		check(placement.Downlink >= 0, field+".downlink", "must not be negative, got %d", placement.Downlink)
+	}
+
+	for i, org := range scenario.Topology.Organizations {
+		check(org.Region == "" || regions[org.Region], fmt.Sprintf("topology.organizations[%d].region", i), "region \"%s\" is not in network.regions", org.Region)
+	}
+}
+
+// profiles must be sound and peers must be put on existing ones, once
+func checkHardware(hardware HardwareScenario, peers int, check func(ok bool, field, format string, args ...interface{})) {
+
+	profiles := make(map[string]bool)
+	for i, profile := range hardware.Profiles {
+		field := fmt.Sprintf("hardware.profiles[%d]", i)
+		check(profile.Name != "", field+".name", "a profile needs a name")
+		check(!profiles[profile.Name], field+".name", "profile %s is listed twice", profile.Name)
+		profiles[profile.Name] = true
+		check(profile.Cores > 0, field+".cores", "must be positive, got %d", profile.Cores)
+		check(profile.Speed >= 0, field+".speed", "must not be negative, got %v", profile.Speed)
+		check(profile.Memory >= 0, field+".memory", "must not be negative, got %d", profile.Memory)
+	}
+
+	check(hardware.Default == "" || profiles[hardware.Default], "hardware.default", "profile \"%s\" is not in hardware.profiles", hardware.Default)
+
+	listed := make(map[int]bool)
+	for i, peer := range hardware.Peers {
+		field := fmt.Sprintf("hardware.peers[%d]", i)
+		check(peer.Peer >= 0 && peer.Peer < peers, field+".peer", "must be one of %d peers, got %d", peers, peer.Peer)
+		check(!listed[peer.Peer], field+".peer", "peer-%d is listed twice", peer.Peer)
+		listed[peer.Peer] = true
+		check(profiles[peer.Profile], field+".profile", "profile \"%s\" is not in hardware.profiles", peer.Profile)
+	}
+}
+
+// faults must name existing actors and end, unless they let the network make progress
+func checkFaults(faults FaultScenario, counts map[string]int, check func(ok bool, field, format string, args ...interface{})) {
+
+	actor := func(pattern, field string) {
+		if e := checkActorPattern(pattern, counts); e != nil {
+			check(false, field, "%v", e)
+		}
+	}
+
+	for i, crash := range faults.Crashes {
+		field := fmt.Sprintf("faults.crashes[%d]", i)
+		kind, _, indexed := splitActor(crash.Actor)
+		check(crash.Actor == RevocationAuthorityActor || (indexed && kind == PeerActor), field+".actor", "must be %s-N or %s, got \"%s\"", PeerActor, RevocationAuthorityActor, crash.Actor)
+		actor(crash.Actor, field+".actor")
+		check(crash.At >= 0, field+".at", "must not be negative, got %d", crash.At)
+		check(crash.Downtime > 0, field+".downtime", "must be positive, got %d", crash.Downtime)
+	}
+
+	for i, link := range faults.Links {
+		field := fmt.Sprintf("faults.links[%d]", i)
+		actor(link.From, field+".from")
+		actor(link.To, field+".to")
+		check(link.Loss >= 0 && link.Loss <= 1, field+".loss", "must be between 0 and 1, got %v", link.Loss)
+		check(link.Delay >= 0, field+".delay", "must not be negative, got %d", link.Delay)
+		check(link.Loss > 0 || link.Delay > 0, field, "must lose or delay messages")
+		check(link.At >= 0, field+".at", "must not be negative, got %d", link.At)
+		check(link.Duration >= 0, field+".duration", "must not be negative, got %d", link.Duration)
+		check(link.Loss < 1 || link.Duration > 0, field+".duration", "a link that loses every message must heal")
+	}
+
+	for i, partition := range faults.Partitions {
+		field := fmt.Sprintf("faults.partitions[%d]", i)
+		check(len(partition.Actors) > 0, field+".actors", "at least one actor is needed")
+		for j, pattern := range partition.Actors {
+			actor(pattern, fmt.Sprintf("%s.actors[%d]", field, j))
+		}
+		check(partition.At >= 0, field+".at", "must not be negative, got %d", partition.At)
+		check(partition.Duration > 0, field+".duration", "must be positive, got %d", partition.Duration)
+	}
+}
@@ -1,10 +1,12 @@
 package helpers
 
 import (
+	"fmt"
+
 	"github.com/dbogatov/dac-lib/dac"
-	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
 	"github.com/op/go-logging"
+	"golang.org/x/exp/rand"
 )
 
 // YsNum ...
@@ -15,66 +17,188 @@ const NonceSize = 32
 
 // SystemParameters ...
 type SystemParameters struct {
+	Seed                   []byte // master seed of the randomness hierarchy
 	Ys                     [][]interface{}
 	H                      *FP256BN.ECP2 // because we have users on level 2
 	RootPk                 dac.PK
 	Orgs                   int
-	Users                  int
-	Peers                  int
+	Organizations          []OrganizationParameters
+	Peers                  int // total over all organizations
 	Endorsements           int
+	Keys                   int
+	Reads                  int
+	Writes                 int
+	KeyAccess              string
+	Zipf                   float64
+	HotKeys                int
+	HotShare               float64
+	Chaincodes             []ChaincodeParameters
+	Orderers               int
+	BatchSize              int // max transactions per block
+	BatchTimeout           int // ms
+	MaxBlockBytes          int
+	RaftTick               int // ms
+	ElectionTicks          int
+	HeartbeatTicks         int
+	OrdererCrashes         []OrdererCrash
 	Epoch                  int
 	Transactions           int
 	Frequency              int
+	Arrivals               ArrivalParameters // of the users of organizations without their own
+	Classes                []ClassParameters
+	ProcessClass           string // of the users no organization lists, like the user of a distributed process
 	ConcurrentEndorsements int
 	ConcurrentValidations  int
 	ConcurrentRevocations  int
 	BandwidthGlobal        int // B/s
 	BandwidthLocal         int // B/s
+	Network                NetworkScenario
+	Gossip                 bool
+	GossipFanout           int
+	GossipPullInterval     int // ms
+	FaultTimeout           int // ms
+	Crashes                []CrashFault
+	LinkFaults             []LinkFault
+	Partitions             []PartitionFault
+	Byzantine              []ByzantinePeer
+	EndorsementTimeout     int // ms
+	EndorsementAttempts    int
+	Hardware               HardwareScenario
 	Revoke                 bool
 	Audit                  bool
+	MSP                    string // kind of identities of the users
+	CostModel              bool   // skip real crypto, charge costs from the profile only
+	CostProfile            string // path to JSON cost profile; built-in if empty
 	AuditPK                interface{}
 	RPCPort                int
 	RootRPCAddress         string
 	OrgRPCAddress          string
 	RevocationRPCAddress   string
 	PeerRPCAddresses       []string
+
+	arrivalSources []string          // whose pattern each listed user follows, by user
+	arrivalGroups  map[string][]int  // the listed users that follow each pattern
+	traceArrivals  map[int][]Arrival // dealt to the listed users whose pattern is a trace
+}
+
+// OrganizationParameters ...
+type OrganizationParameters struct {
+	Users    int
+	Peers    int
+	Arrivals *ArrivalParameters // shared with the other organizations if nil
+	Classes  []ClassUsers       // all users are of the default class if empty
+	Region   string             // of the organization, its users and peers; the first one if empty
+}
+
+// ClassUsers is how many users of a class an organization has
+type ClassUsers struct {
+	Class string
+	Users int
+}
+
+// ClassParameters is a kind of users; the default class, without a name, has the settings of the workload
+type ClassParameters struct {
+	Name         string
+	Transactions int                // per user
+	Arrivals     *ArrivalParameters // shared by the users of the class if set
+	Mix          map[string]int     // chaincode weights by name; those of the workload if nil
+	Revoke       bool               // the users prove non-revocation
+}
+
+// ChaincodeParameters ...
+type ChaincodeParameters struct {
+	Name   string
+	Weight int
+	Cost   DurationDistribution
+	Policy string // endorsement policy; any Endorsements peers if empty
 }
 
-// MakeSystemParameters ...
-func MakeSystemParameters(
-	logger *logging.Logger,
-	prg *amcl.RAND, orgs, users, peers, endorsements, epoch, bandwidthGlobal, bandwidthLocal, concurrentEndorsements, concurrentValidations, concurrentRevocations, transactions, frequency int,
-	revoke, audit bool,
-	rpcPort int,
-	rootRPCAddress, orgRPCAddress, revocationRPCAddress string,
-	peerRPCAddresses []string,
-) (sysParams *SystemParameters, rootSk, auditSk dac.SK) {
+// MakeSystemParameters derives the parameters from a (validated) scenario
+func MakeSystemParameters(logger *logging.Logger, scenario *Scenario) (sysParams *SystemParameters, rootSk, auditSk dac.SK) {
+
+	seed := SeedFromInt(scenario.Seed)
+	prg := NewRandDerived(seed, "system")
+
+	organizations := scenario.OrganizationParameters()
+	peers := 0
+	for _, org := range organizations {
+		peers += org.Peers
+	}
 
 	sysParams = &SystemParameters{
-		Orgs:                   orgs,
-		Users:                  users,
+		Seed:                   seed,
+		Orgs:                   len(organizations),
+		Organizations:          organizations,
 		Peers:                  peers,
-		Endorsements:           endorsements,
-		Epoch:                  epoch,
-		BandwidthGlobal:        bandwidthGlobal,
-		BandwidthLocal:         bandwidthLocal,
-		Frequency:              frequency,
-		ConcurrentEndorsements: concurrentEndorsements,
-		ConcurrentValidations:  concurrentValidations,
-		ConcurrentRevocations:  concurrentRevocations,
-		Transactions:           transactions,
-		Revoke:                 revoke,
-		Audit:                  audit,
+		Endorsements:           scenario.Workload.Endorsements,
+		Keys:                   scenario.Workload.Keys,
+		Reads:                  scenario.Workload.Reads,
+		Writes:                 scenario.Workload.Writes,
+		KeyAccess:              scenario.Workload.Access,
+		Zipf:                   scenario.Workload.Zipf,
+		HotKeys:                scenario.Workload.HotKeys,
+		HotShare:               scenario.Workload.HotShare,
+		Chaincodes:             scenario.ChaincodeParameters(),
+		Orderers:               scenario.Ordering.Orderers,
+		BatchSize:              scenario.Ordering.BatchSize,
+		BatchTimeout:           scenario.Ordering.BatchTimeout,
+		MaxBlockBytes:          scenario.Ordering.MaxBlockBytes,
+		RaftTick:               scenario.Ordering.Tick,
+		ElectionTicks:          scenario.Ordering.ElectionTicks,
+		HeartbeatTicks:         scenario.Ordering.HeartbeatTicks,
+		OrdererCrashes:         scenario.Ordering.Crashes,
+		Epoch:                  scenario.Revocation.Epoch,
+		BandwidthGlobal:        scenario.Bandwidth.Global,
+		BandwidthLocal:         scenario.Bandwidth.Local,
+		Network:                scenario.NetworkParameters(),
+		Gossip:                 scenario.Gossip.Enabled,
+		GossipFanout:           scenario.Gossip.Fanout,
+		GossipPullInterval:     scenario.Gossip.PullInterval,
+		FaultTimeout:           scenario.Faults.Timeout,
+		Crashes:                scenario.Faults.Crashes,
+		LinkFaults:             scenario.Faults.Links,
+		Partitions:             scenario.Faults.Partitions,
+		Byzantine:              scenario.ByzantinePeers(),
+		EndorsementTimeout:     scenario.Client.EndorsementTimeout,
+		EndorsementAttempts:    scenario.Client.Attempts,
+		Hardware:               scenario.HardwareParameters(),
+		Arrivals:               scenario.ArrivalParameters(scenario.Workload.Arrivals),
+		Classes:                scenario.ClassParameters(),
+		ConcurrentEndorsements: scenario.Concurrency.Endorsements,
+		ConcurrentValidations:  scenario.Concurrency.Validations,
+		ConcurrentRevocations:  scenario.Concurrency.Revocations,
+		Transactions:           scenario.Workload.Transactions,
+		Revoke:                 scenario.Revocation.Enabled,
+		Audit:                  scenario.Audit.Enabled,
+		MSP:                    scenario.Crypto.MSP,
+		CostModel:              scenario.Crypto.CostModel,
+		CostProfile:            scenario.Crypto.CostProfile,
 		H:                      FP256BN.ECP2_generator().Mul(FP256BN.Randomnum(FP256BN.NewBIGints(FP256BN.CURVE_Order), prg)),
-		RPCPort:                rpcPort,
-		RootRPCAddress:         rootRPCAddress,
-		OrgRPCAddress:          orgRPCAddress,
-		RevocationRPCAddress:   revocationRPCAddress,
-		PeerRPCAddresses:       peerRPCAddresses,
+		RPCPort:                scenario.RPC.Port,
+		RootRPCAddress:         scenario.RPC.Root,
+		OrgRPCAddress:          scenario.RPC.Organization,
+		RevocationRPCAddress:   scenario.RPC.Revocation,
+		PeerRPCAddresses:       scenario.RPC.Peers,
+	}
+
+	if scenario.Workload.Frequency != nil {
+		sysParams.Frequency = *scenario.Workload.Frequency
+	}
+
+	if sysParams.X509() && (sysParams.Audit || sysParams.Revocations()) {
+		// the certificate discloses the author, and revoked certificates are listed by the MSP
+		logger.Warning("X.509 users need neither auditing nor non-revocation proofs, both are disabled")
+		sysParams.Audit = false
+		sysParams.Revoke = false
+		for i := range sysParams.Classes {
+			sysParams.Classes[i].Revoke = false
+		}
 	}
 
 	logger.Noticef("%+v\n", sysParams)
 
+	sysParams.IndexArrivals()
+
 	sysParams.Ys = make([][]interface{}, 2)
 	sysParams.Ys[0] = dac.GenerateYs(false, YsNum, prg)
 	sysParams.Ys[1] = dac.GenerateYs(true, YsNum, prg)
@@ -84,3 +208,320 @@ func MakeSystemParameters(
 
 	return
 }
+
+// TotalUsers ...
+func (sysParams *SystemParameters) TotalUsers() (users int) {
+	for _, org := range sysParams.Organizations {
+		users += org.Users
+	}
+	return
+}
+
+// TotalTransactions is what all users submit, given their classes and arrival patterns
+func (sysParams *SystemParameters) TotalTransactions() (total int) {
+	for user := 0; user < sysParams.TotalUsers(); user++ {
+		if arrivals, group := sysParams.arrivalGroup(user); arrivals.Pattern == TraceArrivals {
+			total += len(sysParams.replay(arrivals, user, group))
+		} else {
+			total += sysParams.UserClass(user).Transactions
+		}
+	}
+	return
+}
+
+// Class returns the class of that name, the default one if the name is empty
+func (sysParams *SystemParameters) Class(name string) (class ClassParameters, found bool) {
+
+	if name == "" {
+		return ClassParameters{Transactions: sysParams.Transactions, Revoke: sysParams.Revoke}, true
+	}
+
+	for _, class := range sysParams.Classes {
+		if class.Name == name {
+			return class, true
+		}
+	}
+
+	return
+}
+
+// UserClass is the class of a user
+func (sysParams *SystemParameters) UserClass(user int) ClassParameters {
+
+	name := sysParams.ProcessClass
+	if org, index := sysParams.locateUser(user); org >= 0 {
+		name = sysParams.Organizations[org].userClass(index)
+	}
+
+	class, _ := sysParams.Class(name)
+	return class
+}
+
+// X509 tells whether users hold X.509 certificates instead of Idemix credentials
+func (sysParams *SystemParameters) X509() bool {
+	return sysParams.MSP == X509MSP
+}
+
+// Revocations tells whether any user proves non-revocation, so that epochs matter
+func (sysParams *SystemParameters) Revocations() bool {
+
+	revoke := sysParams.Revoke
+	for _, class := range sysParams.Classes {
+		revoke = revoke || class.Revoke
+	}
+
+	return revoke
+}
+
+// UserArrivals is the arrival pattern of a user
+func (sysParams *SystemParameters) UserArrivals(user int) ArrivalParameters {
+	arrivals, _ := sysParams.arrivalGroup(user)
+	return arrivals
+}
+
+// UserSchedule is when a user of an open pattern submits its transactions, and what they invoke
+func (sysParams *SystemParameters) UserSchedule(user int, src rand.Source) []Arrival {
+
+	arrivals, group := sysParams.arrivalGroup(user)
+	if arrivals.Pattern == TraceArrivals {
+		return sysParams.replay(arrivals, user, group)
+	}
+
+	return arrivals.Schedule(len(group), sysParams.UserClass(user).Transactions, src)
+}
+
+// arrivalGroup lists the users that share the arrival pattern of a user: that of its class, else of its organization,
+// else of the workload; a user no organization lists, like the single user of a distributed process, has the pattern alone
+func (sysParams *SystemParameters) arrivalGroup(user int) (arrivals ArrivalParameters, group []int) {
+
+	arrivals, listed := sysParams.arrivalPattern(user)
+	if !listed {
+		return arrivals, []int{user}
+	}
+
+	return arrivals, sysParams.arrivalGroups[sysParams.arrivalSources[user]]
+}
+
+// arrivalPattern is the arrival pattern of a user, and whether an organization lists the user
+func (sysParams *SystemParameters) arrivalPattern(user int) (arrivals ArrivalParameters, listed bool) {
+
+	arrivals = sysParams.Arrivals
+	org, _ := sysParams.locateUser(user)
+	if org >= 0 && sysParams.Organizations[org].Arrivals != nil {
+		arrivals = *sysParams.Organizations[org].Arrivals
+	}
+	if class := sysParams.UserClass(user); class.Arrivals != nil {
+		arrivals = *class.Arrivals
+	}
+
+	return arrivals, org >= 0
+}
+
+// IndexArrivals groups the listed users by the pattern they follow and deals the traces among them;
+// it runs again whenever the organizations change or the trace file is read
+func (sysParams *SystemParameters) IndexArrivals() {
+
+	sources := make([]string, 0, sysParams.TotalUsers())
+	groups := make(map[string][]int)
+	for org, organization := range sysParams.Organizations {
+		for index := 0; index < organization.Users; index++ {
+			source := "workload"
+			if organization.Arrivals != nil {
+				source = fmt.Sprintf("%s-%d", OrganizationActor, org)
+			}
+			if class, _ := sysParams.Class(organization.userClass(index)); class.Arrivals != nil {
+				source = fmt.Sprintf("class-%s", class.Name)
+			}
+			groups[source] = append(groups[source], len(sources))
+			sources = append(sources, source)
+		}
+	}
+	sysParams.arrivalSources = sources
+	sysParams.arrivalGroups = groups
+
+	traces := make(map[int][]Arrival)
+	for _, group := range groups {
+		if arrivals, _ := sysParams.arrivalPattern(group[0]); arrivals.Pattern == TraceArrivals {
+			for user, dealt := range sysParams.deal(arrivals.Trace, group) {
+				traces[user] = dealt
+			}
+		}
+	}
+	sysParams.traceArrivals = traces
+}
+
+// LoadArrivals reads the trace file, if any, and deals it to the users
+func (sysParams *SystemParameters) LoadArrivals() (e error) {
+
+	if e = sysParams.Arrivals.Load(); e != nil {
+		return
+	}
+	sysParams.IndexArrivals()
+
+	return
+}
+
+// replay is the part of a trace dealt to a user; only a user no organization lists has it dealt on demand
+func (sysParams *SystemParameters) replay(arrivals ArrivalParameters, user int, group []int) []Arrival {
+
+	if dealt, indexed := sysParams.traceArrivals[user]; indexed {
+		return dealt
+	}
+
+	return sysParams.deal(arrivals.Trace, group)[user]
+}
+
+// deal splits a trace among the users of its pattern: a record goes to the user it names, or round-robin to the users
+// of the organization it names, or to the users of the pattern if it names nobody or an organization without listed users
+func (sysParams *SystemParameters) deal(trace []TraceRecord, group []int) (dealt map[int][]Arrival) {
+
+	dealt = make(map[int][]Arrival, len(group))
+	names := make(map[string]int, len(group))
+	for _, user := range group {
+		dealt[user] = nil
+		names[fmt.Sprintf("%s-%d", UserActor, user)] = user
+	}
+
+	members := make(map[int][]int) // users of the organizations records name
+	counts := make(map[string]int) // records dealt so far, by the actor they name
+	for _, record := range trace {
+		users := group
+		if kind, org, indexed := splitActor(record.Actor); indexed && kind == OrganizationActor {
+			if _, found := members[org]; !found {
+				members[org] = sysParams.OrganizationUsers(org)
+			}
+			if len(members[org]) > 0 {
+				users = members[org]
+			}
+		} else if record.Actor != "" {
+			if user, named := names[record.Actor]; named {
+				dealt[user] = append(dealt[user], record.Arrival)
+			}
+			continue
+		}
+
+		user := users[counts[record.Actor]%len(users)]
+		counts[record.Actor]++
+
+		// a user of the organization that follows another pattern does not replay the record
+		if _, member := dealt[user]; member {
+			dealt[user] = append(dealt[user], record.Arrival)
+		}
+	}
+
+	return
+}
+
+// OrganizationUsers lists the users of an organization; users are numbered in the order of organizations
+func (sysParams *SystemParameters) OrganizationUsers(org int) (users []int) {
+
+	if org < 0 || org >= len(sysParams.Organizations) {
+		return
+	}
+
+	first := 0
+	for _, organization := range sysParams.Organizations[:org] {
+		first += organization.Users
+	}
+	for user := first; user < first+sysParams.Organizations[org].Users; user++ {
+		users = append(users, user)
+	}
+
+	return
+}
+
+// UserOrganization is the organization that lists a user, or -1
+func (sysParams *SystemParameters) UserOrganization(user int) int {
+	org, _ := sysParams.locateUser(user)
+	return org
+}
+
+// locateUser finds the organization that lists a user and the position of the user in it, or -1
+func (sysParams *SystemParameters) locateUser(user int) (org, index int) {
+
+	if user < 0 {
+		return -1, 0
+	}
+
+	for org, organization := range sysParams.Organizations {
+		if user < organization.Users {
+			return org, user
+		}
+		user -= organization.Users
+	}
+
+	return -1, 0
+}
+
+// userClass is the class of a user of the organization, by its position
+func (organization OrganizationParameters) userClass(index int) string {
+
+	for _, class := range organization.Classes {
+		if index < class.Users {
+			return class.Class
+		}
+		index -= class.Users
+	}
+
+	return ""
+}
+
+// PeerHardware is the profile of a peer, or nil if it runs on the host
+func (sysParams *SystemParameters) PeerHardware(peer int) *HardwareProfile {
+
+	name := sysParams.Hardware.Default
+	for _, listed := range sysParams.Hardware.Peers {
+		if listed.Peer == peer {
+			name = listed.Profile
+		}
+	}
+
+	for i := range sysParams.Hardware.Profiles {
+		if profile := &sysParams.Hardware.Profiles[i]; profile.Name == name {
+			return profile
+		}
+	}
+
+	return nil
+}
+
+// DistributedOrganizations is the topology of a distributed run:
+// the organization at the org address owns all listed peers
+func DistributedOrganizations(peers int) (orgs int, organizations []OrganizationParameters) {
+	return 1, []OrganizationParameters{{Peers: peers}}
+}
+
+// OrganizationPeers lists the peers of an organization; peers are numbered in the order of organizations
+func (sysParams *SystemParameters) OrganizationPeers(org int) (peers []int) {
+
+	if org < 0 || org >= len(sysParams.Organizations) {
+		return
+	}
+
+	first := 0
+	for _, organization := range sysParams.Organizations[:org] {
+		first += organization.Peers
+	}
+	for peer := first; peer < first+sysParams.Organizations[org].Peers && peer < sysParams.Peers; peer++ {
+		peers = append(peers, peer)
+	}
+
+	return
+}
+
+// PeerOrganization is the organization that owns a peer, or -1
+func (sysParams *SystemParameters) PeerOrganization(peer int) int {
+
+	if peer >= sysParams.Peers {
+		return -1
+	}
+
+	for org, organization := range sysParams.Organizations {
+		if peer < organization.Peers {
+			return org
+		}
+		peer -= organization.Peers
+	}
+
+	return -1
+}
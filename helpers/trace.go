@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Arrival is a transaction a user submits at a time since the start of the workload
+type Arrival struct {
+	At        time.Duration
+	Chaincode string // drawn from the mix if empty
+	Payload   int    // bytes of the chaincode argument; the proposal hash if zero
+}
+
+// TraceRecord is an arrival of a trace, with the actor that submits it
+type TraceRecord struct {
+	Arrival
+	Actor string // user-N, org-N, or any user of the pattern if empty
+}
+
+// traceRecordJSON is a record of a JSON trace, an array of objects
+type traceRecordJSON struct {
+	Timestamp interface{} `json:"timestamp"` // ms or RFC 3339
+	Actor     string      `json:"actor"`
+	Chaincode string      `json:"chaincode"`
+	Payload   int         `json:"payload"`
+}
+
+// LoadTrace reads a CSV (timestamp, actor, chaincode, payload; all but the timestamp optional) or a JSON trace;
+// timestamps are ms or RFC 3339, and the records are sorted and shifted so that the first one arrives at zero
+func LoadTrace(path string) (records []TraceRecord, e error) {
+
+	timestamps := make([]float64, 0)
+
+	add := func(line int, timestamp interface{}, actor, chaincode string, payload int) error {
+		ms, e := parseTimestamp(timestamp)
+		if e != nil {
+			return fmt.Errorf("trace %s, record %d: %v", path, line, e)
+		}
+		if payload < 0 {
+			return fmt.Errorf("trace %s, record %d: negative payload %d", path, line, payload)
+		}
+		timestamps = append(timestamps, ms)
+		records = append(records, TraceRecord{
+			Arrival: Arrival{
+				Chaincode: chaincode,
+				Payload:   payload,
+			},
+			Actor: actor,
+		})
+		return nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		raw, e := ioutil.ReadFile(path)
+		if e != nil {
+			return nil, e
+		}
+		parsed := make([]traceRecordJSON, 0)
+		if e = json.Unmarshal(raw, &parsed); e != nil {
+			return nil, fmt.Errorf("trace %s: %v", path, e)
+		}
+		for i, record := range parsed {
+			if e = add(i+1, record.Timestamp, record.Actor, record.Chaincode, record.Payload); e != nil {
+				return nil, e
+			}
+		}
+
+	case ".csv":
+		file, e := os.Open(path)
+		if e != nil {
+			return nil, e
+		}
+		defer file.Close()
+
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, e := reader.ReadAll()
+		if e != nil {
+			return nil, fmt.Errorf("trace %s: %v", path, e)
+		}
+		if len(rows) > 0 && strings.EqualFold(rows[0][0], "timestamp") {
+			rows = rows[1:] // header
+		}
+		for i, row := range rows {
+			row = append(row, "", "", "")
+			payload := 0
+			if row[3] != "" {
+				if payload, e = strconv.Atoi(row[3]); e != nil {
+					return nil, fmt.Errorf("trace %s, record %d: payload \"%s\" is not a number", path, i+1, row[3])
+				}
+			}
+			if e = add(i+1, row[0], row[1], row[2], payload); e != nil {
+				return nil, e
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("trace %s: expected a .csv or .json file", path)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("trace %s has no records", path)
+	}
+
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return timestamps[order[i]] < timestamps[order[j]]
+	})
+	sorted := make([]TraceRecord, len(records))
+	first := timestamps[order[0]]
+	for i, original := range order {
+		sorted[i] = records[original]
+		sorted[i].At = time.Duration((timestamps[original] - first) * float64(time.Millisecond))
+	}
+
+	return sorted, nil
+}
+
+func parseTimestamp(timestamp interface{}) (ms float64, e error) {
+
+	switch value := timestamp.(type) {
+	case float64:
+		return value, nil
+	case string:
+		if ms, e = strconv.ParseFloat(value, 64); e == nil {
+			return
+		}
+		parsed, e := time.Parse(time.RFC3339Nano, value)
+		if e != nil {
+			return 0, fmt.Errorf("timestamp \"%s\" is neither ms nor RFC 3339", value)
+		}
+		return float64(parsed.UnixNano()) / float64(time.Millisecond), nil
+	default:
+		return 0, fmt.Errorf("missing or malformed timestamp")
+	}
+}
+
+// PayloadFrom stretches a hash to the size of a payload, so that the argument depends on the transaction only
+func PayloadFrom(hash []byte, size int) (payload []byte) {
+	payload = make([]byte, size)
+	for i := 0; i < size; i += len(hash) {
+		copy(payload[i:], hash)
+	}
+	return
+}
@@ -0,0 +1,433 @@
+package helpers
+
+import (
+	"encoding/binary"
+)
+
+// Wire types, as in protocol buffers
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// WireMessage is a protocol message with a canonical encoding;
+// the simulator takes the sizes of messages from it and the distributed mode sends the same fields
+type WireMessage interface {
+	EncodeWire(encoder *WireEncoder)
+}
+
+// WireEncoder writes fields in order as protocol buffers do: each field is a varint key (number and wire type)
+// followed by a varint or by a length-prefixed value; zero values are left out, as in proto3
+type WireEncoder struct {
+	bytes []byte
+}
+
+// Encode ...
+func Encode(message WireMessage) []byte {
+	encoder := &WireEncoder{}
+	message.EncodeWire(encoder)
+	return encoder.bytes
+}
+
+// EncodedSize ...
+func EncodedSize(message WireMessage) int {
+	return len(Encode(message))
+}
+
+func (encoder *WireEncoder) key(field, wireType int) {
+	encoder.bytes = appendUvarint(encoder.bytes, uint64(field<<3|wireType))
+}
+
+// Int writes negative values in ten bytes, as int64 fields are
+func (encoder *WireEncoder) Int(field, value int) {
+	if value == 0 {
+		return
+	}
+	encoder.key(field, wireVarint)
+	encoder.bytes = appendUvarint(encoder.bytes, uint64(value))
+}
+
+// Bool ...
+func (encoder *WireEncoder) Bool(field int, value bool) {
+	if value {
+		encoder.Int(field, 1)
+	}
+}
+
+// Bytes ...
+func (encoder *WireEncoder) Bytes(field int, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	encoder.key(field, wireBytes)
+	encoder.bytes = appendUvarint(encoder.bytes, uint64(len(value)))
+	encoder.bytes = append(encoder.bytes, value...)
+}
+
+// String ...
+func (encoder *WireEncoder) String(field int, value string) {
+	encoder.Bytes(field, []byte(value))
+}
+
+// Strings is a repeated field
+func (encoder *WireEncoder) Strings(field int, values []string) {
+	for _, value := range values {
+		encoder.key(field, wireBytes)
+		encoder.bytes = appendUvarint(encoder.bytes, uint64(len(value)))
+		encoder.bytes = append(encoder.bytes, value...)
+	}
+}
+
+// Message embeds another message, even an empty one
+func (encoder *WireEncoder) Message(field int, message WireMessage) {
+	bytes := Encode(message)
+	encoder.key(field, wireBytes)
+	encoder.bytes = appendUvarint(encoder.bytes, uint64(len(bytes)))
+	encoder.bytes = append(encoder.bytes, bytes...)
+}
+
+func appendUvarint(bytes []byte, value uint64) []byte {
+	var buffer [binary.MaxVarintLen64]byte
+	return append(bytes, buffer[:binary.PutUvarint(buffer[:], value)]...)
+}
+
+/// Identities
+
+// WireNonce ...
+type WireNonce struct {
+	Nonce []byte
+}
+
+// EncodeWire ...
+func (message WireNonce) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Nonce)
+}
+
+// WireCredRequest asks the issuer to delegate credentials to the key of the request
+type WireCredRequest struct {
+	Request []byte // dac.CredRequest
+	ID      int    // of the requester
+}
+
+// EncodeWire ...
+func (message WireCredRequest) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Request)
+	encoder.Int(2, message.ID)
+}
+
+// WireCredentials ...
+type WireCredentials struct {
+	Credentials []byte // dac.Credentials
+}
+
+// EncodeWire ...
+func (message WireCredentials) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Credentials)
+}
+
+// WireCertificate is the identity an organization issues to its peer
+type WireCertificate struct {
+	Org       int
+	Peer      int
+	Role      string
+	PK        []byte // dac.PointToBytes
+	Signature []byte // dac.SchnorrSignature by the organization
+}
+
+// EncodeWire ...
+func (message WireCertificate) EncodeWire(encoder *WireEncoder) {
+	encoder.Int(1, message.Org)
+	encoder.Int(2, message.Peer)
+	encoder.String(3, message.Role)
+	encoder.Bytes(4, message.PK)
+	encoder.Bytes(5, message.Signature)
+}
+
+// WireX509CertificateRequest ...
+type WireX509CertificateRequest struct {
+	Request []byte // DER of PKCS #10
+}
+
+// EncodeWire ...
+func (message WireX509CertificateRequest) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Request)
+}
+
+// WireX509Certificate ...
+type WireX509Certificate struct {
+	Certificate []byte // DER
+}
+
+// EncodeWire ...
+func (message WireX509Certificate) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Certificate)
+}
+
+/// Revocation
+
+// WireNonRevocationRequest ...
+type WireNonRevocationRequest struct {
+	PK []byte // revocation key of the user, dac.PointToBytes
+}
+
+// EncodeWire ...
+func (message WireNonRevocationRequest) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.PK)
+}
+
+// WireNonRevocationHandle ...
+type WireNonRevocationHandle struct {
+	Handle []byte // dac.GrothSignature
+}
+
+// EncodeWire ...
+func (message WireNonRevocationHandle) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Handle)
+}
+
+/// Transactions
+
+// WireProposal leaves out the author, which only the simulation knows to check auditing
+type WireProposal struct {
+	Hash       []byte
+	Class      string
+	Chaincode  string
+	Signature  []byte // dac.NymSignature, or ECDSA of an X.509 author
+	Author     []byte // dac.Proof, or the X.509 certificate
+	PkNym      []byte // dac.PointToBytes
+	IndexValue []byte // dac.PointToBytes of the disclosed attribute
+	Keys       []string
+	Payload    []byte
+}
+
+// EncodeWire ...
+func (message WireProposal) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Hash)
+	encoder.String(2, message.Class)
+	encoder.String(3, message.Chaincode)
+	encoder.Bytes(4, message.Signature)
+	encoder.Bytes(5, message.Author)
+	encoder.Bytes(6, message.PkNym)
+	encoder.Bytes(7, message.IndexValue)
+	encoder.Strings(8, message.Keys)
+	encoder.Bytes(9, message.Payload)
+}
+
+// EncodeWire writes the reads and then the writes
+func (rwset ReadWriteSet) EncodeWire(encoder *WireEncoder) {
+	for _, read := range rwset.Reads {
+		encoder.Message(1, read)
+	}
+	for _, write := range rwset.Writes {
+		encoder.Message(2, write)
+	}
+}
+
+// EncodeWire has no version for a key that does not exist, as in Fabric
+func (read KeyRead) EncodeWire(encoder *WireEncoder) {
+	encoder.String(1, read.Key)
+	if read.Exists {
+		encoder.Message(2, read.Version)
+	}
+}
+
+// EncodeWire ...
+func (write KeyWrite) EncodeWire(encoder *WireEncoder) {
+	encoder.String(1, write.Key)
+	encoder.Bytes(2, write.Value)
+}
+
+// EncodeWire ...
+func (version Version) EncodeWire(encoder *WireEncoder) {
+	encoder.Int(1, version.Block)
+	encoder.Int(2, version.Transaction)
+}
+
+// WireEndorsement is a proposal response; in a transaction, the read/write set is that of the transaction
+type WireEndorsement struct {
+	Signature   []byte // dac.SchnorrSignature
+	Certificate WireCertificate
+	RWSet       ReadWriteSet
+}
+
+// EncodeWire ...
+func (message WireEndorsement) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Signature)
+	encoder.Message(2, message.Certificate)
+	if len(message.RWSet.Reads)+len(message.RWSet.Writes) > 0 {
+		encoder.Message(3, message.RWSet)
+	}
+}
+
+// WireTransaction leaves out the key of the author and the position in the ledger,
+// which only the distributed mode knows to check auditing and to commit in order
+type WireTransaction struct {
+	Signature          []byte // dac.NymSignature, or ECDSA of an X.509 author
+	Proposal           WireProposal
+	AuditProof         []byte // dac.AuditingProof
+	AuditEnc           []byte // dac.AuditingEncryption
+	Endorsements       []WireEndorsement
+	RWSet              ReadWriteSet
+	NonRevocationProof []byte // dac.RevocationProof
+	Epoch              int    // of the non-revocation proof, left out without one
+}
+
+// EncodeWire ...
+func (message WireTransaction) EncodeWire(encoder *WireEncoder) {
+	encoder.Bytes(1, message.Signature)
+	encoder.Message(2, message.Proposal)
+	encoder.Bytes(3, message.AuditProof)
+	encoder.Bytes(4, message.AuditEnc)
+	for _, endorsement := range message.Endorsements {
+		encoder.Message(5, endorsement)
+	}
+	encoder.Message(6, message.RWSet)
+	encoder.Bytes(7, message.NonRevocationProof)
+	if len(message.NonRevocationProof) > 0 {
+		encoder.Int(8, message.Epoch)
+	}
+}
+
+/// Ordering
+
+// EncodeWire ...
+func (header BlockHeader) EncodeWire(encoder *WireEncoder) {
+	encoder.Int(1, header.Number)
+	encoder.Bytes(2, header.PreviousHash)
+	encoder.Bytes(3, header.DataHash)
+}
+
+// WireBlock carries its transactions encoded, as Fabric blocks carry envelopes
+type WireBlock struct {
+	Header       BlockHeader
+	Transactions [][]byte
+	Orderer      int
+	Signature    []byte // dac.SchnorrSignature of the header by the orderer
+}
+
+// EncodeWire ...
+func (message WireBlock) EncodeWire(encoder *WireEncoder) {
+	encoder.Message(1, message.Header)
+	for _, transaction := range message.Transactions {
+		encoder.Bytes(2, transaction)
+	}
+	encoder.Int(3, message.Orderer)
+	encoder.Bytes(4, message.Signature)
+}
+
+// WireRaftEntry has no block if it is the no-op of a new leader
+type WireRaftEntry struct {
+	Term  int
+	Block []byte // WireBlock
+}
+
+// EncodeWire ...
+func (message WireRaftEntry) EncodeWire(encoder *WireEncoder) {
+	encoder.Int(1, message.Term)
+	encoder.Bytes(2, message.Block)
+}
+
+// WireVoteRequest ...
+type WireVoteRequest struct {
+	Term      int
+	Candidate int
+	LastIndex int
+	LastTerm  int
+}
+
+// EncodeWire ...
+func (message WireVoteRequest) EncodeWire(encoder *WireEncoder) {
+	encoder.Int(1, message.Term)
+	encoder.Int(2, message.Candidate)
+	encoder.Int(3, message.LastIndex)
+	encoder.Int(4, message.LastTerm)
+}
+
+// WireVoteResponse ...
+type WireVoteResponse struct {
+	Term    int
+	From    int
+	Granted bool
+}
+
+// EncodeWire ...
+func (message WireVoteResponse) EncodeWire(encoder *WireEncoder) {
+	encoder.Int(1, message.Term)
+	encoder.Int(2, message.From)
+	encoder.Bool(3, message.Granted)
+}
+
+// WireAppendRequest is a heartbeat without entries
+type WireAppendRequest struct {
+	Term         int
+	Leader       int
+	PrevIndex    int
+	PrevTerm     int
+	Entries      []WireRaftEntry
+	LeaderCommit int
+}
+
+// EncodeWire ...
+func (message WireAppendRequest) EncodeWire(encoder *WireEncoder) {
+	encoder.Int(1, message.Term)
+	encoder.Int(2, message.Leader)
+	encoder.Int(3, message.PrevIndex)
+	encoder.Int(4, message.PrevTerm)
+	for _, entry := range message.Entries {
+		encoder.Message(5, entry)
+	}
+	encoder.Int(6, message.LeaderCommit)
+}
+
+// WireAppendResponse ...
+type WireAppendResponse struct {
+	Term    int
+	From    int
+	Success bool
+	Match   int
+	Entries int
+}
+
+// EncodeWire ...
+func (message WireAppendResponse) EncodeWire(encoder *WireEncoder) {
+	encoder.Int(1, message.Term)
+	encoder.Int(2, message.From)
+	encoder.Bool(3, message.Success)
+	encoder.Int(4, message.Match)
+	encoder.Int(5, message.Entries)
+}
+
+/// Gossip
+
+// WireChannel names the only channel, as in the Fabric samples
+const WireChannel = "mychannel"
+
+// WireGossipBlock ...
+type WireGossipBlock struct {
+	Channel  string
+	Sequence int    // number of the block
+	Block    []byte // WireBlock
+}
+
+// EncodeWire ...
+func (message WireGossipBlock) EncodeWire(encoder *WireEncoder) {
+	encoder.String(1, message.Channel)
+	encoder.Int(2, message.Sequence)
+	encoder.Bytes(3, message.Block)
+}
+
+// WireGossipStateInfo is the ledger height a peer advertises, signed
+type WireGossipStateInfo struct {
+	Channel   string
+	Height    int
+	PKIID     []byte // hash of the certificate of the peer
+	Signature []byte // dac.SchnorrSignature
+}
+
+// EncodeWire ...
+func (message WireGossipStateInfo) EncodeWire(encoder *WireEncoder) {
+	encoder.String(1, message.Channel)
+	encoder.Int(2, message.Height)
+	encoder.Bytes(3, message.PKIID)
+	encoder.Bytes(4, message.Signature)
+}
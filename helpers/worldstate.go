@@ -0,0 +1,139 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// Version is the position of the transaction that last wrote a key
+type Version struct {
+	Block       int
+	Transaction int
+}
+
+// KeyRead records the version a key had when the transaction was simulated
+type KeyRead struct {
+	Key     string
+	Version Version
+	Exists  bool
+}
+
+// KeyWrite ...
+type KeyWrite struct {
+	Key   string
+	Value []byte
+}
+
+// ReadWriteSet is the outcome of simulating a transaction on an endorser
+type ReadWriteSet struct {
+	Reads  []KeyRead
+	Writes []KeyWrite
+}
+
+// Equal ...
+func (rwset ReadWriteSet) Equal(other ReadWriteSet) bool {
+	if len(rwset.Reads) != len(other.Reads) || len(rwset.Writes) != len(other.Writes) {
+		return false
+	}
+	for i, read := range rwset.Reads {
+		if read != other.Reads[i] {
+			return false
+		}
+	}
+	for i, write := range rwset.Writes {
+		if write.Key != other.Writes[i].Key || !bytes.Equal(write.Value, other.Writes[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+type versionedValue struct {
+	value   []byte
+	version Version
+}
+
+// WorldState is a peer's versioned key-value store; it is not safe for concurrent use
+type WorldState struct {
+	entries map[string]versionedValue
+}
+
+// MakeWorldState ...
+func MakeWorldState() *WorldState {
+	return &WorldState{
+		entries: make(map[string]versionedValue),
+	}
+}
+
+// Read ...
+func (state *WorldState) Read(key string) (value []byte, version Version, exists bool) {
+	entry, exists := state.entries[key]
+	return entry.value, entry.version, exists
+}
+
+// Simulate records the versions of the keys read and the values to be written, without changing the state
+func (state *WorldState) Simulate(reads []string, writes []KeyWrite) (rwset ReadWriteSet) {
+
+	for _, key := range reads {
+		_, version, exists := state.Read(key)
+		rwset.Reads = append(rwset.Reads, KeyRead{
+			Key:     key,
+			Version: version,
+			Exists:  exists,
+		})
+	}
+	rwset.Writes = append(rwset.Writes, writes...)
+
+	return
+}
+
+// Validate is the MVCC check: every key read must still have the version it was read at
+func (state *WorldState) Validate(rwset ReadWriteSet) bool {
+	for _, read := range rwset.Reads {
+		_, version, exists := state.Read(read.Key)
+		if exists != read.Exists || version != read.Version {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply commits the writes of a valid transaction
+func (state *WorldState) Apply(rwset ReadWriteSet, version Version) {
+	for _, write := range rwset.Writes {
+		state.entries[write.Key] = versionedValue{
+			value:   write.Value,
+			version: version,
+		}
+	}
+}
+
+// Size is the number of keys in the state
+func (state *WorldState) Size() int {
+	return len(state.entries)
+}
+
+// Hash digests the whole state to compare it across peers
+func (state *WorldState) Hash() []byte {
+
+	keys := make([]string, 0, len(state.entries))
+	for key := range state.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	raw := make([]byte, 0)
+	for _, key := range keys {
+		entry := state.entries[key]
+		version := make([]byte, 16)
+		binary.BigEndian.PutUint64(version[:8], uint64(entry.version.Block))
+		binary.BigEndian.PutUint64(version[8:], uint64(entry.version.Transaction))
+
+		raw = append(raw, []byte(key)...)
+		raw = append(raw, entry.value...)
+		raw = append(raw, version...)
+	}
+
+	return Sha3(raw)
+}
@@ -0,0 +1,210 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/dbogatov/fabric-amcl/amcl"
+)
+
+// MSPs, the kinds of identities users hold
+const (
+	IdemixMSP = "idemix" // anonymous credentials delegated by the organization
+	X509MSP   = "x509"   // ECDSA certificates issued by the certificate authority of the organization, as in a standard Fabric MSP
+)
+
+// ECDSA over P-256, as Fabric uses by default; keys and nonces come from the stream of the caller,
+// so that signatures, and so message sizes, are the same on every run
+
+// GenerateECDSAKey ...
+func GenerateECDSAKey(prg *amcl.RAND) (key *ecdsa.PrivateKey) {
+
+	curve := elliptic.P256()
+
+	// 8 more bytes than the order, so that the bias of the reduction is negligible
+	d := new(big.Int).SetBytes(RandomBytes(prg, curve.Params().BitSize/8+8))
+	d.Mod(d, new(big.Int).Sub(curve.Params().N, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+
+	key = &ecdsa.PrivateKey{D: d}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(d.Bytes())
+
+	return
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// SignECDSA signs the SHA-256 of the message; the signature is ASN.1, as in X.509
+func SignECDSA(prg *amcl.RAND, key *ecdsa.PrivateKey, message []byte) []byte {
+	digest := sha256.Sum256(message)
+	return signDigest(prg, key, digest[:])
+}
+
+func signDigest(prg *amcl.RAND, key *ecdsa.PrivateKey, digest []byte) []byte {
+
+	curve := key.Curve.Params()
+	e := new(big.Int).SetBytes(digest)
+
+	for {
+		k := GenerateECDSAKey(prg)
+
+		r := new(big.Int).Mod(k.X, curve.N)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = k^-1 (e + r d)
+		s := new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k.D, curve.N))
+		s.Mod(s, curve.N)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		signature, err := asn1.Marshal(ecdsaSignature{r, s})
+		if err != nil {
+			panic(err)
+		}
+		return signature
+	}
+}
+
+// VerifyECDSA ...
+func VerifyECDSA(pk *ecdsa.PublicKey, signature []byte, message []byte) error {
+
+	parsed := ecdsaSignature{}
+	if rest, e := asn1.Unmarshal(signature, &parsed); e != nil || len(rest) > 0 {
+		return fmt.Errorf("ECDSA signature is malformed")
+	}
+
+	digest := sha256.Sum256(message)
+	if !ecdsa.Verify(pk, digest[:], parsed.R, parsed.S) {
+		return fmt.Errorf("ECDSA signature is invalid")
+	}
+
+	return nil
+}
+
+// ecdsaSigner lets the x509 package sign with keys and nonces of the stream
+type ecdsaSigner struct {
+	key *ecdsa.PrivateKey
+	prg *amcl.RAND
+}
+
+func (signer ecdsaSigner) Public() crypto.PublicKey {
+	return &signer.key.PublicKey
+}
+
+func (signer ecdsaSigner) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return signDigest(signer.prg, signer.key, digest), nil
+}
+
+// certificates are valid over a fixed period, for them to be the same on every run
+var (
+	x509NotBefore = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	x509NotAfter  = x509NotBefore.AddDate(10, 0, 0)
+)
+
+// X509Authority is the certificate authority of an organization, with a self-signed certificate
+type X509Authority struct {
+	key         *ecdsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// MakeX509Authority ...
+func MakeX509Authority(prg *amcl.RAND, name string) (authority *X509Authority, e error) {
+
+	authority = &X509Authority{
+		key: GenerateECDSAKey(prg),
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          x509Serial(prg),
+		Subject:               pkix.Name{CommonName: "ca." + name, Organization: []string{name}},
+		NotBefore:             x509NotBefore,
+		NotAfter:              x509NotAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	raw, e := x509.CreateCertificate(nil, template, template, &authority.key.PublicKey, ecdsaSigner{authority.key, prg})
+	if e != nil {
+		return nil, e
+	}
+	authority.Certificate, e = x509.ParseCertificate(raw)
+
+	return
+}
+
+// MakeCertificateRequest is signed by the key it asks a certificate for
+func MakeCertificateRequest(prg *amcl.RAND, key *ecdsa.PrivateKey, name, organization string) ([]byte, error) {
+
+	template := &x509.CertificateRequest{
+		Subject:            pkix.Name{CommonName: name, Organization: []string{organization}},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+	}
+
+	return x509.CreateCertificateRequest(nil, template, ecdsaSigner{key, prg})
+}
+
+// Issue checks that the requester holds the key of the request and certifies it
+func (authority *X509Authority) Issue(prg *amcl.RAND, request []byte) (certificate []byte, e error) {
+
+	csr, e := x509.ParseCertificateRequest(request)
+	if e != nil {
+		return
+	}
+	if e = csr.CheckSignature(); e != nil {
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: x509Serial(prg),
+		Subject:      csr.Subject,
+		NotBefore:    x509NotBefore,
+		NotAfter:     x509NotAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	return x509.CreateCertificate(nil, template, authority.Certificate, csr.PublicKey, ecdsaSigner{authority.key, prg})
+}
+
+// Verify checks that the authority has issued the certificate and returns the key it certifies
+func (authority *X509Authority) Verify(certificate []byte) (pk *ecdsa.PublicKey, e error) {
+
+	parsed, e := x509.ParseCertificate(certificate)
+	if e != nil {
+		return
+	}
+	if e = parsed.CheckSignatureFrom(authority.Certificate); e != nil {
+		return
+	}
+
+	pk, ok := parsed.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate of %s does not certify an ECDSA key", parsed.Subject.CommonName)
+	}
+
+	return
+}
+
+// x509Serial is of 16 bytes and positive, as the CAs of Fabric make them
+func x509Serial(prg *amcl.RAND) *big.Int {
+	serial := RandomBytes(prg, 16)
+	serial[0] &= 0x7f
+	return new(big.Int).SetBytes(serial)
+}
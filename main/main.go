@@ -1,13 +1,13 @@
 package main
 
 import (
+	"io/ioutil"
 	"log"
 	"os"
 	"runtime"
 	"strings"
 
 	"github.com/dbogatov/dac-lib/dac"
-	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-simulator/distributed"
 	"github.com/dbogatov/fabric-simulator/helpers"
 	"github.com/dbogatov/fabric-simulator/revocation"
@@ -21,10 +21,20 @@ var logger = logging.MustGetLogger("main")
 func main() {
 
 	commonFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "scenario",
+			Value: "",
+			Usage: "YAML or JSON scenario describing the network; flags set explicitly override it",
+		},
 		&cli.IntFlag{
 			Name:  "orgs",
 			Value: 10,
-			Usage: "number of organizations (all Idemix)",
+			Usage: "number of organizations",
+		},
+		&cli.StringFlag{
+			Name:  "msp",
+			Value: helpers.IdemixMSP,
+			Usage: "identities of the users: idemix (anonymous credentials) or x509 (ECDSA certificates, the baseline)",
 		},
 		&cli.IntFlag{
 			Name:  "users",
@@ -56,6 +66,66 @@ func main() {
 			Value: 20,
 			Usage: "max wait time in seconds for a user between transactions",
 		},
+		&cli.StringFlag{
+			Name:  "arrivals",
+			Value: helpers.ClosedArrivals,
+			Usage: "how transactions arrive: closed (users wait for their transactions), open (at --rate), or bursty, diurnal and trace set in the scenario",
+		},
+		&cli.Float64Flag{
+			Name:  "rate",
+			Value: 10,
+			Usage: "transactions per second over all users for open arrivals",
+		},
+		&cli.IntFlag{
+			Name:  "keys",
+			Value: 1000,
+			Usage: "number of keys in the world state",
+		},
+		&cli.IntFlag{
+			Name:  "reads",
+			Value: 1,
+			Usage: "keys read per transaction",
+		},
+		&cli.IntFlag{
+			Name:  "writes",
+			Value: 1,
+			Usage: "keys written per transaction (the first ones read, as in read-modify-write)",
+		},
+		&cli.StringFlag{
+			Name:  "access",
+			Value: helpers.UniformAccess,
+			Usage: "how transactions pick keys: uniform, zipf or hotspot",
+		},
+		&cli.Float64Flag{
+			Name:  "zipf",
+			Value: 0.99,
+			Usage: "exponent of the zipf key access",
+		},
+		&cli.IntFlag{
+			Name:  "hot-keys",
+			Value: 10,
+			Usage: "number of hot keys of the hotspot key access",
+		},
+		&cli.Float64Flag{
+			Name:  "hot-share",
+			Value: 0.9,
+			Usage: "share of hotspot accesses that go to the hot keys",
+		},
+		&cli.StringSliceFlag{
+			Name:  "chaincode",
+			Value: cli.NewStringSlice(helpers.KeyValueChaincode),
+			Usage: "chaincode to invoke (noop, kv, kv-put, kv-get or asset-transfer); repeat to invoke several with equal weights",
+		},
+		&cli.IntFlag{
+			Name:  "chaincode-cost",
+			Value: 50,
+			Usage: "execution time (ms) of the chaincodes given on the command line",
+		},
+		&cli.StringFlag{
+			Name:  "policy",
+			Value: "",
+			Usage: "endorsement policy of the chaincodes given on the command line, e.g. \"AND('org-0.member', OR('org-1.peer', 'org-2.peer'))\"; any --endorsements peers if empty",
+		},
 		&cli.BoolFlag{
 			Name:  "revoke",
 			Value: false,
@@ -68,30 +138,112 @@ func main() {
 		},
 	}
 
-	setSystemParameters := func(c *cli.Context, prg *amcl.RAND) (sysParams *helpers.SystemParameters, rootSk, auditSk dac.SK) {
-		return helpers.MakeSystemParameters(
-			logger,
-			prg,
-			c.Int("orgs"),
-			c.Int("users"),
-			c.Int("peers"),
-			c.Int("endorsements"),
-			c.Int("epoch"),
-			c.Int("bandwidth-global"),
-			c.Int("bandwidth-local"),
-			c.Int("conc-endorsements"),
-			c.Int("conc-validations"),
-			c.Int("conc-revocations"),
-			c.Int("transactions"),
-			c.Int("frequency"),
-			c.Bool("revoke"),
-			c.Bool("audit"),
-			c.Int("rpc-port"),
-			c.String("root-address"),
-			c.String("org-address"),
-			c.String("revocation-address"),
-			c.StringSlice("peer-addresses"),
-		)
+	simulatorFlags := append(
+		commonFlags,
+		&cli.IntFlag{
+			Name:  "orderers",
+			Value: 1,
+			Usage: "number of ordering service nodes",
+		},
+		&cli.IntFlag{
+			Name:  "batch-size",
+			Value: 10,
+			Usage: "max number of transactions in a block",
+		},
+		&cli.IntFlag{
+			Name:  "batch-timeout",
+			Value: 2000,
+			Usage: "time in ms after the first transaction of a batch when the block is cut regardless of its size",
+		},
+		&cli.IntFlag{
+			Name:  "block-bytes",
+			Value: 512 * 1024,
+			Usage: "max size of a block in bytes (a bigger transaction gets a block of its own)",
+		},
+		&cli.IntFlag{
+			Name:  "raft-tick",
+			Value: 500,
+			Usage: "Raft tick interval in ms",
+		},
+		&cli.IntFlag{
+			Name:  "election-ticks",
+			Value: 10,
+			Usage: "ticks without a leader before a Raft orderer starts an election (randomized up to twice as many)",
+		},
+		&cli.IntFlag{
+			Name:  "heartbeat-ticks",
+			Value: 1,
+			Usage: "ticks between Raft leader heartbeats",
+		},
+		&cli.IntFlag{
+			Name:  "bandwidth-global",
+			Value: 1024 * 1024, // 1 MB/s
+			Usage: "global bandwidth in bytes per second",
+		},
+		&cli.IntFlag{
+			Name:  "bandwidth-local",
+			Value: 1024 * 1024 / 10, // 0.1 MB/s
+			Usage: "local bandwidth in bytes per second",
+		},
+		&cli.BoolFlag{
+			Name:  "gossip",
+			Value: false,
+			Usage: "whether a leader peer per organization pulls blocks from the orderers and gossips them to the other peers",
+		},
+		&cli.IntFlag{
+			Name:  "gossip-fanout",
+			Value: 3,
+			Usage: "number of peers of the organization a gossiping peer pushes a new block to",
+		},
+		&cli.IntFlag{
+			Name:  "gossip-pull-interval",
+			Value: 4000,
+			Usage: "time in ms between anti-entropy pulls of missing blocks from a random peer of the organization",
+		},
+		&cli.IntFlag{
+			Name:  "fault-timeout",
+			Value: 30000,
+			Usage: "time in ms a user waits for a non-revocation handle or the commits before giving up a transaction (only with faults in the scenario)",
+		},
+		&cli.IntFlag{
+			Name:  "endorsement-timeout",
+			Value: 10000,
+			Usage: "time in ms a user waits for an endorsement before asking another peer that satisfies the policy",
+		},
+		&cli.IntFlag{
+			Name:  "endorsement-attempts",
+			Value: 5,
+			Usage: "max endorsement requests a user sends per transaction, the first ones included",
+		},
+		&cli.IntFlag{
+			Name:  "conc-endorsements",
+			Value: 3,
+			Usage: "number of concurrent endorsements a peer can do",
+		},
+		&cli.IntFlag{
+			Name:  "conc-validations",
+			Value: 10,
+			Usage: "number of concurrent validations a peer can do",
+		},
+		&cli.IntFlag{
+			Name:  "conc-revocations",
+			Value: 10,
+			Usage: "number of concurrent revocations the authority can do",
+		},
+		&cli.BoolFlag{
+			Name:  "cost-model",
+			Value: false,
+			Usage: "skip real crypto operations and only charge their costs from the cost profile",
+		},
+		&cli.StringFlag{
+			Name:  "cost-profile",
+			Value: "",
+			Usage: "JSON cost profile written by calibrate that crypto events are charged from, with or without --cost-model (the built-in one if empty)",
+		},
+	)
+
+	setSystemParameters := func(c *cli.Context) (sysParams *helpers.SystemParameters, rootSk, auditSk dac.SK) {
+		return helpers.MakeSystemParameters(logger, loadScenario(c, c.Command.Name != "distributed"))
 	}
 
 	app := &cli.App{
@@ -113,7 +265,7 @@ func main() {
 			&cli.IntFlag{
 				Name:  "seed",
 				Value: 0x13,
-				Usage: "seed to use for root PK",
+				Usage: "master seed for keys, system parameters and all simulated randomness",
 			},
 		},
 		Name:        "fabric",
@@ -175,32 +327,40 @@ func main() {
 			},
 			{
 				Flags: append(
-					commonFlags,
-					&cli.IntFlag{
-						Name:  "bandwidth-global",
-						Value: 1024 * 1024, // 1 MB/s
-						Usage: "global bandwidth in bytes per second",
-					},
-					&cli.IntFlag{
-						Name:  "bandwidth-local",
-						Value: 1024 * 1024 / 10, // 0.1 MB/s
-						Usage: "local bandwidth in bytes per second",
+					append([]cli.Flag{}, simulatorFlags...),
+					&cli.StringSliceFlag{
+						Name:     "grid",
+						Required: true,
+						Usage:    "scenario parameter to sweep as path=value,value,... (e.g. workload.endorsements=1,2,3); repeat for a grid",
 					},
-					&cli.IntFlag{
-						Name:  "conc-endorsements",
-						Value: 3,
-						Usage: "number of concurrent endorsements a peer can do",
+					&cli.IntSliceFlag{
+						Name:  "seeds",
+						Usage: "seed to run every point with, repeat for several (the scenario seed if not set)",
 					},
-					&cli.IntFlag{
-						Name:  "conc-validations",
-						Value: 10,
-						Usage: "number of concurrent validations a peer can do",
+					&cli.StringFlag{
+						Name:  "output",
+						Value: "sweep.csv",
+						Usage: "file to append results to, .csv or .jsonl; points already in it are skipped",
 					},
-					&cli.IntFlag{
-						Name:  "conc-revocations",
-						Value: 10,
-						Usage: "number of concurrent revocations the authority can do",
-					}),
+				),
+				Name:  "sweep",
+				Usage: "runs the simulator over a grid of scenario parameters and writes a table of results",
+				Action: func(c *cli.Context) error {
+
+					simulator.SetLogger(logger)
+
+					log.SetOutput(ioutil.Discard) // no network log
+
+					grid, e := simulator.ParseSweepParameters(c.StringSlice("grid"))
+					if e != nil {
+						return e
+					}
+
+					return simulator.Sweep(loadScenario(c, true), grid, c.IntSlice("seeds"), c.String("output"))
+				},
+			},
+			{
+				Flags: simulatorFlags,
 				Name:  "simulator",
 				Usage: "runs Fabric Idemix simulation tracking network statistics and crypto events",
 				Action: func(c *cli.Context) error {
@@ -221,9 +381,62 @@ func main() {
 					log.SetOutput(f)
 					log.Println("[")
 
-					sys, rootSk, _ := setSystemParameters(c, helpers.NewRandSeed([]byte{byte(c.Int("seed"))}))
+					sys, rootSk, _ := setSystemParameters(c)
+
+					_, e := simulator.Simulate(rootSk, sys)
+					return e
+				},
+			},
+			{
+				Flags: simulatorFlags,
+				Name:  "compare-msp",
+				Usage: "simulates the scenario with Idemix users and with X.509 users and prints the results side by side",
+				Action: func(c *cli.Context) error {
+
+					simulator.SetLogger(logger)
+
+					log.SetOutput(ioutil.Discard) // no network log
 
-					return simulator.Simulate(rootSk, sys)
+					return simulator.CompareMSPs(loadScenario(c, true))
+				},
+			},
+			{
+				Flags: simulatorFlags,
+				Name:  "inspect-sizes",
+				Usage: "simulates the scenario with the cost model and prints the encoded size of every kind of message",
+				Action: func(c *cli.Context) error {
+
+					simulator.SetLogger(logger)
+
+					log.SetOutput(ioutil.Discard) // no network log
+
+					sys, rootSk, _ := setSystemParameters(c)
+
+					return simulator.InspectSizes(rootSk, sys)
+				},
+			},
+			{
+				Name:  "calibrate",
+				Usage: "microbenchmarks every crypto event on this host and writes a cost profile for the simulator",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "samples",
+						Value: 20,
+						Usage: "number of measurements per crypto event",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Value: "cost-profile.json",
+						Usage: "file to write the JSON cost profile to",
+					},
+				},
+				Action: func(c *cli.Context) error {
+
+					simulator.SetLogger(logger)
+
+					sys, rootSk, _ := helpers.MakeSystemParameters(logger, &helpers.Scenario{Seed: c.Int("seed")})
+
+					return simulator.Calibrate(rootSk, sys, c.Int("samples"), c.String("output"))
 				},
 			},
 			{
@@ -259,6 +472,11 @@ func main() {
 						Value: 0,
 						Usage: "if >0, this instance shall run as RPC user with given ID",
 					},
+					&cli.StringFlag{
+						Name:  "class",
+						Value: "",
+						Usage: "the class (of workload.classes in the scenario) of the RPC user; the default class if empty",
+					},
 					&cli.IntFlag{
 						Name:  "rpc-port",
 						Value: 8000,
@@ -291,8 +509,11 @@ func main() {
 
 					distributed.SetLogger(logger)
 
-					sys, rootSk, auditSk := setSystemParameters(c, helpers.NewRandSeed([]byte{byte(c.Int("seed"))}))
-					sys.Peers = len(c.StringSlice("peer-addresses"))
+					sys, rootSk, auditSk := setSystemParameters(c)
+					sys.Peers = len(sys.PeerRPCAddresses)
+					sys.Orgs, sys.Organizations = helpers.DistributedOrganizations(sys.Peers)
+					sys.ProcessClass = c.String("class")
+					sys.IndexArrivals()
 
 					return distributed.Simulate(rootSk, auditSk, sys, c.Bool("root"), c.Int("organization"), c.Int("peer"), c.Int("user"), c.Bool("revocation"), c.Bool("auditor"))
 				},
@@ -306,6 +527,154 @@ func main() {
 	}
 }
 
+// loadScenario reads the --scenario file (if any), applies the flags set explicitly
+// on the command line, fills what is still missing with flag defaults and validates the result
+func loadScenario(c *cli.Context, simulated bool) (scenario *helpers.Scenario) {
+
+	scenario = &helpers.Scenario{}
+	if path := c.String("scenario"); path != "" {
+		var e error
+		if scenario, e = helpers.LoadScenario(path); e != nil {
+			logger.Fatal(e)
+		}
+		logger.Noticef("Scenario loaded from %s", path)
+	}
+
+	// flag defaults fill only the fields the scenario leaves out, a zero it sets is kept
+	fromFlag := func(name, path string) bool {
+		return c.IsSet(name) || !scenario.Sets(path)
+	}
+
+	// topology flags make the topology uniform again
+	if c.IsSet("orgs") || c.IsSet("users") || c.IsSet("peers") || len(scenario.Topology.Organizations) == 0 {
+		topology := scenario.Topology
+		listed := len(topology.Organizations) > 0
+		if listed {
+			logger.Warning("Topology flags replace the organizations listed in the scenario")
+			topology = helpers.TopologyScenario{}
+		}
+		scenario.SetUniformTopology(topology.Orgs, topology.Users, topology.Peers)
+		ints := map[string]*int{
+			"orgs":  &scenario.Topology.Orgs,
+			"users": &scenario.Topology.Users,
+			"peers": &scenario.Topology.Peers,
+		}
+		for name, value := range ints {
+			if listed || fromFlag(name, "topology."+name) {
+				*value = c.Int(name)
+			}
+		}
+	}
+
+	ints := map[string]struct {
+		path  string
+		value *int
+	}{
+		"seed":                 {"seed", &scenario.Seed},
+		"transactions":         {"workload.transactions", &scenario.Workload.Transactions},
+		"endorsements":         {"workload.endorsements", &scenario.Workload.Endorsements},
+		"keys":                 {"workload.keys", &scenario.Workload.Keys},
+		"reads":                {"workload.reads", &scenario.Workload.Reads},
+		"writes":               {"workload.writes", &scenario.Workload.Writes},
+		"hot-keys":             {"workload.hot-keys", &scenario.Workload.HotKeys},
+		"orderers":             {"ordering.orderers", &scenario.Ordering.Orderers},
+		"batch-size":           {"ordering.batch-size", &scenario.Ordering.BatchSize},
+		"batch-timeout":        {"ordering.batch-timeout", &scenario.Ordering.BatchTimeout},
+		"block-bytes":          {"ordering.max-block-bytes", &scenario.Ordering.MaxBlockBytes},
+		"raft-tick":            {"ordering.tick", &scenario.Ordering.Tick},
+		"election-ticks":       {"ordering.election-ticks", &scenario.Ordering.ElectionTicks},
+		"heartbeat-ticks":      {"ordering.heartbeat-ticks", &scenario.Ordering.HeartbeatTicks},
+		"bandwidth-global":     {"bandwidth.global", &scenario.Bandwidth.Global},
+		"bandwidth-local":      {"bandwidth.local", &scenario.Bandwidth.Local},
+		"gossip-fanout":        {"gossip.fanout", &scenario.Gossip.Fanout},
+		"gossip-pull-interval": {"gossip.pull-interval", &scenario.Gossip.PullInterval},
+		"fault-timeout":        {"faults.timeout", &scenario.Faults.Timeout},
+		"endorsement-timeout":  {"client.endorsement-timeout", &scenario.Client.EndorsementTimeout},
+		"endorsement-attempts": {"client.attempts", &scenario.Client.Attempts},
+		"conc-endorsements":    {"concurrency.endorsements", &scenario.Concurrency.Endorsements},
+		"conc-validations":     {"concurrency.validations", &scenario.Concurrency.Validations},
+		"conc-revocations":     {"concurrency.revocations", &scenario.Concurrency.Revocations},
+		"epoch":                {"revocation.epoch", &scenario.Revocation.Epoch},
+		"rpc-port":             {"rpc.port", &scenario.RPC.Port},
+	}
+	for name, field := range ints {
+		if fromFlag(name, field.path) {
+			*field.value = c.Int(name)
+		}
+	}
+
+	if fromFlag("frequency", "workload.frequency") || scenario.Workload.Frequency == nil {
+		frequency := c.Int("frequency")
+		scenario.Workload.Frequency = &frequency
+	}
+
+	floats := map[string]struct {
+		path  string
+		value *float64
+	}{
+		"zipf":      {"workload.zipf", &scenario.Workload.Zipf},
+		"hot-share": {"workload.hot-share", &scenario.Workload.HotShare},
+		"rate":      {"workload.arrivals.rate", &scenario.Workload.Arrivals.Rate},
+	}
+	for name, field := range floats {
+		if fromFlag(name, field.path) {
+			*field.value = c.Float64(name)
+		}
+	}
+
+	texts := map[string]struct {
+		path  string
+		value *string
+	}{
+		"access":             {"workload.access", &scenario.Workload.Access},
+		"arrivals":           {"workload.arrivals.pattern", &scenario.Workload.Arrivals.Pattern},
+		"msp":                {"crypto.msp", &scenario.Crypto.MSP},
+		"cost-profile":       {"crypto.cost-profile", &scenario.Crypto.CostProfile},
+		"root-address":       {"rpc.root", &scenario.RPC.Root},
+		"org-address":        {"rpc.organization", &scenario.RPC.Organization},
+		"revocation-address": {"rpc.revocation", &scenario.RPC.Revocation},
+	}
+	for name, field := range texts {
+		if fromFlag(name, field.path) {
+			*field.value = c.String(name)
+		}
+	}
+
+	// booleans default to false, so only explicit flags override
+	bools := map[string]*bool{
+		"revoke":     &scenario.Revocation.Enabled,
+		"audit":      &scenario.Audit.Enabled,
+		"cost-model": &scenario.Crypto.CostModel,
+		"gossip":     &scenario.Gossip.Enabled,
+	}
+	for name, value := range bools {
+		if c.IsSet(name) {
+			*value = c.Bool(name)
+		}
+	}
+
+	if c.IsSet("chaincode") || c.IsSet("chaincode-cost") || c.IsSet("policy") || len(scenario.Workload.Chaincodes) == 0 {
+		scenario.Workload.Chaincodes = make([]helpers.ChaincodeScenario, 0)
+		for _, name := range c.StringSlice("chaincode") {
+			scenario.Workload.Chaincodes = append(scenario.Workload.Chaincodes, helpers.ChaincodeScenario{
+				Name:   name,
+				Cost:   helpers.CostScenario{Mean: c.Int("chaincode-cost")},
+				Policy: c.String("policy"),
+			})
+		}
+	}
+
+	if c.IsSet("peer-addresses") || len(scenario.RPC.Peers) == 0 {
+		scenario.RPC.Peers = c.StringSlice("peer-addresses")
+	}
+
+	if e := scenario.Validate(simulated); e != nil {
+		logger.Fatal(e)
+	}
+
+	return
+}
+
 func configureLogging(verbose string) {
 	logging.SetFormatter(
 		logging.MustStringFormatter(`%{color}%{time:15:04:05.000} %{shortfunc:22s} ▶ %{level:8s} %{id:03x}%{color:reset} |	 %{message}`),
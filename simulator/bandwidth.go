@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-simulator/helpers"
 )
 
 type transferable interface {
@@ -14,60 +15,37 @@ type transferable interface {
 	name() string
 }
 
-// CertificateSize ...
-const CertificateSize = 734 // TODO http://fm4dd.com/openssl/certexamples.shtm
-
-var globalBandwidthLock = &sync.Mutex{}
 var bandwidthLoggingLock = &sync.Mutex{}
-var getLocksLock = &sync.Mutex{}
 var networkEventID uint64 = 1
 
-var connectionsMap = make(map[string]*sync.Mutex)
-
+// recordBandwidth pushes the object through the uplink of the sender, the link of the route and the downlink
+// of the receiver at once, sharing each with the other messages on it, then waits for the latency of the route
 func recordBandwidth(from, to string, object transferable) {
 
-	getLocks := func(key string) *sync.Mutex {
-		getLocksLock.Lock()
-		defer getLocksLock.Unlock()
-
-		lock, exists := connectionsMap[key]
-		if !exists {
-			lock = &sync.Mutex{}
-			connectionsMap[key] = lock
-		}
-		return lock
-	}
-
-	getWaitTime := func(bandwidth int) time.Duration {
-		return time.Duration(1000*(float64(object.size())/float64(bandwidth))) * time.Millisecond
-	}
+	scheduler := execParams.scheduler
+	flows := execParams.flows
 
-	fromLock := getLocks(from)
-	toLock := getLocks(to)
+	size := object.size()
 
-	var wg sync.WaitGroup
-	wg.Add(3)
+	route := sysParams.Route(from, to)
 
-	spinWait := func(lock *sync.Mutex, waitTime time.Duration) {
-		defer wg.Done()
-
-		lock.Lock()
-		defer lock.Unlock()
-
-		time.Sleep(waitTime)
+	// without regions an actor sends and receives over the same local link
+	uplink := flows.link(from, route.Uplink)
+	downlink := flows.link(to, route.Downlink)
+	if route.Duplex {
+		uplink = flows.link(from+"/up", route.Uplink)
+		downlink = flows.link(to+"/down", route.Downlink)
 	}
 
-	waitTimeGlobal := getWaitTime(sysParams.BandwidthGlobal)
-	waitTimeLocal := getWaitTime(sysParams.BandwidthLocal)
-	start := time.Now()
+	start := scheduler.Now()
 
-	go spinWait(fromLock, waitTimeLocal)
-	go spinWait(toLock, waitTimeLocal)
-	go spinWait(globalBandwidthLock, waitTimeGlobal)
+	flows.transfer(size, uplink, downlink, flows.link(route.Link, route.Bandwidth))
 
-	wg.Wait()
+	if route.Latency > 0 {
+		scheduler.Sleep(route.Latency)
+	}
 
-	end := time.Now()
+	end := scheduler.Now()
 
 	bandwidthLoggingLock.Lock()
 
@@ -75,11 +53,12 @@ func recordBandwidth(from, to string, object transferable) {
 		From:            from,
 		To:              to,
 		Object:          object.name(),
-		Size:            object.size(),
+		Size:            size,
 		Start:           start.Format(time.RFC3339Nano),
 		End:             end.Format(time.RFC3339Nano),
-		LocalBandwidth:  sysParams.BandwidthLocal,
-		GlobalBandwidth: sysParams.BandwidthGlobal,
+		LocalBandwidth:  route.Uplink,
+		GlobalBandwidth: route.Bandwidth,
+		Latency:         int(route.Latency.Milliseconds()),
 		ID:              networkEventID,
 	})
 	if err != nil {
@@ -87,9 +66,12 @@ func recordBandwidth(from, to string, object transferable) {
 	}
 	log.Printf("%s,\n", string(event))
 
-	logger.Debugf("%s sent %d bytes of %s to %s\n", from, object.size(), object.name(), to)
+	logger.Debugf("%s sent %d bytes of %s to %s\n", from, size, object.name(), to)
 
 	networkEventID++
+	execParams.messages++
+	execParams.bytes += size
+	execParams.sizes.add(object.name(), size)
 
 	bandwidthLoggingLock.Unlock()
 }
@@ -102,8 +84,9 @@ type NetworkEvent struct {
 	Size            int
 	Start           string
 	End             string
-	GlobalBandwidth int
-	LocalBandwidth  int
+	GlobalBandwidth int // of the link between the regions
+	LocalBandwidth  int // of the uplink of the sender
+	Latency         int `json:",omitempty"` // ms, included in the end
 	ID              uint64
 }
 
@@ -115,7 +98,7 @@ type Credentials struct {
 }
 
 func (creds Credentials) size() int {
-	return len(creds.ToBytes())
+	return helpers.EncodedSize(helpers.WireCredentials{Credentials: creds.ToBytes()})
 }
 
 func (creds Credentials) name() string {
@@ -127,10 +110,11 @@ func (creds Credentials) name() string {
 // CredRequest ...
 type CredRequest struct {
 	*dac.CredRequest
+	id int // of the requester
 }
 
 func (credReq CredRequest) size() int {
-	return len(credReq.ToBytes())
+	return helpers.EncodedSize(helpers.WireCredRequest{Request: credReq.ToBytes(), ID: credReq.id})
 }
 
 func (credReq CredRequest) name() string {
@@ -145,9 +129,37 @@ type Nonce struct {
 }
 
 func (nonce Nonce) size() int {
-	return len(nonce.bytes)
+	return helpers.EncodedSize(helpers.WireNonce{Nonce: nonce.bytes})
 }
 
 func (nonce Nonce) name() string {
 	return "nonce"
 }
+
+/// X.509
+
+// CertificateRequest is a PKCS #10 request of a user to the certificate authority of its organization
+type CertificateRequest struct {
+	request []byte
+}
+
+func (request CertificateRequest) size() int {
+	return helpers.EncodedSize(helpers.WireX509CertificateRequest{Request: request.request})
+}
+
+func (request CertificateRequest) name() string {
+	return "certificate-request"
+}
+
+// X509Certificate ...
+type X509Certificate struct {
+	certificate []byte
+}
+
+func (certificate X509Certificate) size() int {
+	return helpers.EncodedSize(helpers.WireX509Certificate{Certificate: certificate.certificate})
+}
+
+func (certificate X509Certificate) name() string {
+	return "x509-certificate"
+}
@@ -0,0 +1,71 @@
+package simulator
+
+import (
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// misbehaves decides whether a Byzantine peer shows the behaviour this time; honest peers never draw
+func (peer *Peer) misbehaves(behaviour string) bool {
+	for _, byzantine := range peer.byzantine {
+		if byzantine.Behaviour != behaviour {
+			continue
+		}
+		if byzantine.Share >= 1 || float64(helpers.RandomULong(peer.byzantinePrg)%1000000) < byzantine.Share*1000000 {
+			return true
+		}
+	}
+	return false
+}
+
+// tamper is the proposal the peer simulates: the real one, or the one with other keys
+func (peer *Peer) tamper(tp *TransactionProposal) *TransactionProposal {
+
+	if !peer.misbehaves(helpers.TamperedProposal) {
+		return tp
+	}
+
+	tampered := *tp
+	tampered.keys = execParams.keySpace.Choose(peer.byzantinePrg, len(tp.keys))
+	logger.Debugf("peer-%d simulates a tampered proposal of user-%d", peer.id, tp.authorID)
+
+	return &tampered
+}
+
+// sign endorses the outcome; a Byzantine peer may sign with a key nobody has certified or show a forged certificate
+func (peer *Peer) sign(tp *TransactionProposal, rwset helpers.ReadWriteSet) (endorsement Endorsement) {
+
+	endorsement = Endorsement{
+		endorser:    peer.id,
+		certificate: peer.certificate,
+		rwset:       rwset,
+	}
+
+	if peer.misbehaves(helpers.WrongKey) {
+		endorsement.signature = forgeSchnorrMessage(peer.byzantinePrg, tp.getMessage())
+	} else {
+		endorsement.signature = signSchnorrMessage(peer.prg, peer.sk, tp.getMessage())
+	}
+
+	if peer.misbehaves(helpers.ForgedEndorsement) {
+		endorsement.certificate = peer.forgedCertificate(peer.byzantinePrg)
+	}
+
+	return
+}
+
+// replay submits transactions the peer has just committed to the orderers again;
+// replays have no user waiting for them and are not replayed themselves
+func (peer *Peer) replay(block *Block) {
+	for _, tx := range block.transactions {
+		if tx.replayedBy != "" || !peer.misbehaves(helpers.Replay) {
+			continue
+		}
+
+		replayed := *tx
+		replayed.replayedBy = peer.name()
+		replayed.doneChannel = nil
+		logger.Debugf("peer-%d replays a transaction of user-%d", peer.id, tx.proposal.authorID)
+
+		execParams.network.liveOrderer(peer.id).transactionChannel.Put(&replayed)
+	}
+}
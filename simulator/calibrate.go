@@ -0,0 +1,224 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// CalibrationPercentiles are the percentiles written for every event
+var CalibrationPercentiles = []float64{0, 1, 5, 10, 25, 50, 75, 90, 95, 99, 100}
+
+// Calibrate microbenchmarks every crypto event on this host and writes the cost profile
+func Calibrate(rootSk dac.SK, params *helpers.SystemParameters, samples int, output string) (e error) {
+
+	sysParams = *params
+
+	if samples < 2 {
+		return fmt.Errorf("need at least 2 samples per event, got %d", samples)
+	}
+
+	prg := helpers.NewRandDerived(sysParams.Seed, "calibrate")
+
+	auditSk, auditPk := dac.GenerateKeys(prg, userLevel)
+	templates := makeCryptoTemplates(prg, rootSk, auditPk)
+
+	org := templates.levels[orgLevel]
+	user := templates.levels[userLevel]
+	indices := identityIndices(user.credentials)
+	message := helpers.RandomBytes(prg, 256)
+	schnorr := dac.MakeSchnorr(prg, false)
+	peerSk, peerPk := dac.GenerateKeys(prg, 0)
+	endorsement := schnorr.Sign(peerSk, message)
+	orgSchnorr := dac.MakeSchnorr(prg, true)
+	certificate := orgSchnorr.Sign(org.sk, message)
+	epoch := FP256BN.NewBIGint(1)
+	ecdsaKey := helpers.GenerateECDSAKey(prg)
+	ecdsaSignature := helpers.SignECDSA(prg, ecdsaKey, message)
+
+	check := func(e error) {
+		if e != nil {
+			panic(e)
+		}
+	}
+
+	benchmarks := []struct {
+		event     CryptoEvent
+		level     int
+		operation func()
+	}{
+		{credDelegation, orgLevel, func() {
+			credentials := dac.MakeCredentials(sysParams.RootPk)
+			check(credentials.Delegate(rootSk, org.pk, dac.ProduceAttributes(orgLevel, "org-0", "has-right-to-post"), prg, sysParams.Ys))
+		}},
+		{credDelegation, userLevel, func() {
+			credentials := dac.CredentialsFromBytes(org.credentials.ToBytes())
+			check(credentials.Delegate(org.sk, user.pk, dac.ProduceAttributes(userLevel, "user-0", "has-right-to-post"), prg, sysParams.Ys))
+		}},
+		{credProve, userLevel, func() {
+			_, e := user.credentials.Prove(prg, user.sk, sysParams.RootPk, indices, []byte{}, sysParams.Ys, sysParams.H, templates.skNym)
+			check(e)
+		}},
+		{credVerify, userLevel, func() {
+			check(dac.ProofFromBytes(templates.proof).VerifyProof(sysParams.RootPk, sysParams.Ys, sysParams.H, templates.pkNym, indices, []byte{}))
+		}},
+
+		{nonRevokeGrant, 0, func() {
+			dac.SignNonRevoke(prg, templates.revocationAuthority.sk, templates.revocationPk, epoch, sysParams.Ys[1])
+		}},
+		{nonRevokeProve, 0, func() {
+			dac.RevocationProve(prg, templates.nonRevocationHandle, user.sk, templates.skNym, epoch, sysParams.H, sysParams.Ys[0])
+		}},
+		{nonRevokeVerify, 0, func() {
+			check(templates.nonRevocationProof.Verify(templates.pkNym, epoch, sysParams.H, templates.revocationAuthority.pk, sysParams.Ys[1]))
+		}},
+
+		{auditEncrypt, 0, func() {
+			dac.AuditingEncrypt(prg, auditPk, user.pk)
+		}},
+		{auditDecrypt, 0, func() {
+			if !dac.PkEqual(templates.auditEnc.AuditingDecrypt(auditSk), user.pk) {
+				panic("auditing failed")
+			}
+		}},
+		{auditProve, 0, func() {
+			dac.AuditingProve(prg, templates.auditEnc, user.pk, user.sk, templates.pkNym, templates.skNym, auditPk, templates.auditR, sysParams.H)
+		}},
+		{auditVerify, 0, func() {
+			check(templates.auditProof.Verify(templates.auditEnc, templates.pkNym, auditPk, sysParams.H))
+		}},
+
+		{sha3hash, 0, func() {
+			helpers.Sha3(templates.proof)
+		}},
+
+		{signNym, 0, func() {
+			dac.SignNym(prg, templates.pkNym, templates.skNym, user.sk, sysParams.H, message)
+		}},
+		{verifyNym, 0, func() {
+			check(templates.nymSignature.VerifyNym(sysParams.H, templates.pkNym, []byte("template")))
+		}},
+
+		{signSchnorr, 0, func() {
+			schnorr.Sign(peerSk, message)
+		}},
+		{verifySchnorr, 0, func() {
+			check(schnorr.Verify(peerPk, endorsement, message))
+		}},
+		{signSchnorr, orgLevel, func() {
+			orgSchnorr.Sign(org.sk, message)
+		}},
+		{verifySchnorr, orgLevel, func() {
+			check(orgSchnorr.Verify(org.pk, certificate, message))
+		}},
+
+		{signECDSA, 0, func() {
+			helpers.SignECDSA(prg, ecdsaKey, message)
+		}},
+		{verifyECDSA, 0, func() {
+			check(helpers.VerifyECDSA(&ecdsaKey.PublicKey, ecdsaSignature, message))
+		}},
+	}
+
+	host, _ := os.Hostname()
+	profile := &CostProfile{
+		Version:    CostProfileVersion,
+		Host:       host,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Created:    time.Now().Format(time.RFC3339),
+		Attributes: 2,
+		YsNum:      helpers.YsNum,
+		Events:     make([]EventCost, 0, len(benchmarks)),
+	}
+
+	for _, benchmark := range benchmarks {
+
+		benchmark.operation() // warm-up
+
+		durations := make([]time.Duration, samples)
+		for i := 0; i < samples; i++ {
+			start := time.Now()
+			benchmark.operation()
+			durations[i] = time.Since(start)
+		}
+
+		cost := summarize(benchmark.event, benchmark.level, durations)
+		profile.Events = append(profile.Events, cost)
+
+		logger.Noticef("%-20s (level %d) : mean %9.3f ms, median %9.3f ms", cost.Event, cost.Level, milliseconds(cost.Mean), milliseconds(percentile(durations, 50)))
+	}
+
+	if e = profile.Validate(); e != nil {
+		return
+	}
+
+	if e = profile.Save(output); e != nil {
+		return
+	}
+
+	logger.Noticef("Cost profile written to %s", output)
+
+	return
+}
+
+func summarize(event CryptoEvent, level int, durations []time.Duration) (cost EventCost) {
+
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+
+	var total float64
+	for _, duration := range durations {
+		total += float64(duration)
+	}
+	mean := total / float64(len(durations))
+
+	var squares float64
+	for _, duration := range durations {
+		squares += (float64(duration) - mean) * (float64(duration) - mean)
+	}
+
+	cost = EventCost{
+		Event: event,
+		Level: level,
+		DurationDistribution: helpers.DurationDistribution{
+			Distribution: helpers.EmpiricalDistribution,
+			Samples:      len(durations),
+			Mean:         time.Duration(mean),
+			StdDev:       time.Duration(math.Sqrt(squares / float64(len(durations)-1))),
+			Min:          durations[0],
+			Max:          durations[len(durations)-1],
+			Percentiles:  make([]helpers.Percentile, 0, len(CalibrationPercentiles)),
+		},
+	}
+
+	for _, p := range CalibrationPercentiles {
+		cost.Percentiles = append(cost.Percentiles, helpers.Percentile{
+			Percentile: p,
+			Duration:   percentile(durations, p),
+		})
+	}
+
+	return
+}
+
+// linear interpolation between closest ranks; durations must be sorted
+func percentile(durations []time.Duration, p float64) time.Duration {
+
+	rank := p / 100 * float64(len(durations)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	return durations[lower] + time.Duration((rank-float64(lower))*float64(durations[upper]-durations[lower]))
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -0,0 +1,1133 @@
+package simulator
+
+// calibratedCostProfile is the profile "calibrate --samples 50" wrote on the host it names, as is
+const calibratedCostProfile = `{
+	"Version": 1,
+	"Host": "vm",
+	"GOMAXPROCS": 1,
+	"Created": "2026-10-18T07:34:49Z",
+	"Attributes": 2,
+	"YsNum": 10,
+	"Events": [
+		{
+			"Event": "cred-delegate",
+			"Level": 1,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 33143378,
+			"StdDev": 3064887,
+			"Min": 28632621,
+			"Max": 44213739,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 28632621
+				},
+				{
+					"Percentile": 1,
+					"Duration": 28757143
+				},
+				{
+					"Percentile": 5,
+					"Duration": 28992617
+				},
+				{
+					"Percentile": 10,
+					"Duration": 29575420
+				},
+				{
+					"Percentile": 25,
+					"Duration": 31061443
+				},
+				{
+					"Percentile": 50,
+					"Duration": 32815032
+				},
+				{
+					"Percentile": 75,
+					"Duration": 34652975
+				},
+				{
+					"Percentile": 90,
+					"Duration": 36375748
+				},
+				{
+					"Percentile": 95,
+					"Duration": 38344509
+				},
+				{
+					"Percentile": 99,
+					"Duration": 41695659
+				},
+				{
+					"Percentile": 100,
+					"Duration": 44213739
+				}
+			]
+		},
+		{
+			"Event": "cred-delegate",
+			"Level": 2,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 71488645,
+			"StdDev": 9279380,
+			"Min": 43853066,
+			"Max": 83803156,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 43853066
+				},
+				{
+					"Percentile": 1,
+					"Duration": 45927305
+				},
+				{
+					"Percentile": 5,
+					"Duration": 52124757
+				},
+				{
+					"Percentile": 10,
+					"Duration": 55164596
+				},
+				{
+					"Percentile": 25,
+					"Duration": 68054928
+				},
+				{
+					"Percentile": 50,
+					"Duration": 73843217
+				},
+				{
+					"Percentile": 75,
+					"Duration": 77324217
+				},
+				{
+					"Percentile": 90,
+					"Duration": 80451250
+				},
+				{
+					"Percentile": 95,
+					"Duration": 81564112
+				},
+				{
+					"Percentile": 99,
+					"Duration": 83123108
+				},
+				{
+					"Percentile": 100,
+					"Duration": 83803156
+				}
+			]
+		},
+		{
+			"Event": "cred-prove",
+			"Level": 2,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 432504608,
+			"StdDev": 31363036,
+			"Min": 316964841,
+			"Max": 491117347,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 316964841
+				},
+				{
+					"Percentile": 1,
+					"Duration": 327084245
+				},
+				{
+					"Percentile": 5,
+					"Duration": 373496443
+				},
+				{
+					"Percentile": 10,
+					"Duration": 396480214
+				},
+				{
+					"Percentile": 25,
+					"Duration": 427284145
+				},
+				{
+					"Percentile": 50,
+					"Duration": 437235381
+				},
+				{
+					"Percentile": 75,
+					"Duration": 445408866
+				},
+				{
+					"Percentile": 90,
+					"Duration": 456652941
+				},
+				{
+					"Percentile": 95,
+					"Duration": 478410143
+				},
+				{
+					"Percentile": 99,
+					"Duration": 488713030
+				},
+				{
+					"Percentile": 100,
+					"Duration": 491117347
+				}
+			]
+		},
+		{
+			"Event": "cred-verify",
+			"Level": 2,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 369183684,
+			"StdDev": 24972563,
+			"Min": 291916544,
+			"Max": 422701921,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 291916544
+				},
+				{
+					"Percentile": 1,
+					"Duration": 309614771
+				},
+				{
+					"Percentile": 5,
+					"Duration": 332908310
+				},
+				{
+					"Percentile": 10,
+					"Duration": 353503848
+				},
+				{
+					"Percentile": 25,
+					"Duration": 358964406
+				},
+				{
+					"Percentile": 50,
+					"Duration": 361795158
+				},
+				{
+					"Percentile": 75,
+					"Duration": 379621598
+				},
+				{
+					"Percentile": 90,
+					"Duration": 406705492
+				},
+				{
+					"Percentile": 95,
+					"Duration": 417235827
+				},
+				{
+					"Percentile": 99,
+					"Duration": 420917356
+				},
+				{
+					"Percentile": 100,
+					"Duration": 422701921
+				}
+			]
+		},
+		{
+			"Event": "non-revoke-grant",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 22738902,
+			"StdDev": 1695239,
+			"Min": 20655401,
+			"Max": 30131624,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 20655401
+				},
+				{
+					"Percentile": 1,
+					"Duration": 20753792
+				},
+				{
+					"Percentile": 5,
+					"Duration": 21028391
+				},
+				{
+					"Percentile": 10,
+					"Duration": 21328256
+				},
+				{
+					"Percentile": 25,
+					"Duration": 21783762
+				},
+				{
+					"Percentile": 50,
+					"Duration": 22453010
+				},
+				{
+					"Percentile": 75,
+					"Duration": 23160554
+				},
+				{
+					"Percentile": 90,
+					"Duration": 23635517
+				},
+				{
+					"Percentile": 95,
+					"Duration": 25227652
+				},
+				{
+					"Percentile": 99,
+					"Duration": 29493191
+				},
+				{
+					"Percentile": 100,
+					"Duration": 30131624
+				}
+			]
+		},
+		{
+			"Event": "non-revoke-prove",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 90539729,
+			"StdDev": 13049182,
+			"Min": 64440276,
+			"Max": 115645997,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 64440276
+				},
+				{
+					"Percentile": 1,
+					"Duration": 64953127
+				},
+				{
+					"Percentile": 5,
+					"Duration": 67587083
+				},
+				{
+					"Percentile": 10,
+					"Duration": 72159931
+				},
+				{
+					"Percentile": 25,
+					"Duration": 82657647
+				},
+				{
+					"Percentile": 50,
+					"Duration": 91160361
+				},
+				{
+					"Percentile": 75,
+					"Duration": 100768033
+				},
+				{
+					"Percentile": 90,
+					"Duration": 105324100
+				},
+				{
+					"Percentile": 95,
+					"Duration": 108620610
+				},
+				{
+					"Percentile": 99,
+					"Duration": 114647850
+				},
+				{
+					"Percentile": 100,
+					"Duration": 115645997
+				}
+			]
+		},
+		{
+			"Event": "non-revoke-verify",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 177725261,
+			"StdDev": 28513095,
+			"Min": 128936478,
+			"Max": 210662368,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 128936478
+				},
+				{
+					"Percentile": 1,
+					"Duration": 129216352
+				},
+				{
+					"Percentile": 5,
+					"Duration": 130911480
+				},
+				{
+					"Percentile": 10,
+					"Duration": 132430004
+				},
+				{
+					"Percentile": 25,
+					"Duration": 148436398
+				},
+				{
+					"Percentile": 50,
+					"Duration": 190607273
+				},
+				{
+					"Percentile": 75,
+					"Duration": 201913044
+				},
+				{
+					"Percentile": 90,
+					"Duration": 206259420
+				},
+				{
+					"Percentile": 95,
+					"Duration": 208854320
+				},
+				{
+					"Percentile": 99,
+					"Duration": 210168415
+				},
+				{
+					"Percentile": 100,
+					"Duration": 210662368
+				}
+			]
+		},
+		{
+			"Event": "audit-enc",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 10186751,
+			"StdDev": 3046256,
+			"Min": 6973581,
+			"Max": 15976278,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 6973581
+				},
+				{
+					"Percentile": 1,
+					"Duration": 7000138
+				},
+				{
+					"Percentile": 5,
+					"Duration": 7232639
+				},
+				{
+					"Percentile": 10,
+					"Duration": 7352766
+				},
+				{
+					"Percentile": 25,
+					"Duration": 7704018
+				},
+				{
+					"Percentile": 50,
+					"Duration": 8733206
+				},
+				{
+					"Percentile": 75,
+					"Duration": 13150929
+				},
+				{
+					"Percentile": 90,
+					"Duration": 15182782
+				},
+				{
+					"Percentile": 95,
+					"Duration": 15543639
+				},
+				{
+					"Percentile": 99,
+					"Duration": 15845867
+				},
+				{
+					"Percentile": 100,
+					"Duration": 15976278
+				}
+			]
+		},
+		{
+			"Event": "audit-dec",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 5951225,
+			"StdDev": 1438762,
+			"Min": 3455415,
+			"Max": 8461748,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 3455415
+				},
+				{
+					"Percentile": 1,
+					"Duration": 3473041
+				},
+				{
+					"Percentile": 5,
+					"Duration": 3514656
+				},
+				{
+					"Percentile": 10,
+					"Duration": 3901962
+				},
+				{
+					"Percentile": 25,
+					"Duration": 4558998
+				},
+				{
+					"Percentile": 50,
+					"Duration": 6320570
+				},
+				{
+					"Percentile": 75,
+					"Duration": 7068391
+				},
+				{
+					"Percentile": 90,
+					"Duration": 7698778
+				},
+				{
+					"Percentile": 95,
+					"Duration": 7868260
+				},
+				{
+					"Percentile": 99,
+					"Duration": 8182851
+				},
+				{
+					"Percentile": 100,
+					"Duration": 8461748
+				}
+			]
+		},
+		{
+			"Event": "audit-prove",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 34883887,
+			"StdDev": 5487547,
+			"Min": 20751153,
+			"Max": 42712335,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 20751153
+				},
+				{
+					"Percentile": 1,
+					"Duration": 22421662
+				},
+				{
+					"Percentile": 5,
+					"Duration": 25371343
+				},
+				{
+					"Percentile": 10,
+					"Duration": 26889910
+				},
+				{
+					"Percentile": 25,
+					"Duration": 32349225
+				},
+				{
+					"Percentile": 50,
+					"Duration": 35627693
+				},
+				{
+					"Percentile": 75,
+					"Duration": 38925188
+				},
+				{
+					"Percentile": 90,
+					"Duration": 41047210
+				},
+				{
+					"Percentile": 95,
+					"Duration": 41637332
+				},
+				{
+					"Percentile": 99,
+					"Duration": 42329119
+				},
+				{
+					"Percentile": 100,
+					"Duration": 42712335
+				}
+			]
+		},
+		{
+			"Event": "audit-verify",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 60881285,
+			"StdDev": 3359488,
+			"Min": 53794388,
+			"Max": 69580287,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 53794388
+				},
+				{
+					"Percentile": 1,
+					"Duration": 54332122
+				},
+				{
+					"Percentile": 5,
+					"Duration": 55377834
+				},
+				{
+					"Percentile": 10,
+					"Duration": 56379536
+				},
+				{
+					"Percentile": 25,
+					"Duration": 58617358
+				},
+				{
+					"Percentile": 50,
+					"Duration": 61194564
+				},
+				{
+					"Percentile": 75,
+					"Duration": 63218473
+				},
+				{
+					"Percentile": 90,
+					"Duration": 64654849
+				},
+				{
+					"Percentile": 95,
+					"Duration": 65694060
+				},
+				{
+					"Percentile": 99,
+					"Duration": 67943427
+				},
+				{
+					"Percentile": 100,
+					"Duration": 69580287
+				}
+			]
+		},
+		{
+			"Event": "hash",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 68273,
+			"StdDev": 5506,
+			"Min": 54643,
+			"Max": 93979,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 54643
+				},
+				{
+					"Percentile": 1,
+					"Duration": 56746
+				},
+				{
+					"Percentile": 5,
+					"Duration": 62673
+				},
+				{
+					"Percentile": 10,
+					"Duration": 65262
+				},
+				{
+					"Percentile": 25,
+					"Duration": 67195
+				},
+				{
+					"Percentile": 50,
+					"Duration": 67976
+				},
+				{
+					"Percentile": 75,
+					"Duration": 68810
+				},
+				{
+					"Percentile": 90,
+					"Duration": 69407
+				},
+				{
+					"Percentile": 95,
+					"Duration": 71524
+				},
+				{
+					"Percentile": 99,
+					"Duration": 91247
+				},
+				{
+					"Percentile": 100,
+					"Duration": 93979
+				}
+			]
+		},
+		{
+			"Event": "sign-nym",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 15897993,
+			"StdDev": 2159639,
+			"Min": 13719140,
+			"Max": 28930601,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 13719140
+				},
+				{
+					"Percentile": 1,
+					"Duration": 13720687
+				},
+				{
+					"Percentile": 5,
+					"Duration": 14144126
+				},
+				{
+					"Percentile": 10,
+					"Duration": 14359802
+				},
+				{
+					"Percentile": 25,
+					"Duration": 14910370
+				},
+				{
+					"Percentile": 50,
+					"Duration": 15569078
+				},
+				{
+					"Percentile": 75,
+					"Duration": 16423365
+				},
+				{
+					"Percentile": 90,
+					"Duration": 17137292
+				},
+				{
+					"Percentile": 95,
+					"Duration": 17725441
+				},
+				{
+					"Percentile": 99,
+					"Duration": 23698387
+				},
+				{
+					"Percentile": 100,
+					"Duration": 28930601
+				}
+			]
+		},
+		{
+			"Event": "verify-nym",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 22698172,
+			"StdDev": 1174199,
+			"Min": 20374997,
+			"Max": 25959674,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 20374997
+				},
+				{
+					"Percentile": 1,
+					"Duration": 20642606
+				},
+				{
+					"Percentile": 5,
+					"Duration": 21067310
+				},
+				{
+					"Percentile": 10,
+					"Duration": 21278854
+				},
+				{
+					"Percentile": 25,
+					"Duration": 21904037
+				},
+				{
+					"Percentile": 50,
+					"Duration": 22747216
+				},
+				{
+					"Percentile": 75,
+					"Duration": 23284801
+				},
+				{
+					"Percentile": 90,
+					"Duration": 24109735
+				},
+				{
+					"Percentile": 95,
+					"Duration": 24778445
+				},
+				{
+					"Percentile": 99,
+					"Duration": 25848091
+				},
+				{
+					"Percentile": 100,
+					"Duration": 25959674
+				}
+			]
+		},
+		{
+			"Event": "sign-schnorr",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 7349816,
+			"StdDev": 697940,
+			"Min": 5691250,
+			"Max": 9015361,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 5691250
+				},
+				{
+					"Percentile": 1,
+					"Duration": 5934263
+				},
+				{
+					"Percentile": 5,
+					"Duration": 6332275
+				},
+				{
+					"Percentile": 10,
+					"Duration": 6511538
+				},
+				{
+					"Percentile": 25,
+					"Duration": 6838422
+				},
+				{
+					"Percentile": 50,
+					"Duration": 7377458
+				},
+				{
+					"Percentile": 75,
+					"Duration": 7883718
+				},
+				{
+					"Percentile": 90,
+					"Duration": 8030652
+				},
+				{
+					"Percentile": 95,
+					"Duration": 8375300
+				},
+				{
+					"Percentile": 99,
+					"Duration": 8998234
+				},
+				{
+					"Percentile": 100,
+					"Duration": 9015361
+				}
+			]
+		},
+		{
+			"Event": "verify-schnorr",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 15443749,
+			"StdDev": 1675213,
+			"Min": 12989269,
+			"Max": 24207292,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 12989269
+				},
+				{
+					"Percentile": 1,
+					"Duration": 13139420
+				},
+				{
+					"Percentile": 5,
+					"Duration": 13468531
+				},
+				{
+					"Percentile": 10,
+					"Duration": 13543241
+				},
+				{
+					"Percentile": 25,
+					"Duration": 14718925
+				},
+				{
+					"Percentile": 50,
+					"Duration": 15392575
+				},
+				{
+					"Percentile": 75,
+					"Duration": 15955993
+				},
+				{
+					"Percentile": 90,
+					"Duration": 16959060
+				},
+				{
+					"Percentile": 95,
+					"Duration": 17235863
+				},
+				{
+					"Percentile": 99,
+					"Duration": 21047290
+				},
+				{
+					"Percentile": 100,
+					"Duration": 24207292
+				}
+			]
+		},
+		{
+			"Event": "sign-schnorr",
+			"Level": 1,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 2688224,
+			"StdDev": 350880,
+			"Min": 2085088,
+			"Max": 3488512,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 2085088
+				},
+				{
+					"Percentile": 1,
+					"Duration": 2117255
+				},
+				{
+					"Percentile": 5,
+					"Duration": 2238096
+				},
+				{
+					"Percentile": 10,
+					"Duration": 2275890
+				},
+				{
+					"Percentile": 25,
+					"Duration": 2395746
+				},
+				{
+					"Percentile": 50,
+					"Duration": 2620817
+				},
+				{
+					"Percentile": 75,
+					"Duration": 2919551
+				},
+				{
+					"Percentile": 90,
+					"Duration": 3208115
+				},
+				{
+					"Percentile": 95,
+					"Duration": 3257096
+				},
+				{
+					"Percentile": 99,
+					"Duration": 3424338
+				},
+				{
+					"Percentile": 100,
+					"Duration": 3488512
+				}
+			]
+		},
+		{
+			"Event": "verify-schnorr",
+			"Level": 1,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 2883871,
+			"StdDev": 437128,
+			"Min": 2275103,
+			"Max": 4090475,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 2275103
+				},
+				{
+					"Percentile": 1,
+					"Duration": 2284586
+				},
+				{
+					"Percentile": 5,
+					"Duration": 2376994
+				},
+				{
+					"Percentile": 10,
+					"Duration": 2428148
+				},
+				{
+					"Percentile": 25,
+					"Duration": 2556737
+				},
+				{
+					"Percentile": 50,
+					"Duration": 2741290
+				},
+				{
+					"Percentile": 75,
+					"Duration": 3134428
+				},
+				{
+					"Percentile": 90,
+					"Duration": 3533143
+				},
+				{
+					"Percentile": 95,
+					"Duration": 3661848
+				},
+				{
+					"Percentile": 99,
+					"Duration": 3968188
+				},
+				{
+					"Percentile": 100,
+					"Duration": 4090475
+				}
+			]
+		},
+		{
+			"Event": "sign-ecdsa",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 46080,
+			"StdDev": 6180,
+			"Min": 35935,
+			"Max": 68527,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 35935
+				},
+				{
+					"Percentile": 1,
+					"Duration": 35974
+				},
+				{
+					"Percentile": 5,
+					"Duration": 38991
+				},
+				{
+					"Percentile": 10,
+					"Duration": 40844
+				},
+				{
+					"Percentile": 25,
+					"Duration": 42353
+				},
+				{
+					"Percentile": 50,
+					"Duration": 45624
+				},
+				{
+					"Percentile": 75,
+					"Duration": 47613
+				},
+				{
+					"Percentile": 90,
+					"Duration": 51970
+				},
+				{
+					"Percentile": 95,
+					"Duration": 55097
+				},
+				{
+					"Percentile": 99,
+					"Duration": 67646
+				},
+				{
+					"Percentile": 100,
+					"Duration": 68527
+				}
+			]
+		},
+		{
+			"Event": "verify-ecdsa",
+			"Level": 0,
+			"Distribution": "empirical",
+			"Samples": 50,
+			"Mean": 166165,
+			"StdDev": 104460,
+			"Min": 134197,
+			"Max": 856581,
+			"Percentiles": [
+				{
+					"Percentile": 0,
+					"Duration": 134197
+				},
+				{
+					"Percentile": 1,
+					"Duration": 134883
+				},
+				{
+					"Percentile": 5,
+					"Duration": 140825
+				},
+				{
+					"Percentile": 10,
+					"Duration": 141750
+				},
+				{
+					"Percentile": 25,
+					"Duration": 143018
+				},
+				{
+					"Percentile": 50,
+					"Duration": 144152
+				},
+				{
+					"Percentile": 75,
+					"Duration": 149376
+				},
+				{
+					"Percentile": 90,
+					"Duration": 165538
+				},
+				{
+					"Percentile": 95,
+					"Duration": 178497
+				},
+				{
+					"Percentile": 99,
+					"Duration": 612951
+				},
+				{
+					"Percentile": 100,
+					"Duration": 856581
+				}
+			]
+		}
+	]
+}`
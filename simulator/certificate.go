@@ -0,0 +1,113 @@
+package simulator
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-amcl/amcl"
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// Certificate is the X.509-like identity an organization issues to its peer;
+// the organization keys are the MSP root of trust every peer and user knows
+type Certificate struct {
+	org       int
+	peer      int
+	role      string
+	pk        dac.PK
+	signature dac.SchnorrSignature // by the organization
+}
+
+func (organization *Organization) issueCertificate(prg *amcl.RAND, peer int, pk dac.PK) (certificate Certificate) {
+
+	certificate = Certificate{
+		org:  organization.id,
+		peer: peer,
+		role: helpers.PeerRole,
+		pk:   pk,
+	}
+	certificate.signature = signCertificate(prg, organization.sk, certificate.getMessage())
+
+	return
+}
+
+// forgedCertificate is what a Byzantine peer makes up instead of the certificate its organization issued
+func (peer *Peer) forgedCertificate(prg *amcl.RAND) (certificate Certificate) {
+
+	certificate = peer.certificate
+	certificate.signature = forgeCertificate(prg, peer.sk, certificate.getMessage())
+
+	return
+}
+
+func (certificate Certificate) getMessage() (message []byte) {
+
+	message = make([]byte, 16)
+	binary.BigEndian.PutUint64(message[:8], uint64(certificate.org))
+	binary.BigEndian.PutUint64(message[8:], uint64(certificate.peer))
+	message = append(message, []byte(certificate.role)...)
+	message = append(message, dac.PointToBytes(certificate.pk)...)
+
+	return
+}
+
+func (certificate Certificate) identity() helpers.Identity {
+	return helpers.Identity{
+		Peer: certificate.peer,
+		Org:  certificate.org,
+	}
+}
+
+func (certificate Certificate) subject() string {
+	return fmt.Sprintf("peer-%d.org-%d", certificate.peer, certificate.org)
+}
+
+func (certificate Certificate) wire() helpers.WireCertificate {
+	return helpers.WireCertificate{
+		Org:       certificate.org,
+		Peer:      certificate.peer,
+		Role:      certificate.role,
+		PK:        encoded("peer-pk", pointBytes(certificate.pk)),
+		Signature: encoded("certificate-signature", certificate.signature.ToBytes),
+	}
+}
+
+func (certificate Certificate) size() int {
+	return helpers.EncodedSize(certificate.wire())
+}
+
+func (certificate Certificate) name() string {
+	return "certificate"
+}
+
+// certificateCache remembers the certificates a peer has already verified, like the MSP identity cache in Fabric
+type certificateCache struct {
+	*verifiedSet
+}
+
+func makeCertificateCache(capacity int) certificateCache {
+	return certificateCache{makeVerifiedSet(capacity)}
+}
+
+func (cache certificateCache) validate(prg *amcl.RAND, certificate Certificate) (e error) {
+
+	// subject is part of the key since in cost-model mode all signatures are the same
+	var key [32]byte
+	copy(key[:], helpers.Sha3(append(append(certificate.getMessage(), []byte(certificate.subject())...), certificate.signature.ToBytes()...)))
+	recordCryptoEvent(sha3hash)
+	if cache.contains(key) {
+		return
+	}
+
+	if certificate.org < 0 || certificate.org >= len(execParams.network.organizations) {
+		return fmt.Errorf("certificate of %s is issued by an unknown organization", certificate.subject())
+	}
+	if e = verifyCertificate(prg, execParams.network.organizations[certificate.org].pk, certificate.signature, certificate.getMessage()); e != nil {
+		return
+	}
+
+	cache.add(key)
+
+	return
+}
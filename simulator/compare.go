@@ -0,0 +1,68 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// CompareMSPs simulates the scenario with Idemix users and again with X.509 users, everything else the same,
+// and prints the results side by side, to tell what the privacy of Idemix costs
+func CompareMSPs(base *helpers.Scenario) (e error) {
+
+	msps := []string{helpers.IdemixMSP, helpers.X509MSP}
+	results := make([]*Results, len(msps))
+
+	for i, msp := range msps {
+		scenario, e := base.Override("crypto.msp", msp)
+		if e != nil {
+			return e
+		}
+		if e = scenario.Validate(true); e != nil {
+			return e
+		}
+
+		logger.Noticef("Simulating %s users", msp)
+
+		params, rootSk, _ := helpers.MakeSystemParameters(logger, scenario)
+		if results[i], e = Simulate(rootSk, params); e != nil {
+			return fmt.Errorf("%s: %v", msp, e)
+		}
+	}
+
+	idemix, x509 := results[0], results[1]
+
+	perTransaction := func(total int, results *Results) float64 {
+		if results.Transactions == 0 {
+			return 0
+		}
+		return float64(total) / float64(results.Transactions)
+	}
+
+	rows := []struct {
+		name         string
+		idemix, x509 float64
+	}{
+		{"throughput (tps)", idemix.Throughput, x509.Throughput},
+		{"valid", float64(idemix.Valid), float64(x509.Valid)},
+		{"latency mean (ms)", milliseconds(idemix.Latency.Mean), milliseconds(x509.Latency.Mean)},
+		{"latency p95 (ms)", milliseconds(idemix.Latency.P95), milliseconds(x509.Latency.P95)},
+		{"endorsement mean (ms)", milliseconds(idemix.Endorsements.Mean), milliseconds(x509.Endorsements.Mean)},
+		{"ordering mean (ms)", milliseconds(idemix.Ordering.Mean), milliseconds(x509.Ordering.Mean)},
+		{"validation mean (ms)", milliseconds(idemix.Validations.Mean), milliseconds(x509.Validations.Mean)},
+		{"bytes per transaction", perTransaction(idemix.Bytes, idemix), perTransaction(x509.Bytes, x509)},
+		{"ledger per transaction", perTransaction(idemix.LedgerBytes, idemix), perTransaction(x509.LedgerBytes, x509)},
+		{"messages", float64(idemix.Messages), float64(x509.Messages)},
+	}
+
+	logger.Criticalf("%-24s : %12s : %12s : %s", "", helpers.IdemixMSP, helpers.X509MSP, "idemix / x509")
+	for _, row := range rows {
+		ratio := "-"
+		if row.x509 != 0 {
+			ratio = fmt.Sprintf("%.2fx", row.idemix/row.x509)
+		}
+		logger.Criticalf("%-24s : %12.1f : %12.1f : %s", row.name, row.idemix, row.x509, ratio)
+	}
+
+	return
+}
@@ -1,6 +1,7 @@
 package simulator
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
@@ -29,31 +30,94 @@ const (
 
 	signSchnorr   CryptoEvent = "sign-schnorr"
 	verifySchnorr CryptoEvent = "verify-schnorr"
+
+	signECDSA   CryptoEvent = "sign-ecdsa"
+	verifyECDSA CryptoEvent = "verify-ecdsa"
 )
 
+var allCryptoEvents = []CryptoEvent{
+	credDelegation, credProve, credVerify,
+	nonRevokeGrant, nonRevokeProve, nonRevokeVerify,
+	auditEncrypt, auditDecrypt, auditProve, auditVerify,
+	sha3hash,
+	signNym, verifyNym,
+	signSchnorr, verifySchnorr,
+	signECDSA, verifyECDSA,
+}
+
 var recordCryptoEventLock = &sync.Mutex{}
 
+// recordInvalid counts a rejected transaction once, by the reference peer or by its client,
+// and the validation time spent on it by every peer
+func recordInvalid(code validationCode, spent time.Duration, reference bool) {
+	if reference {
+		execParams.invalid[code]++
+	}
+	execParams.wasted[code] += spent
+}
+
 func recordCryptoEvent(event CryptoEvent) {
+	recordLeveledCryptoEvent(event, 0)
+}
+
+// recordLeveledCryptoEvent charges a cost sampled from the calibrated profile, also after a real operation,
+// so that runs do not depend on the load of the host
+func recordLeveledCryptoEvent(event CryptoEvent, level int) {
 	recordCryptoEventLock.Lock()
-	defer recordCryptoEventLock.Unlock()
 
 	if current, exists := execParams.cryptoEvents[event]; exists {
 		execParams.cryptoEvents[event] = current + 1
 	} else {
 		execParams.cryptoEvents[event] = 1
 	}
+
+	recordCryptoEventLock.Unlock()
+
+	execParams.scheduler.Sleep(onCPU(cryptoEventCost(event, level)))
+}
+
+// onCPU stretches a cost measured on the host to the CPU the current process runs on
+func onCPU(cost time.Duration) time.Duration {
+	if speed := execParams.scheduler.Speed(); speed != 1 {
+		return time.Duration(float64(cost) / speed)
+	}
+	return cost
+}
+
+// the most specific entry wins: exact level, then level-independent
+func cryptoEventCost(event CryptoEvent, level int) time.Duration {
+
+	cost, exists := execParams.costs[costKey{event, level}]
+	if !exists {
+		cost, exists = execParams.costs[costKey{event, 0}]
+	}
+	if !exists {
+		return 0
+	}
+
+	return cost.Sample(execParams.costSource)
 }
 
 // TransactionTimingInfo ...
 type TransactionTimingInfo struct {
+	user  int
 	start time.Time
 	end   time.Time
 
 	endorsementsStart time.Time
 	endorsementsEnd   time.Time
 
+	orderingStart time.Time
+	orderingEnd   time.Time // block committed by a quorum of orderers
+
 	validationStart time.Time
 	validationEnd   time.Time
+
+	code validationCode
+
+	retries      int // endorsement requests sent again after a timeout or a bad endorsement
+	firstFailure time.Time
+	retryLatency time.Duration // from the first failed request to the last endorsement
 }
 
 var recordTransactionTimingInfoLock = &sync.Mutex{}
@@ -65,3 +129,59 @@ func recordTransactionTimingInfo(info TransactionTimingInfo) {
 
 	execParams.transactionTimings = append(execParams.transactionTimings, info)
 }
+
+func printRetries() {
+	retried, retries := 0, 0
+	var added time.Duration
+	for _, info := range execParams.transactionTimings {
+		if info.retries > 0 {
+			retried++
+			retries += info.retries
+			added += info.retryLatency
+		}
+	}
+	if retried == 0 {
+		return
+	}
+
+	logger.Criticalf(
+		"Endorsement retries: %d for %d transactions, adding %d ms on average (%d transactions given up)",
+		retries, retried, (added / time.Duration(retried)).Milliseconds(), execParams.faults.failed,
+	)
+}
+
+func printHardware() {
+	if len(sysParams.Hardware.Profiles) == 0 {
+		return
+	}
+
+	logger.Critical("Peer hardware (endorsements and validations waiting for a core):")
+	for _, peer := range execParams.network.peers {
+		profile := "host"
+		if peer.hardware != nil {
+			profile = fmt.Sprintf("%s (%d-core, %gx speed)", peer.hardware.Name, peer.hardware.Cores, peer.hardware.Speed)
+		}
+		var wait time.Duration
+		if peer.cpuTasks > 0 {
+			wait = peer.cpuWait / time.Duration(peer.cpuTasks)
+		}
+		logger.Criticalf("\t%-8s : %-30s : %5d tasks, %5d ms mean wait", peer.name(), profile, peer.cpuTasks, wait.Milliseconds())
+	}
+}
+
+func printInvalid() {
+	total := 0
+	for _, code := range invalidCodes {
+		total += execParams.invalid[code]
+	}
+	if total == 0 {
+		return
+	}
+
+	logger.Criticalf("Invalid transactions (%d rejected by clients before ordering):", execParams.rejected)
+	for _, code := range invalidCodes {
+		if count := execParams.invalid[code]; count > 0 {
+			logger.Criticalf("\t%-26s : %3d : %6d ms of validation over all peers", code, count, execParams.wasted[code].Milliseconds())
+		}
+	}
+}
@@ -0,0 +1,520 @@
+package simulator
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-amcl/amcl"
+	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// All cryptographic operations of the protocol go through the functions below.
+// In cost-model mode (sysParams.CostModel) they skip the real operation and return
+// an object precomputed once, so message sizes stay realistic. In both modes the
+// time an operation takes comes from the cost profile, not from the load of the host.
+
+const (
+	orgLevel  = 1
+	userLevel = 2
+)
+
+type credentialsTemplate struct {
+	KeysHolder
+	credRequest *dac.CredRequest
+	credentials *dac.Credentials
+}
+
+type cryptoTemplates struct {
+	levels map[int]credentialsTemplate
+
+	skNym        dac.SK
+	pkNym        dac.PK
+	proof        []byte
+	nymSignature dac.NymSignature
+
+	schnorrSignature     dac.SchnorrSignature
+	certificateSignature dac.SchnorrSignature
+
+	// made by Byzantine peers, the only signatures that do not verify in cost-model mode
+	forgedSignature            dac.SchnorrSignature
+	forgedCertificateSignature dac.SchnorrSignature
+
+	revocationAuthority KeysHolder
+	revocationPk        dac.PK
+	nonRevocationHandle dac.GrothSignature
+	nonRevocationProof  dac.RevocationProof
+
+	auditEnc   dac.AuditingEncryption
+	auditR     *FP256BN.BIG
+	auditProof dac.AuditingProof
+
+	x509 *x509Templates // in X.509 mode
+}
+
+type x509Templates struct {
+	authority          *helpers.X509Authority
+	key                *ecdsa.PrivateKey
+	certificateRequest []byte
+	certificate        []byte
+	signature          []byte
+}
+
+func makeCryptoTemplates(prg *amcl.RAND, rootSk dac.SK, auditPk dac.PK) (templates *cryptoTemplates) {
+
+	templates = &cryptoTemplates{
+		levels: make(map[int]credentialsTemplate, 2),
+	}
+
+	credentials := dac.MakeCredentials(sysParams.RootPk)
+	sk := rootSk
+	for _, level := range []int{orgLevel, userLevel} {
+		levelSk, levelPk := dac.GenerateKeys(prg, level)
+
+		attributes := []interface{}{
+			dac.ProduceAttributes(level, fmt.Sprintf("template-%d", level))[0],
+			dac.ProduceAttributes(level, "has-right-to-post")[0],
+		}
+		credentials = dac.CredentialsFromBytes(credentials.ToBytes())
+		if e := credentials.Delegate(sk, levelPk, attributes, prg, sysParams.Ys); e != nil {
+			panic(e)
+		}
+
+		templates.levels[level] = credentialsTemplate{
+			KeysHolder: KeysHolder{
+				pk: levelPk,
+				sk: levelSk,
+			},
+			credRequest: dac.MakeCredRequest(prg, levelSk, helpers.RandomBytes(prg, helpers.NonceSize), level),
+			credentials: credentials,
+		}
+		sk = levelSk
+	}
+
+	user := templates.levels[userLevel]
+	message := []byte("template")
+
+	templates.skNym, templates.pkNym = dac.GenerateNymKeys(prg, user.sk, sysParams.H)
+
+	proof, e := user.credentials.Prove(prg, user.sk, sysParams.RootPk, identityIndices(user.credentials), []byte{}, sysParams.Ys, sysParams.H, templates.skNym)
+	if e != nil {
+		panic(e)
+	}
+	templates.proof = proof.ToBytes()
+	templates.nymSignature = dac.SignNym(prg, templates.pkNym, templates.skNym, user.sk, sysParams.H, message)
+
+	templates.schnorrSignature = dac.MakeSchnorr(prg, false).Sign(user.sk, message)
+	templates.certificateSignature = dac.MakeSchnorr(prg, true).Sign(templates.levels[orgLevel].sk, message)
+	if len(sysParams.Byzantine) > 0 {
+		// own stream, so that runs without Byzantine peers do not change
+		forger := helpers.NewRandDerived(sysParams.Seed, "byzantine")
+		forgerSk, _ := dac.GenerateKeys(forger, 0)
+		templates.forgedSignature = dac.MakeSchnorr(forger, false).Sign(forgerSk, message)
+		templates.forgedCertificateSignature = dac.MakeSchnorr(forger, true).Sign(forgerSk, message)
+	}
+
+	revocationSk, revocationAuthorityPk := dac.MakeGroth(prg, true, sysParams.Ys[1]).Generate()
+	templates.revocationAuthority = KeysHolder{
+		pk: revocationAuthorityPk,
+		sk: revocationSk,
+	}
+	templates.revocationPk = FP256BN.ECP_generator().Mul(user.sk)
+	templates.nonRevocationHandle = dac.SignNonRevoke(prg, revocationSk, templates.revocationPk, FP256BN.NewBIGint(1), sysParams.Ys[1])
+	templates.nonRevocationProof = dac.RevocationProve(prg, templates.nonRevocationHandle, user.sk, templates.skNym, FP256BN.NewBIGint(1), sysParams.H, sysParams.Ys[0])
+
+	templates.auditEnc, templates.auditR = dac.AuditingEncrypt(prg, auditPk, user.pk)
+	templates.auditProof = dac.AuditingProve(prg, templates.auditEnc, user.pk, user.sk, templates.pkNym, templates.skNym, auditPk, templates.auditR, sysParams.H)
+
+	if sysParams.X509() {
+		// own stream, so that runs of Idemix users do not change
+		templates.x509 = makeX509Templates(helpers.NewRandDerived(sysParams.Seed, "x509-templates"))
+	}
+
+	logger.Notice("Crypto templates have been computed")
+
+	return
+}
+
+func makeX509Templates(prg *amcl.RAND) (templates *x509Templates) {
+
+	authority, e := helpers.MakeX509Authority(prg, "org-0")
+	if e != nil {
+		panic(e)
+	}
+
+	templates = &x509Templates{
+		authority: authority,
+		key:       helpers.GenerateECDSAKey(prg),
+	}
+
+	if templates.certificateRequest, e = helpers.MakeCertificateRequest(prg, templates.key, "user-0", "org-0"); e != nil {
+		panic(e)
+	}
+	if templates.certificate, e = authority.Issue(prg, templates.certificateRequest); e != nil {
+		panic(e)
+	}
+	templates.signature = helpers.SignECDSA(prg, templates.key, []byte("template"))
+
+	return
+}
+
+func identityIndices(credentials *dac.Credentials) dac.Indices {
+	return dac.Indices{
+		dac.Index{
+			I:         1,
+			J:         1,
+			Attribute: credentials.Attributes[1][1],
+		},
+	}
+}
+
+/// Credentials
+
+func generateKeys(prg *amcl.RAND, level int) (sk dac.SK, pk dac.PK) {
+	if sysParams.CostModel {
+		template := execParams.templates.levels[level]
+		return template.sk, template.pk
+	}
+	return dac.GenerateKeys(prg, level)
+}
+
+func makeCredRequest(prg *amcl.RAND, sk dac.SK, nonce []byte, level int) *dac.CredRequest {
+	if sysParams.CostModel {
+		return execParams.templates.levels[level].credRequest
+	}
+	return dac.MakeCredRequest(prg, sk, nonce, level)
+}
+
+func validateCredRequest(credRequest *dac.CredRequest) error {
+	if sysParams.CostModel {
+		return nil
+	}
+	return credRequest.Validate()
+}
+
+func delegateCredentials(prg *amcl.RAND, issuer *dac.Credentials, issuerSk dac.SK, pk dac.PK, level int, attributeValues ...string) (credentials *dac.Credentials, e error) {
+	defer recordLeveledCryptoEvent(credDelegation, level)
+
+	if sysParams.CostModel {
+		return execParams.templates.levels[level].credentials, nil
+	}
+
+	attributes := make([]interface{}, 0, len(attributeValues))
+	for _, value := range attributeValues {
+		attributes = append(attributes, dac.ProduceAttributes(level, value)[0])
+	}
+
+	credentials = dac.CredentialsFromBytes(issuer.ToBytes())
+	e = credentials.Delegate(issuerSk, pk, attributes, prg, sysParams.Ys)
+
+	return
+}
+
+func verifyCredentials(credentials *dac.Credentials, sk dac.SK) error {
+	if sysParams.CostModel {
+		return nil
+	}
+	return credentials.Verify(sk, sysParams.RootPk, sysParams.Ys)
+}
+
+/// Identity
+
+func generateNymKeys(prg *amcl.RAND, sk dac.SK) (skNym dac.SK, pkNym dac.PK) {
+	if sysParams.CostModel {
+		return execParams.templates.skNym, execParams.templates.pkNym
+	}
+	return dac.GenerateNymKeys(prg, sk, sysParams.H)
+}
+
+func proveIdentity(prg *amcl.RAND, user User, indices dac.Indices, skNym dac.SK) (proof []byte, e error) {
+	defer recordLeveledCryptoEvent(credProve, userLevel)
+
+	if sysParams.CostModel {
+		return execParams.templates.proof, nil
+	}
+
+	proofObj, e := user.credentials.Prove(prg, user.sk, sysParams.RootPk, indices, []byte{}, sysParams.Ys, sysParams.H, skNym)
+	if e != nil {
+		return
+	}
+
+	return proofObj.ToBytes(), nil
+}
+
+func verifyIdentity(proof []byte, pkNym dac.PK, indices dac.Indices) error {
+	defer recordLeveledCryptoEvent(credVerify, userLevel)
+
+	if sysParams.CostModel {
+		return nil
+	}
+	return dac.ProofFromBytes(proof).VerifyProof(sysParams.RootPk, sysParams.Ys, sysParams.H, pkNym, indices, []byte{})
+}
+
+/// Signatures
+
+func signNymMessage(prg *amcl.RAND, pkNym dac.PK, skNym dac.SK, sk dac.SK, message []byte) dac.NymSignature {
+	defer recordCryptoEvent(signNym)
+
+	if sysParams.CostModel {
+		return execParams.templates.nymSignature
+	}
+	return dac.SignNym(prg, pkNym, skNym, sk, sysParams.H, message)
+}
+
+// encoded serializes a crypto object for the wire; serialization is expensive,
+// and in cost-model mode all objects of a kind are the same or of the same size, so each kind is serialized once
+func encoded(kind string, serialize func() []byte) []byte {
+	if !sysParams.CostModel {
+		return serialize()
+	}
+	bytes, cached := execParams.encodings[kind]
+	if !cached {
+		bytes = serialize()
+		execParams.encodings[kind] = bytes
+	}
+	return bytes
+}
+
+func pointBytes(point dac.PK) func() []byte {
+	return func() []byte {
+		return dac.PointToBytes(point)
+	}
+}
+
+func verifyNymMessage(signature dac.NymSignature, pkNym dac.PK, message []byte) error {
+	defer recordCryptoEvent(verifyNym)
+
+	if sysParams.CostModel {
+		return nil
+	}
+	return signature.VerifyNym(sysParams.H, pkNym, message)
+}
+
+func signSchnorrMessage(prg *amcl.RAND, sk dac.SK, message []byte) dac.SchnorrSignature {
+	defer recordCryptoEvent(signSchnorr)
+
+	if sysParams.CostModel {
+		return execParams.templates.schnorrSignature
+	}
+	return dac.MakeSchnorr(prg, false).Sign(sk, message)
+}
+
+func verifySchnorrMessage(prg *amcl.RAND, pk dac.PK, signature dac.SchnorrSignature, message []byte) error {
+	defer recordCryptoEvent(verifySchnorr)
+
+	if sysParams.CostModel {
+		if signature == execParams.templates.forgedSignature {
+			return fmt.Errorf("schnorr signature is forged")
+		}
+		return nil
+	}
+	return dac.MakeSchnorr(prg, false).Verify(pk, signature, message)
+}
+
+// signStateInfo signs what a peer advertises to gossip, once and on a stream of its own; it is neither counted
+// nor timed, since the simulation does not model how state info is refreshed, and only its size matters
+func signStateInfo(peer int, sk dac.SK, message []byte) dac.SchnorrSignature {
+	if sysParams.CostModel {
+		return execParams.templates.schnorrSignature
+	}
+	prg := helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("peer-%d-state-info", peer))
+	return dac.MakeSchnorr(prg, false).Sign(sk, message)
+}
+
+/// Certificates
+
+// organizations sign with keys of their level, which live in the other group
+
+func signCertificate(prg *amcl.RAND, orgSk dac.SK, message []byte) dac.SchnorrSignature {
+	defer recordLeveledCryptoEvent(signSchnorr, orgLevel)
+
+	if sysParams.CostModel {
+		return execParams.templates.certificateSignature
+	}
+	return dac.MakeSchnorr(prg, true).Sign(orgSk, message)
+}
+
+func verifyCertificate(prg *amcl.RAND, orgPk dac.PK, signature dac.SchnorrSignature, message []byte) error {
+	defer recordLeveledCryptoEvent(verifySchnorr, orgLevel)
+
+	if sysParams.CostModel {
+		if signature == execParams.templates.forgedCertificateSignature {
+			return fmt.Errorf("certificate signature is forged")
+		}
+		return nil
+	}
+	return dac.MakeSchnorr(prg, true).Verify(orgPk, signature, message)
+}
+
+/// Forgeries
+
+// forgeSchnorrMessage signs with a key nobody has certified
+func forgeSchnorrMessage(prg *amcl.RAND, message []byte) dac.SchnorrSignature {
+	defer recordCryptoEvent(signSchnorr)
+
+	if sysParams.CostModel {
+		return execParams.templates.forgedSignature
+	}
+	sk, _ := dac.GenerateKeys(prg, 0)
+	return dac.MakeSchnorr(prg, false).Sign(sk, message)
+}
+
+// forgeCertificate signs a certificate with the key of the peer instead of its organization
+func forgeCertificate(prg *amcl.RAND, sk dac.SK, message []byte) dac.SchnorrSignature {
+	defer recordLeveledCryptoEvent(signSchnorr, orgLevel)
+
+	if sysParams.CostModel {
+		return execParams.templates.forgedCertificateSignature
+	}
+	return dac.MakeSchnorr(prg, true).Sign(sk, message)
+}
+
+/// X.509
+
+// certificates and signatures of X.509 users are ECDSA, whatever their level
+
+func makeX509Authority(prg *amcl.RAND, organization string) *helpers.X509Authority {
+	if sysParams.CostModel {
+		return execParams.templates.x509.authority
+	}
+	authority, e := helpers.MakeX509Authority(prg, organization)
+	if e != nil {
+		panic(e)
+	}
+	return authority
+}
+
+func generateECDSAKey(prg *amcl.RAND) *ecdsa.PrivateKey {
+	if sysParams.CostModel {
+		return execParams.templates.x509.key
+	}
+	return helpers.GenerateECDSAKey(prg)
+}
+
+func makeCertificateRequest(prg *amcl.RAND, key *ecdsa.PrivateKey, name, organization string) []byte {
+	defer recordCryptoEvent(signECDSA)
+
+	if sysParams.CostModel {
+		return execParams.templates.x509.certificateRequest
+	}
+	request, e := helpers.MakeCertificateRequest(prg, key, name, organization)
+	if e != nil {
+		panic(e)
+	}
+	return request
+}
+
+// issueX509Certificate verifies the signature of the request and signs the certificate
+func issueX509Certificate(prg *amcl.RAND, authority *helpers.X509Authority, request []byte) ([]byte, error) {
+	defer recordCryptoEvent(signECDSA)
+	defer recordCryptoEvent(verifyECDSA)
+
+	if sysParams.CostModel {
+		return execParams.templates.x509.certificate, nil
+	}
+	return authority.Issue(prg, request)
+}
+
+func verifyX509Certificate(authority *helpers.X509Authority, certificate []byte) error {
+	defer recordCryptoEvent(verifyECDSA)
+
+	if sysParams.CostModel {
+		return nil
+	}
+	_, e := authority.Verify(certificate)
+	return e
+}
+
+func signECDSAMessage(prg *amcl.RAND, key *ecdsa.PrivateKey, message []byte) []byte {
+	defer recordCryptoEvent(signECDSA)
+
+	if sysParams.CostModel {
+		return execParams.templates.x509.signature
+	}
+	return helpers.SignECDSA(prg, key, message)
+}
+
+func verifyECDSAMessage(pk *ecdsa.PublicKey, signature []byte, message []byte) error {
+	defer recordCryptoEvent(verifyECDSA)
+
+	if sysParams.CostModel {
+		return nil
+	}
+	return helpers.VerifyECDSA(pk, signature, message)
+}
+
+/// Revocation
+
+func makeRevocationPk(sk dac.SK) dac.PK {
+	if sysParams.CostModel {
+		return execParams.templates.revocationPk
+	}
+	return FP256BN.ECP_generator().Mul(sk)
+}
+
+func grantNonRevocation(prg *amcl.RAND, sk dac.SK, userPk dac.PK, epoch int) dac.GrothSignature {
+	defer recordCryptoEvent(nonRevokeGrant)
+
+	if sysParams.CostModel {
+		return execParams.templates.nonRevocationHandle
+	}
+	return dac.SignNonRevoke(prg, sk, userPk, FP256BN.NewBIGint(epoch), sysParams.Ys[1])
+}
+
+func proveNonRevocation(prg *amcl.RAND, handle dac.GrothSignature, sk dac.SK, skNym dac.SK, epoch int) dac.RevocationProof {
+	defer recordCryptoEvent(nonRevokeProve)
+
+	if sysParams.CostModel {
+		return execParams.templates.nonRevocationProof
+	}
+	return dac.RevocationProve(prg, handle, sk, skNym, FP256BN.NewBIGint(epoch), sysParams.H, sysParams.Ys[0])
+}
+
+func verifyNonRevocation(proof dac.RevocationProof, pkNym dac.PK, epoch int, revocationPk dac.PK) error {
+	defer recordCryptoEvent(nonRevokeVerify)
+
+	if sysParams.CostModel {
+		return nil
+	}
+	return proof.Verify(pkNym, FP256BN.NewBIGint(epoch), sysParams.H, revocationPk, sysParams.Ys[1])
+}
+
+/// Auditing
+
+func auditingEncrypt(prg *amcl.RAND, auditPk dac.PK, userPk dac.PK) (auditEnc dac.AuditingEncryption, auditR *FP256BN.BIG) {
+	defer recordCryptoEvent(auditEncrypt)
+
+	if sysParams.CostModel {
+		return execParams.templates.auditEnc, execParams.templates.auditR
+	}
+	return dac.AuditingEncrypt(prg, auditPk, userPk)
+}
+
+func auditingProve(prg *amcl.RAND, auditEnc dac.AuditingEncryption, user User, pkNym dac.PK, skNym dac.SK, auditPk dac.PK, auditR *FP256BN.BIG) dac.AuditingProof {
+	defer recordCryptoEvent(auditProve)
+
+	if sysParams.CostModel {
+		return execParams.templates.auditProof
+	}
+	return dac.AuditingProve(prg, auditEnc, user.pk, user.sk, pkNym, skNym, auditPk, auditR, sysParams.H)
+}
+
+func auditingVerify(proof dac.AuditingProof, auditEnc dac.AuditingEncryption, pkNym dac.PK, auditPk dac.PK) error {
+	defer recordCryptoEvent(auditVerify)
+
+	if sysParams.CostModel {
+		return nil
+	}
+	return proof.Verify(auditEnc, pkNym, auditPk, sysParams.H)
+}
+
+// returns true if the decrypted author matches the expected one
+func auditingDecrypt(auditEnc dac.AuditingEncryption, auditSk dac.SK, authorPk dac.PK) bool {
+	defer recordCryptoEvent(auditDecrypt)
+
+	if sysParams.CostModel {
+		return true
+	}
+	return dac.PkEqual(auditEnc.AuditingDecrypt(auditSk), authorPk)
+}
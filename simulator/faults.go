@@ -0,0 +1,288 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dbogatov/fabric-simulator/helpers"
+	"golang.org/x/exp/rand"
+)
+
+// Fault is a crash, a lossy or slow link, or a partition injected by the scenario;
+// it counts the transactions it has delayed or made their users give up
+type Fault struct {
+	description string
+	at          time.Duration
+	duration    time.Duration // until the end if zero
+	active      bool
+
+	crash     *helpers.CrashFault
+	link      *helpers.LinkFault
+	partition *helpers.PartitionFault
+
+	delayed int
+	failed  int
+}
+
+// faultSet holds the faults that have hit a transaction
+type faultSet map[*Fault]bool
+
+// timedOut is put on a queue a user waits on once the fault timeout expires
+type timedOut struct{}
+
+// Faults ...
+type Faults struct {
+	all      []*Fault
+	down     map[string]*Fault // crashed actors
+	pending  map[*TransactionProposal]bool
+	random   *rand.Rand  // message loss
+	failed   int         // transactions given up by the users
+	failedBy map[int]int // by user
+}
+
+// a peer that stops committing holds back every transaction, since users wait for all peers
+const deliveryRetry = time.Second
+
+func makeFaults() (faults *Faults) {
+
+	faults = &Faults{
+		down:     make(map[string]*Fault),
+		pending:  make(map[*TransactionProposal]bool),
+		failedBy: make(map[int]int),
+		random:   rand.New(rand.NewSource(helpers.RandomULong(helpers.NewRandDerived(sysParams.Seed, "faults")))),
+	}
+
+	milliseconds := func(value int) time.Duration {
+		return time.Duration(value) * time.Millisecond
+	}
+
+	for i := range sysParams.Crashes {
+		crash := &sysParams.Crashes[i]
+		faults.all = append(faults.all, &Fault{
+			description: fmt.Sprintf("crash of %s", crash.Actor),
+			at:          milliseconds(crash.At),
+			duration:    milliseconds(crash.Downtime),
+			crash:       crash,
+		})
+	}
+	for i := range sysParams.LinkFaults {
+		link := &sysParams.LinkFaults[i]
+		faults.all = append(faults.all, &Fault{
+			description: fmt.Sprintf("link %s -> %s (%.0f%% loss, %d ms delay)", link.From, link.To, 100*link.Loss, link.Delay),
+			at:          milliseconds(link.At),
+			duration:    milliseconds(link.Duration),
+			link:        link,
+		})
+	}
+	for i := range sysParams.Partitions {
+		partition := &sysParams.Partitions[i]
+		faults.all = append(faults.all, &Fault{
+			description: fmt.Sprintf("partition of %s", strings.Join(partition.Actors, ", ")),
+			at:          milliseconds(partition.At),
+			duration:    milliseconds(partition.Duration),
+			partition:   partition,
+		})
+	}
+
+	return
+}
+
+func (faults *Faults) enabled() bool {
+	return len(faults.all) > 0
+}
+
+func (faults *Faults) schedule() {
+	for _, fault := range faults.all {
+		fault := fault
+		execParams.scheduler.Go(func() {
+			execParams.scheduler.Sleep(fault.at)
+			if !faults.begin(fault) || fault.duration == 0 {
+				return
+			}
+			execParams.scheduler.Sleep(fault.duration)
+			faults.end(fault)
+		})
+	}
+}
+
+func (faults *Faults) begin(fault *Fault) bool {
+
+	if fault.crash != nil {
+		if faults.down[fault.crash.Actor] != nil {
+			logger.Warningf("%s is already down", fault.crash.Actor)
+			return false
+		}
+		faults.down[fault.crash.Actor] = fault
+	}
+
+	fault.active = true
+	logger.Noticef("Fault started: %s", fault.description)
+
+	// transactions in flight will wait for an isolated peer to commit them
+	if fault.isolatesPeer() {
+		for tp := range faults.pending {
+			tp.faults[fault] = true
+		}
+	}
+
+	if execParams.network != nil {
+		execParams.network.notifyDelivery()
+	}
+
+	return true
+}
+
+func (faults *Faults) end(fault *Fault) {
+
+	fault.active = false
+	if fault.crash != nil {
+		delete(faults.down, fault.crash.Actor)
+	}
+	logger.Noticef("Fault ended: %s", fault.description)
+
+	if execParams.network != nil {
+		for _, peer := range execParams.network.peers {
+			if fault.crash != nil && fault.crash.Actor == peer.name() {
+				peer.restartSignal.Put(true)
+			}
+		}
+		execParams.network.notifyDelivery()
+	}
+}
+
+func (fault *Fault) isolatesPeer() bool {
+	if fault.crash != nil {
+		return helpers.MatchActor(helpers.PeerActor, fault.crash.Actor)
+	}
+	if fault.partition != nil {
+		for _, pattern := range fault.partition.Actors {
+			if pattern == helpers.AnyActor || pattern == helpers.PeerActor || helpers.MatchActor(helpers.PeerActor, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (fault *Fault) separates(from, to string) bool {
+	inside := func(actor string) bool {
+		for _, pattern := range fault.partition.Actors {
+			if helpers.MatchActor(pattern, actor) {
+				return true
+			}
+		}
+		return false
+	}
+	return inside(from) != inside(to)
+}
+
+func (faults *Faults) isDown(actor string) bool {
+	return faults.down[actor] != nil
+}
+
+// track keeps the transaction among the ones in flight, hit by the peers isolated at the moment
+func (faults *Faults) track(tp *TransactionProposal) {
+	if !faults.enabled() {
+		return
+	}
+	faults.pending[tp] = true
+	for _, fault := range faults.all {
+		if fault.active && fault.isolatesPeer() {
+			tp.faults[fault] = true
+		}
+	}
+}
+
+// finish counts the transaction against the faults that have hit it
+func (faults *Faults) finish(tp *TransactionProposal, failed bool) {
+	delete(faults.pending, tp)
+	if failed {
+		faults.failed++
+		faults.failedBy[tp.authorID]++
+	}
+	for fault := range tp.faults {
+		if failed {
+			fault.failed++
+		} else {
+			fault.delayed++
+		}
+	}
+}
+
+// arm puts timedOut on the queue once the timeout expires; a no-op without faults, where nothing is lost
+func (faults *Faults) arm(queue *Queue) {
+	if !faults.enabled() {
+		return
+	}
+	execParams.scheduler.Go(func() {
+		execParams.scheduler.Sleep(time.Duration(sysParams.FaultTimeout) * time.Millisecond)
+		queue.Put(timedOut{})
+	})
+}
+
+// transmit is recordBandwidth subject to the faults: a message is lost if either end is down,
+// if a partition separates them or if a lossy link drops it, and it may be delayed;
+// faults that lose or delay the message are added to affected
+func transmit(from, to string, object transferable, affected faultSet) (delivered bool) {
+
+	faults := execParams.faults
+	if fault := faults.down[from]; fault != nil {
+		affected[fault] = true
+		return false
+	}
+
+	recordBandwidth(from, to, object)
+
+	if fault := faults.down[to]; fault != nil {
+		affected[fault] = true
+		return false
+	}
+
+	var delay time.Duration
+	for _, fault := range faults.all {
+		if !fault.active {
+			continue
+		}
+		switch {
+		case fault.partition != nil && fault.separates(from, to):
+			affected[fault] = true
+			return false
+		case fault.link != nil && helpers.MatchActor(fault.link.From, from) && helpers.MatchActor(fault.link.To, to):
+			if fault.link.Loss > 0 && faults.random.Float64() < fault.link.Loss {
+				logger.Debugf("%s from %s to %s is lost", object.name(), from, to)
+				affected[fault] = true
+				return false
+			}
+			if fault.link.Delay > 0 {
+				affected[fault] = true
+				delay += time.Duration(fault.link.Delay) * time.Millisecond
+			}
+		}
+	}
+
+	if delay > 0 {
+		execParams.scheduler.Sleep(delay)
+	}
+
+	return true
+}
+
+// affect adds the faults that held the block back to its transactions
+func (block *Block) affect(affected faultSet) {
+	for fault := range affected {
+		for _, tx := range block.transactions {
+			tx.proposal.faults[fault] = true
+		}
+	}
+}
+
+func printFaults() {
+	if !execParams.faults.enabled() {
+		return
+	}
+	logger.Criticalf("Faults (%d transactions given up, %d ms timeout):", execParams.faults.failed, sysParams.FaultTimeout)
+	for _, fault := range execParams.faults.all {
+		logger.Criticalf("\t%-50s : delayed %3d, failed %3d", fault.description, fault.delayed, fault.failed)
+	}
+}
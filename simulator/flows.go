@@ -0,0 +1,259 @@
+package simulator
+
+import (
+	"container/heap"
+	"math"
+	"time"
+)
+
+// flowNetwork shares the bandwidth of links max-min fairly among the messages crossing them at once:
+// a message goes at the pace of its most contended link, and what it leaves unused on the others goes to the rest.
+// Rates are worked out again whenever messages start or end, once for all of them at the same instant,
+// and only for the messages they share links with, directly or not.
+type flowNetwork struct {
+	links   map[string]*link
+	epoch   uint64  // of the latest reshare, to mark what it went through
+	changed []*link // whose flows started or ended since the latest reshare
+}
+
+// link carries the flows crossing it
+type link struct {
+	name     string
+	capacity float64 // B/s
+	flows    []*flow
+
+	// scratch of a reshare
+	seen     uint64
+	index    int
+	residual float64 // B/s not given to frozen flows
+	unfrozen int
+}
+
+// flow is a message on its way
+type flow struct {
+	links     []*link
+	remaining float64       // bytes
+	rate      float64       // B/s
+	updated   time.Duration // when remaining was last brought up to date
+	process   *process      // the sender, blocked until the last byte is through
+	timer     *event
+
+	// scratch of a reshare
+	seen   uint64
+	frozen bool
+	next   float64
+}
+
+func makeFlowNetwork() *flowNetwork {
+	return &flowNetwork{
+		links: make(map[string]*link),
+	}
+}
+
+// link is created the first time it is used, with the capacity it is used with
+func (network *flowNetwork) link(name string, capacity int) *link {
+	l, exists := network.links[name]
+	if !exists {
+		l = &link{
+			name:     name,
+			capacity: float64(capacity),
+		}
+		network.links[name] = l
+	}
+	return l
+}
+
+// transfer blocks the current process while size bytes go over the links
+func (network *flowNetwork) transfer(size int, links ...*link) {
+
+	if size <= 0 {
+		return
+	}
+
+	scheduler := execParams.scheduler
+
+	f := &flow{
+		remaining: float64(size),
+		updated:   scheduler.now,
+		process:   scheduler.current,
+	}
+	for _, l := range links {
+		if !f.crosses(l) {
+			f.links = append(f.links, l)
+			l.flows = append(l.flows, f)
+		}
+	}
+
+	network.change(f.links)
+	scheduler.block(f.process)
+
+	// woken by the timer once done
+	for _, l := range f.links {
+		l.remove(f)
+	}
+	network.change(f.links)
+}
+
+// change has the flows reshared once the processes due at this instant are through
+func (network *flowNetwork) change(links []*link) {
+	if len(network.changed) == 0 {
+		execParams.scheduler.Go(network.reshare)
+	}
+	network.changed = append(network.changed, links...)
+}
+
+// reshare brings the flows connected to the changed links up to date, gives them their max-min fair rates
+// and sets the timers of those whose rates have changed
+func (network *flowNetwork) reshare() {
+
+	scheduler := execParams.scheduler
+
+	flows, component := network.connected(network.changed)
+	network.changed = nil
+	if len(flows) == 0 {
+		return
+	}
+
+	for _, f := range flows {
+		f.remaining = math.Max(0, f.remaining-f.rate*(scheduler.now-f.updated).Seconds())
+		f.updated = scheduler.now
+	}
+
+	fill(component)
+
+	for _, f := range flows {
+		if f.timer != nil && f.next == f.rate {
+			continue
+		}
+		if f.timer != nil {
+			f.timer.cancelled = true
+		}
+		f.rate = f.next
+		f.timer = scheduler.wake(f.process, time.Duration(math.Ceil(f.remaining/f.rate*float64(time.Second))))
+	}
+}
+
+// connected finds the flows sharing links with those on the given links, directly or through other flows,
+// and the links of all of them; in a fixed order, for the rates to come out the same on every run
+func (network *flowNetwork) connected(links []*link) (flows []*flow, component []*link) {
+
+	network.epoch++
+
+	visit := func(l *link) {
+		if l.seen != network.epoch {
+			l.seen = network.epoch
+			component = append(component, l)
+		}
+	}
+
+	for _, l := range links {
+		visit(l)
+	}
+	for i := 0; i < len(component); i++ {
+		for _, f := range component[i].flows {
+			if f.seen == network.epoch {
+				continue
+			}
+			f.seen = network.epoch
+			flows = append(flows, f)
+			for _, other := range f.links {
+				visit(other)
+			}
+		}
+	}
+
+	return
+}
+
+// fill is progressive filling: the link with the smallest fair share is the bottleneck of its unfrozen flows,
+// which are frozen at that share; their links lose the bandwidth they take, and so on until all flows are frozen
+func fill(component []*link) {
+
+	bottlenecks := make(shares, 0, len(component))
+	for i, l := range component {
+		l.index = i
+		l.residual = l.capacity
+		l.unfrozen = len(l.flows)
+		for _, f := range l.flows {
+			f.frozen = false
+		}
+		if l.unfrozen > 0 {
+			bottlenecks = append(bottlenecks, share{link: i, share: l.residual / float64(l.unfrozen)})
+		}
+	}
+	heap.Init(&bottlenecks)
+
+	for bottlenecks.Len() > 0 {
+		next := heap.Pop(&bottlenecks).(share)
+		bottleneck := component[next.link]
+		// the link lost flows since, so its share went up and a newer entry is further down
+		if bottleneck.unfrozen == 0 || next.share != bottleneck.residual/float64(bottleneck.unfrozen) {
+			continue
+		}
+
+		for _, f := range bottleneck.flows {
+			if f.frozen {
+				continue
+			}
+			f.frozen = true
+			f.next = next.share
+			for _, l := range f.links {
+				l.residual -= next.share
+				l.unfrozen--
+				if l != bottleneck && l.unfrozen > 0 {
+					heap.Push(&bottlenecks, share{link: l.index, share: l.residual / float64(l.unfrozen)})
+				}
+			}
+		}
+	}
+}
+
+func (f *flow) crosses(l *link) bool {
+	for _, other := range f.links {
+		if other == l {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *link) remove(f *flow) {
+	for i, other := range l.flows {
+		if other == f {
+			l.flows = append(l.flows[:i], l.flows[i+1:]...)
+			return
+		}
+	}
+}
+
+/// Fair shares of links
+
+type share struct {
+	link  int
+	share float64 // B/s
+}
+
+type shares []share
+
+func (queue shares) Len() int { return len(queue) }
+
+func (queue shares) Less(i, j int) bool {
+	if queue[i].share == queue[j].share {
+		return queue[i].link < queue[j].link
+	}
+	return queue[i].share < queue[j].share
+}
+
+func (queue shares) Swap(i, j int) { queue[i], queue[j] = queue[j], queue[i] }
+
+func (queue *shares) Push(x interface{}) {
+	*queue = append(*queue, x.(share))
+}
+
+func (queue *shares) Pop() interface{} {
+	old := *queue
+	n := len(old)
+	item := old[n-1]
+	*queue = old[:n-1]
+	return item
+}
@@ -0,0 +1,149 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// fairRates fills links of the given capacities (B/s) with flows crossing the links of the given indices
+func fairRates(capacities []float64, paths [][]int) (rates []float64) {
+
+	links := make([]*link, len(capacities))
+	for i, capacity := range capacities {
+		links[i] = &link{name: fmt.Sprintf("link-%d", i), capacity: capacity}
+	}
+
+	flows := make([]*flow, len(paths))
+	for i, path := range paths {
+		flows[i] = &flow{}
+		for _, index := range path {
+			flows[i].links = append(flows[i].links, links[index])
+			links[index].flows = append(links[index].flows, flows[i])
+		}
+	}
+
+	fill(links)
+
+	for _, f := range flows {
+		rates = append(rates, f.next)
+	}
+	return
+}
+
+func TestFillSharedBottleneck(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		capacities []float64
+		paths      [][]int
+		rates      []float64
+	}{
+		{"alone", []float64{1000}, [][]int{{0}}, []float64{1000}},
+		{"even", []float64{900}, [][]int{{0}, {0}, {0}}, []float64{300, 300, 300}},
+		{"behind the same uplink", []float64{1000, 5000, 5000}, [][]int{{0, 1}, {0, 2}}, []float64{500, 500}},
+		{"leftover of a slower flow", []float64{300, 50}, [][]int{{0}, {0, 1}, {0}}, []float64{125, 50, 125}},
+	}
+
+	for _, test := range tests {
+		checkRates(t, test.name, fairRates(test.capacities, test.paths), test.rates)
+	}
+}
+
+func TestFillTwoBottlenecks(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		capacities []float64
+		paths      [][]int
+		rates      []float64
+	}{
+		// the second link is the tighter one, the first gives what is left to its other flow
+		{"chain", []float64{100, 60}, [][]int{{0}, {0, 1}, {1}}, []float64{70, 30, 30}},
+		// the first link is the tighter one, the second gives what is left to its other flow
+		{"chain reversed", []float64{100, 120}, [][]int{{0}, {0, 1}, {1}}, []float64{50, 50, 70}},
+		// flows crossing both are held by the tighter one
+		{"parallel", []float64{400, 200}, [][]int{{0, 1}, {0, 1}, {0}}, []float64{100, 100, 200}},
+		// two separate bottlenecks
+		{"disjoint", []float64{100, 300}, [][]int{{0}, {0}, {1}}, []float64{50, 50, 300}},
+	}
+
+	for _, test := range tests {
+		checkRates(t, test.name, fairRates(test.capacities, test.paths), test.rates)
+	}
+}
+
+func checkRates(t *testing.T, name string, rates, expected []float64) {
+	t.Helper()
+
+	for i := range expected {
+		if math.Abs(rates[i]-expected[i]) > 1e-9 {
+			t.Errorf("%s: rates are %v, expected %v", name, rates, expected)
+			return
+		}
+	}
+}
+
+func TestTransferCompletion(t *testing.T) {
+
+	type transfer struct {
+		start int // ms
+		size  int // bytes
+		links []int
+	}
+
+	tests := []struct {
+		name       string
+		capacities []int // B/s
+		transfers  []transfer
+		ends       []int // ms
+	}{
+		{"alone", []int{1000}, []transfer{{0, 1000, []int{0}}}, []int{1000}},
+		{"nothing to send", []int{1000}, []transfer{{200, 0, []int{0}}}, []int{200}},
+
+		// the first flow goes at half its pace once the second joins
+		{"join", []int{1000}, []transfer{{0, 1000, []int{0}}, {500, 1000, []int{0}}}, []int{1500, 2000}},
+
+		// the second flow goes at full pace once the first leaves
+		{"leave", []int{1000}, []transfer{{0, 500, []int{0}}, {0, 1500, []int{0}}}, []int{1000, 2000}},
+
+		// a flow slowed down by a later one speeds up again when it leaves
+		{"join and leave", []int{1000}, []transfer{{0, 2000, []int{0}}, {1000, 500, []int{0}}}, []int{2500, 2000}},
+
+		// the flow held by the second link keeps its rate when the other one leaves
+		{"bottleneck elsewhere", []int{1000, 250}, []transfer{{0, 1500, []int{0}}, {0, 1000, []int{0, 1}}}, []int{2000, 4000}},
+
+		// flows on other links do not slow each other down
+		{"disjoint", []int{1000, 1000}, []transfer{{0, 1000, []int{0}}, {0, 2000, []int{1}}}, []int{1000, 2000}},
+	}
+
+	for _, test := range tests {
+		execParams.scheduler = MakeScheduler()
+		execParams.flows = makeFlowNetwork()
+		scheduler := execParams.scheduler
+
+		ends := make([]time.Duration, len(test.transfers))
+		for i, transfer := range test.transfers {
+			i, transfer := i, transfer
+			scheduler.Go(func() {
+				scheduler.Sleep(time.Duration(transfer.start) * time.Millisecond)
+
+				links := make([]*link, 0, len(transfer.links))
+				for _, index := range transfer.links {
+					links = append(links, execParams.flows.link(fmt.Sprintf("link-%d", index), test.capacities[index]))
+				}
+				execParams.flows.transfer(transfer.size, links...)
+
+				ends[i] = scheduler.Elapsed()
+			})
+		}
+		scheduler.Run()
+
+		for i, end := range test.ends {
+			if ends[i] != time.Duration(end)*time.Millisecond {
+				t.Errorf("%s: transfer %d ends at %v, expected %v", test.name, i, ends[i], time.Duration(end)*time.Millisecond)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package simulator
+
+import (
+	"time"
+
+	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// gossip follows the Fabric block dissemination within an organization:
+// the leader peer pushes every block it pulls from the orderers to a few random peers,
+// each peer pushes a block it sees first to a few more,
+// and every peer periodically pulls the blocks it has missed from a random peer
+
+// accept buffers the block and passes on to commit all the blocks that follow in order;
+// it returns false for a block the peer already has
+func (peer *Peer) accept(block *Block) bool {
+
+	number := block.header.Number
+	if number < peer.height || peer.received[number] != nil {
+		return false
+	}
+	peer.received[number] = block
+
+	for next := peer.received[peer.height]; next != nil; next = peer.received[peer.height] {
+		delete(peer.received, peer.height)
+		peer.height++
+		peer.blockChannel.Put(next)
+	}
+
+	return true
+}
+
+// push sends the block to fanout random peers of the organization except the one it came from
+func (peer *Peer) push(block *Block, from int) {
+
+	if !sysParams.Gossip {
+		return
+	}
+
+	for _, target := range peer.gossipTargets(sysParams.GossipFanout, from) {
+		target := target
+		execParams.scheduler.Go(func() {
+			if peer.sendGossip(target, GossipBlock{block}) && target.accept(block) {
+				target.push(block, peer.id)
+			}
+		})
+	}
+}
+
+// anti-entropy: exchange ledger heights with a random peer of the organization and pull the missing blocks
+func (peer *Peer) runAntiEntropy() {
+	for {
+		execParams.scheduler.Sleep(time.Duration(sysParams.GossipPullInterval) * time.Millisecond)
+		if peer.stopped {
+			return
+		}
+		if peer.down() {
+			continue
+		}
+
+		other := peer.gossipTargets(1, peer.id)[0]
+		if !peer.sendGossip(other, peer.stateInfo(peer.height)) || !other.sendGossip(peer, other.stateInfo(len(other.blocks))) {
+			continue
+		}
+
+		for number := peer.height; number < len(other.blocks); number++ {
+			if peer.received[number] == nil && other.sendGossip(peer, GossipBlock{other.blocks[number]}) {
+				peer.accept(other.blocks[number])
+			}
+		}
+	}
+}
+
+// gossipTargets picks up to count random peers of the organization other than this one and the excluded one
+func (peer *Peer) gossipTargets(count, excluded int) (targets []*Peer) {
+
+	candidates := make([]*Peer, 0)
+	for _, id := range sysParams.OrganizationPeers(peer.org) {
+		if id != peer.id && id != excluded {
+			candidates = append(candidates, execParams.network.peers[id])
+		}
+	}
+
+	// partial Fisher-Yates shuffle
+	for i := 0; i < count && i < len(candidates); i++ {
+		j := i + int(helpers.RandomULong(peer.gossipPrg)%uint64(len(candidates)-i))
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+		targets = append(targets, candidates[i])
+	}
+
+	return
+}
+
+// sendGossip tells whether the message has made it; blocks held back by faults count against their transactions
+func (peer *Peer) sendGossip(target *Peer, message transferable) bool {
+	affected := make(faultSet)
+	delivered := transmit(peer.name(), target.name(), message, affected)
+	execParams.network.gossipBytes += message.size()
+	if gossip, isBlock := message.(GossipBlock); isBlock {
+		gossip.block.affect(affected)
+	}
+	return delivered
+}
+
+// GossipBlock is a block pushed or pulled among the peers of an organization
+type GossipBlock struct {
+	block *Block
+}
+
+func (message GossipBlock) size() int {
+	return helpers.EncodedSize(helpers.WireGossipBlock{
+		Channel:  helpers.WireChannel,
+		Sequence: message.block.header.Number,
+		Block:    message.block.encoded,
+	})
+}
+
+func (message GossipBlock) name() string {
+	return "gossip-block"
+}
+
+// GossipStateInfo is the signed ledger height a peer advertises for anti-entropy
+type GossipStateInfo struct {
+	height    int
+	pkiID     []byte
+	signature dac.SchnorrSignature
+}
+
+func (peer *Peer) stateInfo(height int) GossipStateInfo {
+	return GossipStateInfo{
+		height:    height,
+		pkiID:     peer.pkiID,
+		signature: peer.stateSignature,
+	}
+}
+
+func (message GossipStateInfo) size() int {
+	return helpers.EncodedSize(helpers.WireGossipStateInfo{
+		Channel:   helpers.WireChannel,
+		Height:    message.height,
+		PKIID:     message.pkiID,
+		Signature: encoded("signature", message.signature.ToBytes),
+	})
+}
+
+func (message GossipStateInfo) name() string {
+	return "gossip-state-info"
+}
@@ -1,13 +1,16 @@
 package simulator
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/dbogatov/dac-lib/dac"
 	"github.com/dbogatov/fabric-amcl/amcl"
-	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
 	"github.com/dbogatov/fabric-simulator/helpers"
+	"golang.org/x/exp/rand"
 	"gonum.org/v1/gonum/stat/distuv"
 )
 
@@ -17,10 +20,17 @@ type Network struct {
 	auditor       KeysHolder
 	organizations []Organization
 	users         []User
-	peers         []Peer
-	transactions  []Transaction
+	peers         []*Peer
+	orderers      []*Orderer
+	completed     int // transactions
+	expected      int // from all users
+	blocks        int
+	elections     int
 
-	revocationAuthority RevocationAuthority
+	deliveredBytes int // of blocks sent by the orderers
+	gossipBytes    int // of blocks and state sent among peers
+
+	revocationAuthority *RevocationAuthority
 	epoch               int
 
 	transactionRecordLock *sync.Mutex
@@ -29,7 +39,11 @@ type Network struct {
 // MakeNetwork ...
 func MakeNetwork(prg *amcl.RAND, rootSk dac.SK) (network *Network) {
 
-	auditSk, auditPk := dac.GenerateKeys(prg, 2) // user level
+	auditSk, auditPk := dac.GenerateKeys(prg, userLevel)
+
+	if sysParams.CostModel {
+		execParams.templates = makeCryptoTemplates(prg, rootSk, auditPk)
+	}
 
 	network = &Network{
 		root: CredentialsHolder{
@@ -46,164 +60,162 @@ func MakeNetwork(prg *amcl.RAND, rootSk dac.SK) (network *Network) {
 			sk: auditSk,
 		},
 		transactionRecordLock: &sync.Mutex{},
-		revocationAuthority:   *MakeRevocationAuthority(),
+		revocationAuthority:   MakeRevocationAuthority(helpers.NewRandDerived(sysParams.Seed, "revocation-authority")),
 		epoch:                 1,
-		users:                 make([]User, sysParams.Orgs*sysParams.Users),
+		users:                 make([]User, sysParams.TotalUsers()),
+		expected:              sysParams.TotalTransactions(),
 	}
-	credStarter := network.root.credentials.ToBytes()
 
 	logger.Notice("Root CA has been initialized")
 
-	network.generateOrganizations(prg, credStarter, rootSk)
-	network.generateUsers(prg)
+	network.generateOrganizations(rootSk)
+	network.generateUsers()
 	network.generatePeers()
+	network.generateOrderers()
+	network.scheduleCrashes()
+	execParams.faults.schedule()
 
 	return
 }
 
-func (network *Network) generateOrganizations(prg *amcl.RAND, credStarter []byte, rootSk dac.SK) {
-	const orgLevel = 1
+func (network *Network) generateOrganizations(rootSk dac.SK) {
 
 	organizations := make(chan Organization, sysParams.Orgs)
-	var wgOrg sync.WaitGroup
+	wgOrg := execParams.scheduler.MakeWaitGroup()
 	wgOrg.Add(sysParams.Orgs)
 
 	for org := 0; org < sysParams.Orgs; org++ {
 
-		go func(org int, seed []byte) {
+		org := org
+		execParams.scheduler.Go(func() {
 			defer wgOrg.Done()
 
-			prg := helpers.NewRandSeed(seed)
-
-			orgSk, orgPk := dac.GenerateKeys(prg, orgLevel)
-
-			// Credential request
-
-			rootNonce := helpers.RandomBytes(prg, helpers.NonceSize)
-			recordBandwidth("root", fmt.Sprintf("org-%d", org), Nonce{rootNonce})
-
-			credRequest := dac.MakeCredRequest(prg, orgSk, rootNonce, orgLevel)
-			recordBandwidth(fmt.Sprintf("org-%d", org), "root", CredRequest{credRequest})
+			prg := helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("org-%d", org))
 
-			if e := credRequest.Validate(); e != nil {
-				panic(e)
-			}
-
-			// Root CA delegates the credentials
-
-			attributes := []interface{}{
-				dac.ProduceAttributes(orgLevel, fmt.Sprintf("org-%d", org))[0],
-				dac.ProduceAttributes(orgLevel, "has-right-to-post")[0],
-			}
-
-			credsOrg := dac.CredentialsFromBytes(credStarter)
-			if e := credsOrg.Delegate(rootSk, orgPk, attributes, prg, sysParams.Ys); e != nil {
-				panic(e)
-			}
-			recordCryptoEvent(credDelegation)
-			recordBandwidth("root", fmt.Sprintf("org-%d", org), Credentials{credsOrg})
+			// the keys certify the peers in both modes
+			orgSk, orgPk := generateKeys(prg, orgLevel)
 
-			if e := credsOrg.Verify(orgSk, sysParams.RootPk, sysParams.Ys); e != nil {
-				panic(e)
-			}
-
-			organizations <- Organization{
+			organization := Organization{
 				CredentialsHolder: CredentialsHolder{
 					KeysHolder: KeysHolder{
 						pk: orgPk,
 						sk: orgSk,
 					},
-					credentials: *credsOrg,
-					kind:        "org",
-					id:          org,
+					kind: "org",
+					id:   org,
 				},
 			}
 
-		}(org, helpers.RandomBytes(prg, 32))
+			if sysParams.X509() {
+				// each organization runs its own certificate authority, which all peers trust
+				organization.authority = makeX509Authority(prg, organization.name())
+			} else {
+				organization.credentials = *network.delegateToOrganization(prg, rootSk, organization.CredentialsHolder)
+			}
+
+			organizations <- organization
+
+		})
 	}
 
 	wgOrg.Wait()
 	close(organizations)
 
+	network.organizations = make([]Organization, sysParams.Orgs)
 	for org := range organizations {
-		network.organizations = append(network.organizations, org)
+		network.organizations[org.id] = org
 	}
 
 	logger.Notice("All organizations have received their credentials")
 }
 
-func (network *Network) generateUsers(prg *amcl.RAND) {
-	const userLevel = 2
+// delegateToOrganization has the root CA delegate Idemix credentials to an organization
+func (network *Network) delegateToOrganization(prg *amcl.RAND, rootSk dac.SK, org CredentialsHolder) *dac.Credentials {
 
-	users := make(chan *User, sysParams.Users*sysParams.Orgs)
-	var wgUser sync.WaitGroup
-	wgUser.Add(sysParams.Orgs * sysParams.Users)
+	// Credential request
 
-	for org := 0; org < sysParams.Orgs; org++ {
+	rootNonce := helpers.RandomBytes(prg, helpers.NonceSize)
+	recordBandwidth("root", org.name(), Nonce{rootNonce})
 
-		for user := 0; user < sysParams.Users; user++ {
+	credRequest := makeCredRequest(prg, org.sk, rootNonce, orgLevel)
+	recordBandwidth(org.name(), "root", CredRequest{credRequest, org.id})
 
-			go func(user, org int, seed []byte) {
+	if e := validateCredRequest(credRequest); e != nil {
+		panic(e)
+	}
 
-				defer wgUser.Done()
+	// Root CA delegates the credentials
 
-				prg := helpers.NewRandSeed(seed)
+	credsOrg, e := delegateCredentials(prg, &network.root.credentials, rootSk, org.pk, orgLevel, org.name(), "has-right-to-post")
+	if e != nil {
+		panic(e)
+	}
+	recordBandwidth("root", org.name(), Credentials{credsOrg})
 
-				userName := fmt.Sprintf("user-%d", org*sysParams.Users+user)
-				organization := network.organizations[org]
-				orgName := fmt.Sprintf("org-%d", organization.id)
+	if e := verifyCredentials(credsOrg, org.sk); e != nil {
+		panic(e)
+	}
 
-				userSk, userPk := dac.GenerateKeys(prg, userLevel)
+	return credsOrg
+}
 
-				// Credential request
+func (network *Network) generateUsers() {
 
-				orgNonce := helpers.RandomBytes(prg, helpers.NonceSize)
-				recordBandwidth(orgName, userName, Nonce{orgNonce})
+	users := make(chan *User, sysParams.TotalUsers())
+	wgUser := execParams.scheduler.MakeWaitGroup()
+	wgUser.Add(sysParams.TotalUsers())
 
-				credRequest := dac.MakeCredRequest(prg, userSk, orgNonce, userLevel)
-				recordBandwidth(userName, orgName, CredRequest{credRequest})
+	first := 0 // id of the first user of the organization
+	for org := 0; org < sysParams.Orgs; org++ {
 
-				if e := credRequest.Validate(); e != nil {
-					panic(e)
-				}
+		for user := 0; user < sysParams.Organizations[org].Users; user++ {
 
-				// Organization delegates the credentials
+			id, org := first+user, org
+			execParams.scheduler.Go(func() {
 
-				attributes := []interface{}{
-					dac.ProduceAttributes(userLevel, userName)[0],
-					dac.ProduceAttributes(userLevel, "has-right-to-post")[0],
-				}
+				defer wgUser.Done()
 
-				credsUser := dac.CredentialsFromBytes(organization.credentials.ToBytes())
-				if e := credsUser.Delegate(organization.sk, userPk, attributes, prg, sysParams.Ys); e != nil {
-					panic(e)
-				}
-				recordCryptoEvent(credDelegation)
-				recordBandwidth(orgName, userName, Credentials{credsUser})
+				userName := fmt.Sprintf("user-%d", id)
+				prg := helpers.NewRandDerived(sysParams.Seed, userName)
+				organization := network.organizations[org]
 
-				if e := credsUser.Verify(userSk, sysParams.RootPk, sysParams.Ys); e != nil {
-					panic(e)
+				arrivals := sysParams.UserArrivals(id)
+				class := sysParams.UserClass(id)
+
+				identity := CredentialsHolder{
+					kind: "user",
+					id:   id,
+				}
+				var revocationPK dac.PK
+				var key *ecdsa.PrivateKey
+				var certificate []byte
+
+				if sysParams.X509() {
+					key, certificate = enrollX509User(prg, organization, userName)
+				} else {
+					identity.KeysHolder, identity.credentials = delegateToUser(prg, organization, userName, id)
+					revocationPK = makeRevocationPk(identity.sk)
 				}
 
 				users <- &User{
-					CredentialsHolder: CredentialsHolder{
-						KeysHolder: KeysHolder{
-							pk: userPk,
-							sk: userSk,
-						},
-						credentials: *credsUser,
-						kind:        "user",
-						id:          org*sysParams.Users + user,
-					},
-					revocationPK: FP256BN.ECP_generator().Mul(userSk),
-					org:          org,
+					CredentialsHolder: identity,
+					ecdsaKey:          key,
+					certificate:       certificate,
+					revocationPK:      revocationPK,
+					org:               org,
+					class:             class,
+					chaincodes:        execParams.chaincodes.Reweighted(class.Mix),
 					poisson: distuv.Poisson{
-						Lambda: 3600.0 / float64(sysParams.Frequency),
+						Lambda: 3600.0 / float64(arrivals.Frequency),
+						Src:    rand.NewSource(helpers.RandomULong(prg)),
 					},
+					prg:  prg,
+					keys: helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("%s-keys", userName)),
 				}
 
-			}(user, org, helpers.RandomBytes(prg, 32))
+			})
 		}
+		first += sysParams.Organizations[org].Users
 	}
 
 	wgUser.Wait()
@@ -216,32 +228,191 @@ func (network *Network) generateUsers(prg *amcl.RAND) {
 	logger.Notice("All users have received their credentials")
 }
 
+// delegateToUser has the organization delegate Idemix credentials to a user
+func delegateToUser(prg *amcl.RAND, organization Organization, userName string, id int) (keys KeysHolder, credentials dac.Credentials) {
+
+	orgName := organization.name()
+
+	userSk, userPk := generateKeys(prg, userLevel)
+
+	// Credential request
+
+	orgNonce := helpers.RandomBytes(prg, helpers.NonceSize)
+	recordBandwidth(orgName, userName, Nonce{orgNonce})
+
+	credRequest := makeCredRequest(prg, userSk, orgNonce, userLevel)
+	recordBandwidth(userName, orgName, CredRequest{credRequest, id})
+
+	if e := validateCredRequest(credRequest); e != nil {
+		panic(e)
+	}
+
+	// Organization delegates the credentials
+
+	credsUser, e := delegateCredentials(prg, &organization.credentials, organization.sk, userPk, userLevel, userName, "has-right-to-post")
+	if e != nil {
+		panic(e)
+	}
+	recordBandwidth(orgName, userName, Credentials{credsUser})
+
+	if e := verifyCredentials(credsUser, userSk); e != nil {
+		panic(e)
+	}
+
+	return KeysHolder{pk: userPk, sk: userSk}, *credsUser
+}
+
+// enrollX509User has the certificate authority of the organization certify a key of the user, as Fabric CA enrolls
+func enrollX509User(prg *amcl.RAND, organization Organization, userName string) (key *ecdsa.PrivateKey, certificate []byte) {
+
+	orgName := organization.name()
+
+	key = generateECDSAKey(prg)
+
+	request := makeCertificateRequest(prg, key, userName, orgName)
+	recordBandwidth(userName, orgName, CertificateRequest{request})
+
+	certificate, e := issueX509Certificate(prg, organization.authority, request)
+	if e != nil {
+		panic(e)
+	}
+	recordBandwidth(orgName, userName, X509Certificate{certificate})
+
+	return
+}
+
 func (network *Network) generatePeers() {
 	for peer := 0; peer < sysParams.Peers; peer++ {
-		network.peers = append(network.peers, *MakePeer(peer))
+		prg := helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("peer-%d", peer))
+		organization := &network.organizations[sysParams.PeerOrganization(peer)]
+		network.peers = append(network.peers, MakePeer(prg, peer, organization))
 	}
 
 	logger.Notice("All peers have been spinned up")
 }
 
+func (network *Network) generateOrderers() {
+	for orderer := 0; orderer < sysParams.Orderers; orderer++ {
+		prg := helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("orderer-%d", orderer))
+		network.orderers = append(network.orderers, MakeOrderer(prg, orderer))
+	}
+
+	logger.Notice("All orderers have been spinned up")
+}
+
+func (network *Network) scheduleCrashes() {
+	for _, crash := range sysParams.OrdererCrashes {
+		crash := crash
+		execParams.scheduler.Go(func() {
+			execParams.scheduler.Sleep(time.Duration(crash.At) * time.Millisecond)
+
+			var orderer *Orderer
+			if crash.Leader {
+				for _, candidate := range network.orderers {
+					if candidate.up && candidate.state == leader {
+						orderer = candidate
+						break
+					}
+				}
+				if orderer == nil {
+					logger.Warning("No leader to crash")
+					return
+				}
+			} else {
+				orderer = network.orderers[crash.Orderer]
+				if !orderer.up {
+					logger.Warningf("%s is already down", orderer.name())
+					return
+				}
+			}
+
+			orderer.crash()
+			execParams.scheduler.Sleep(time.Duration(crash.Downtime) * time.Millisecond)
+			orderer.recover()
+		})
+	}
+}
+
+// settle waits for the peers that faults have held back to catch up with the orderers
+func (network *Network) settle() {
+	for {
+		height := 0
+		for _, orderer := range network.orderers {
+			if len(orderer.committedBlocks) > height {
+				height = len(orderer.committedBlocks)
+			}
+		}
+
+		behind := 0
+		for _, peer := range network.peers {
+			if len(peer.blocks) < height {
+				behind++
+			}
+		}
+		if behind == 0 {
+			return
+		}
+
+		logger.Noticef("Waiting for %d peers to catch up with %d blocks", behind, height)
+		execParams.scheduler.Sleep(deliveryRetry)
+	}
+}
+
+// checkLedgers makes sure that all peers have committed the same chain
+func (network *Network) checkLedgers() (e error) {
+	for _, peer := range network.peers[1:] {
+		if e = network.peers[0].ledger.Compare(&peer.ledger); e != nil {
+			return fmt.Errorf("peer-0 and peer-%d: %v", peer.id, e)
+		}
+		if !bytes.Equal(network.peers[0].state.Hash(), peer.state.Hash()) {
+			return fmt.Errorf("peer-0 and peer-%d: world states differ", peer.id)
+		}
+	}
+
+	logger.Noticef("All peers have the same ledger of %d blocks (%d bytes) and world state of %d keys", network.peers[0].ledger.Height(), network.peers[0].ledger.Bytes(), network.peers[0].state.Size())
+
+	return
+}
+
+// liveOrderer is the preferred orderer or, if it is down, the next one that is up;
+// a user notices a refused connection right away
+func (network *Network) liveOrderer(preferred int) *Orderer {
+	for i := 0; i < len(network.orderers); i++ {
+		if orderer := network.orderers[(preferred+i)%len(network.orderers)]; orderer.up {
+			return orderer
+		}
+	}
+	return network.orderers[preferred]
+}
+
+// notifyDelivery wakes the peers up to pull blocks after a commit, an orderer or a peer going down or up
+func (network *Network) notifyDelivery() {
+	for _, peer := range network.peers {
+		peer.deliverySignal.Put(true)
+	}
+}
+
 func (network *Network) stop() {
 	for _, peer := range network.peers {
-		peer.exitChannel <- true
+		peer.stop()
+	}
+	for _, orderer := range network.orderers {
+		orderer.stop()
 	}
-	network.revocationAuthority.exitChannel <- true
+	network.revocationAuthority.stop()
 
-	logger.Notice("All peers and the revocation authority have been shut down")
+	logger.Notice("All peers, orderers and the revocation authority have been shut down")
 }
 
-func (network *Network) recordTransaction(tx *Transaction) {
+func (network *Network) recordTransaction() {
 	network.transactionRecordLock.Lock()
 
 	defer network.transactionRecordLock.Unlock()
 
-	network.transactions = append(network.transactions, *tx)
+	network.completed++
 
-	current := len(network.transactions)
-	total := sysParams.Transactions * len(execParams.network.users)
+	current := network.completed
+	total := network.expected
 
 	logger.Noticef("%4.1f%% - transaction %d / %d", 100*float64(current)/float64(total), current, total)
 }
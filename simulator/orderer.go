@@ -0,0 +1,329 @@
+package simulator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-amcl/amcl"
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// Orderer is a node of the Raft ordering service.
+// Every orderer receives transactions from users, checks their identities and forwards them to the leader;
+// the leader cuts blocks, replicates them and commits them once a quorum has them.
+// Peers pull committed blocks from any orderer that is up.
+type Orderer struct {
+	KeysHolder
+
+	id  int
+	prg *amcl.RAND
+
+	up      bool
+	stopped bool
+
+	transactionChannel *Queue // from users
+	raftChannel        *Queue // Raft messages, forwarded transactions, ticks and batch timeouts
+
+	cache identityCache
+
+	// transactions this orderer has accepted from users and not yet seen committed;
+	// client timeouts are not modeled, so they survive a crash as if written ahead to disk
+	outstanding []*Transaction
+
+	raft
+
+	// block cutter state, leader only
+	pending      []*Transaction
+	pendingBytes int
+	batch        int // number of the batch being filled, to tell stale timeouts apart
+	blockHeight  int // number of blocks in the log
+	previousHash []byte
+	seen         map[*Transaction]bool
+}
+
+type batchTimeout struct {
+	batch int
+}
+
+// MakeOrderer ...
+func MakeOrderer(prg *amcl.RAND, id int) (orderer *Orderer) {
+	sk, pk := dac.GenerateKeys(prg, 0)
+	scheduler := execParams.scheduler
+
+	orderer = &Orderer{
+		id:                 id,
+		prg:                prg,
+		up:                 true,
+		transactionChannel: scheduler.MakeQueue(),
+		raftChannel:        scheduler.MakeQueue(),
+		KeysHolder: KeysHolder{
+			pk: pk,
+			sk: sk,
+		},
+		cache: makeIdentityCache(0),
+		raft:  makeRaft(),
+	}
+
+	// the cluster starts with orderer-0 elected for the first term
+	orderer.currentTerm = 1
+	orderer.votedFor = 0
+	orderer.leaderID = 0
+	orderer.resetElectionTimeout()
+	if id == 0 {
+		orderer.lead()
+	}
+
+	scheduler.Go(orderer.runReceiving)
+	scheduler.Go(orderer.run)
+	scheduler.Go(orderer.runTicker)
+
+	return
+}
+
+func (orderer *Orderer) name() string {
+	return fmt.Sprintf("orderer-%d", orderer.id)
+}
+
+// a nil message on any of the channels shuts the loop down
+
+func (orderer *Orderer) runReceiving() {
+	for message := orderer.transactionChannel.Get(); message != nil; message = orderer.transactionChannel.Get() {
+		tx := message.(*Transaction)
+		sender := fmt.Sprintf("user-%d", tx.proposal.authorID)
+		if tx.replayedBy != "" {
+			sender = tx.replayedBy
+		}
+		if !transmit(sender, orderer.name(), tx, tx.proposal.faults) {
+			continue
+		}
+		execParams.scheduler.Go(func() { orderer.receive(tx) })
+	}
+}
+
+// messages that arrive while the orderer is down are lost
+func (orderer *Orderer) run() {
+	for message := orderer.raftChannel.Get(); message != nil; message = orderer.raftChannel.Get() {
+		if orderer.up {
+			orderer.step(message)
+		}
+	}
+}
+
+func (orderer *Orderer) runTicker() {
+	for {
+		execParams.scheduler.Sleep(time.Duration(sysParams.RaftTick) * time.Millisecond)
+
+		if orderer.stopped {
+			break
+		}
+
+		orderer.raftChannel.Put(raftTick{})
+	}
+}
+
+func (orderer *Orderer) stop() {
+	orderer.stopped = true
+	orderer.transactionChannel.Put(nil)
+	orderer.raftChannel.Put(nil)
+}
+
+func (orderer *Orderer) crash() {
+	logger.Noticef("%s has crashed (term %d, %s)", orderer.name(), orderer.currentTerm, orderer.state)
+
+	orderer.up = false
+	orderer.becomeFollower(orderer.currentTerm, -1)
+
+	execParams.network.notifyDelivery()
+}
+
+func (orderer *Orderer) recover() {
+	logger.Noticef("%s has recovered", orderer.name())
+
+	orderer.up = true
+	orderer.resetElectionTimeout()
+
+	execParams.network.notifyDelivery()
+}
+
+func (orderer *Orderer) receive(tx *Transaction) {
+
+	if e := orderer.cache.validate(&tx.proposal, ordering); e != nil {
+		panic(e)
+	}
+
+	tx.orderer = orderer.id
+	orderer.outstanding = append(orderer.outstanding, tx)
+
+	orderer.forward(tx)
+
+	logger.Debugf("%s has accepted a transaction", orderer.name())
+}
+
+// sends the transaction to the leader, if there is one this orderer knows of
+func (orderer *Orderer) forward(tx *Transaction) {
+	if !orderer.up || orderer.leaderID < 0 {
+		return
+	}
+	if orderer.leaderID == orderer.id {
+		orderer.raftChannel.Put(tx)
+		return
+	}
+	orderer.send(orderer.leaderID, tx)
+}
+
+func (orderer *Orderer) forwardOutstanding() {
+	for _, tx := range orderer.outstanding {
+		orderer.forward(tx)
+	}
+}
+
+// the message is lost if the receiver is down by the time it arrives
+func (orderer *Orderer) send(to int, message transferable) {
+	receiver := execParams.network.orderers[to]
+	execParams.scheduler.Go(func() {
+		recordBandwidth(orderer.name(), receiver.name(), message)
+		if receiver.up {
+			receiver.raftChannel.Put(message)
+		}
+	})
+}
+
+func (orderer *Orderer) step(message interface{}) {
+	switch message := message.(type) {
+	case raftTick:
+		orderer.tick()
+	case *Transaction:
+		if orderer.state == leader && !orderer.seen[message] {
+			orderer.enqueue(message)
+		}
+	case batchTimeout:
+		if orderer.state == leader && message.batch == orderer.batch && len(orderer.pending) > 0 {
+			logger.Debugf("%s batch timeout", orderer.name())
+			orderer.cut()
+		}
+	case voteRequest:
+		orderer.handleVoteRequest(message)
+	case voteResponse:
+		orderer.handleVoteResponse(message)
+	case appendRequest:
+		orderer.handleAppendRequest(message)
+	case appendResponse:
+		orderer.handleAppendResponse(message)
+	}
+}
+
+/// Block cutting
+
+// follows the Fabric block cutter: a transaction that does not fit cuts the pending batch first,
+// and a transaction bigger than the limit goes into a block on its own
+func (orderer *Orderer) enqueue(tx *Transaction) {
+
+	orderer.seen[tx] = true
+
+	size := tx.size()
+
+	if len(orderer.pending) > 0 && orderer.pendingBytes+size > sysParams.MaxBlockBytes {
+		orderer.cut()
+	}
+
+	orderer.pending = append(orderer.pending, tx)
+	orderer.pendingBytes += size
+
+	if size > sysParams.MaxBlockBytes || len(orderer.pending) >= sysParams.BatchSize {
+		orderer.cut()
+		return
+	}
+
+	if len(orderer.pending) == 1 {
+		batch := orderer.batch
+		execParams.scheduler.Go(func() {
+			execParams.scheduler.Sleep(time.Duration(sysParams.BatchTimeout) * time.Millisecond)
+			orderer.raftChannel.Put(batchTimeout{batch})
+		})
+	}
+}
+
+func (orderer *Orderer) cut() {
+
+	block := &Block{
+		header: helpers.BlockHeader{
+			Number:       orderer.blockHeight,
+			PreviousHash: orderer.previousHash,
+		},
+		transactions: orderer.pending,
+		orderer:      orderer.id,
+	}
+	block.header.DataHash = block.getDataHash()
+
+	orderer.pending = nil
+	orderer.pendingBytes = 0
+	orderer.batch++
+	orderer.blockHeight++
+
+	message := block.getMessage()
+	orderer.previousHash = message
+
+	block.signature = signSchnorrMessage(orderer.prg, orderer.sk, message)
+	block.encoded = helpers.Encode(block.wire())
+
+	logger.Debugf("%s has cut block %d with %d transactions (%d bytes)", orderer.name(), block.header.Number, len(block.transactions), block.size())
+
+	// leadership may have been lost while signing
+	if orderer.up && orderer.state == leader {
+		orderer.propose(block)
+	}
+}
+
+// Block ...
+type Block struct {
+	header       helpers.BlockHeader
+	transactions []*Transaction
+	orderer      int
+	signature    dac.SchnorrSignature
+	encoded      []byte // once signed, for the orderers and peers to pass on
+}
+
+func (block *Block) getDataHash() (hash []byte) {
+
+	hashes := make([][]byte, 0, len(block.transactions))
+	for _, tx := range block.transactions {
+		hashes = append(hashes, tx.proposal.hash)
+	}
+
+	hash = helpers.DataHash(hashes)
+	recordCryptoEvent(sha3hash)
+
+	return
+}
+
+// the header hash is what the orderer signs and what the next block points to
+func (block *Block) getMessage() (message []byte) {
+
+	message = block.header.Hash()
+	recordCryptoEvent(sha3hash)
+
+	return
+}
+
+func (block Block) wire() (message helpers.WireBlock) {
+
+	message = helpers.WireBlock{
+		Header:    block.header,
+		Orderer:   block.orderer,
+		Signature: encoded("signature", block.signature.ToBytes),
+	}
+	for _, tx := range block.transactions {
+		message.Transactions = append(message.Transactions, helpers.Encode(tx.wire()))
+	}
+
+	return
+}
+
+func (block Block) size() int {
+	return len(block.encoded)
+}
+
+func (block Block) name() string {
+	return "block"
+}
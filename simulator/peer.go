@@ -1,18 +1,48 @@
 package simulator
 
 import (
-	"context"
+	"bytes"
 	"fmt"
 	"time"
 
 	"github.com/dbogatov/dac-lib/dac"
-	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
+	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-simulator/helpers"
-	"golang.org/x/sync/semaphore"
 )
 
 type operation int
 
+// validationCode is the outcome of validation, as in the transaction filter of a committed block
+type validationCode string
+
+const (
+	valid                    validationCode = "valid"
+	mvccReadConflict         validationCode = "mvcc-read-conflict"
+	endorsementMismatch      validationCode = "endorsement-mismatch"
+	badCreatorSignature      validationCode = "bad-creator-signature"
+	duplicateTxID            validationCode = "duplicate-txid"
+	badCertificate           validationCode = "bad-certificate"
+	badEndorsementSignature  validationCode = "bad-endorsement-signature"
+	endorsementPolicyFailure validationCode = "endorsement-policy-failure"
+	badIdentityProof         validationCode = "bad-identity-proof"
+	badAuditProof            validationCode = "bad-audit-proof"
+	badNonRevocationProof    validationCode = "bad-non-revocation-proof"
+)
+
+// invalidCodes are the reasons to reject a transaction, in the order of the report
+var invalidCodes = []validationCode{
+	mvccReadConflict,
+	endorsementMismatch,
+	badCreatorSignature,
+	duplicateTxID,
+	badCertificate,
+	badEndorsementSignature,
+	endorsementPolicyFailure,
+	badIdentityProof,
+	badAuditProof,
+	badNonRevocationProof,
+}
+
 const (
 	endorsement  operation = 0
 	ordering     operation = 1
@@ -23,203 +53,473 @@ const (
 type Peer struct {
 	KeysHolder
 
-	id int
-
-	ctx context.Context
-
-	endorsementSemaphore *semaphore.Weighted
-	validationSemaphore  *semaphore.Weighted
-
-	endorsementChannel chan *TransactionProposal
-	orderingChannel    chan *Transaction
-	validationChannel  chan *Transaction
-	exitChannel        chan bool
-
-	cache map[operation][][32]byte
+	id          int
+	prg         *amcl.RAND
+	org         int
+	certificate Certificate // issued by the organization that owns the peer
+
+	// what the peer advertises to gossip, if it gossips
+	pkiID          []byte
+	stateSignature dac.SchnorrSignature
+
+	endorsementSemaphore *Semaphore // the same pool of cores as validations if the peer has a hardware profile
+	validationSemaphore  *Semaphore
+	hardware             *helpers.HardwareProfile
+	cpuWait              time.Duration // for a core, over all endorsements and validations
+	cpuTasks             int
+
+	endorsementChannel *Queue
+	blockChannel       *Queue
+	deliverySignal     *Queue // orderers committing blocks or going down or up
+	restartSignal      *Queue // the peer coming back after a crash
+
+	cache        identityCache
+	certificates certificateCache
+
+	byzantine    []helpers.ByzantinePeer // behaviours of this peer
+	byzantinePrg *amcl.RAND              // decides when to misbehave
+	txids        map[string]bool         // of the committed transactions, to reject duplicates
+
+	gossipPrg *amcl.RAND     // picks the peers to gossip with
+	received  map[int]*Block // ahead of height, waiting for the missing ones
+	height    int            // number of blocks passed on to commit
+	stopped   bool
+
+	ledger helpers.Ledger
+	blocks []*Block // committed, for the audit
+	state  *helpers.WorldState
 }
 
 // MakePeer ...
-func MakePeer(id int) (peer *Peer) {
-	sk, pk := dac.GenerateKeys(helpers.NewRand(), 0)
+func MakePeer(prg *amcl.RAND, id int, organization *Organization) (peer *Peer) {
+	sk, pk := dac.GenerateKeys(prg, 0)
+	scheduler := execParams.scheduler
 
 	peer = &Peer{
 		id:                   id,
-		ctx:                  context.TODO(),
-		endorsementSemaphore: semaphore.NewWeighted(int64(sysParams.ConcurrentEndorsements)),
-		validationSemaphore:  semaphore.NewWeighted(int64(sysParams.ConcurrentValidations)),
-		endorsementChannel:   make(chan *TransactionProposal),
-		orderingChannel:      make(chan *Transaction),
-		validationChannel:    make(chan *Transaction),
-		exitChannel:          make(chan bool),
+		prg:                  prg,
+		org:                  organization.id,
+		endorsementSemaphore: scheduler.MakeSemaphore(sysParams.ConcurrentEndorsements),
+		validationSemaphore:  scheduler.MakeSemaphore(sysParams.ConcurrentValidations),
+		endorsementChannel:   scheduler.MakeQueue(),
+		blockChannel:         scheduler.MakeQueue(),
+		deliverySignal:       scheduler.MakeQueue(),
+		restartSignal:        scheduler.MakeQueue(),
 		KeysHolder: KeysHolder{
 			pk: pk,
 			sk: sk,
 		},
-		cache: make(map[operation][][32]byte, 3),
+		cache:        makeIdentityCache(0),
+		certificates: makeCertificateCache(0),
+		state:        helpers.MakeWorldState(),
+		gossipPrg:    helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("peer-%d-gossip", id)),
+		received:     make(map[int]*Block),
+		byzantinePrg: helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("peer-%d-byzantine", id)),
+		txids:        make(map[string]bool),
 	}
-	for _, op := range []operation{endorsement, ordering, verification} {
-		peer.cache[op] = make([][32]byte, 0)
+	for _, byzantine := range sysParams.Byzantine {
+		if byzantine.Peer == id {
+			peer.byzantine = append(peer.byzantine, byzantine)
+		}
+	}
+
+	speed := 1.0
+	if peer.hardware = sysParams.PeerHardware(id); peer.hardware != nil {
+		cores := scheduler.MakeSemaphore(peer.hardware.Cores)
+		peer.endorsementSemaphore, peer.validationSemaphore = cores, cores
+		speed = peer.hardware.Speed
+
+		if peer.hardware.Memory > 0 {
+			// three identity caches and the certificate cache share the memory
+			entries := peer.hardware.Memory << 20 / cacheEntrySize / 4
+			if entries == 0 {
+				entries = 1
+			}
+			peer.cache = makeIdentityCache(entries)
+			peer.certificates = makeCertificateCache(entries)
+		}
 	}
 
-	go peer.run()
+	peer.certificate = organization.issueCertificate(prg, id, pk)
+	recordBandwidth(organization.name(), peer.name(), peer.certificate)
+
+	scheduler.GoOn(speed, peer.runEndorsements)
+	scheduler.GoOn(speed, peer.runDelivery)
+	scheduler.GoOn(speed, peer.runValidations)
+	if sysParams.Gossip && len(sysParams.OrganizationPeers(peer.org)) > 1 {
+		peer.pkiID = helpers.Sha3(helpers.Encode(peer.certificate.wire()))
+		peer.stateSignature = signStateInfo(id, sk, peer.pkiID)
+		scheduler.GoOn(speed, peer.runAntiEntropy)
+	}
 
 	return
 }
 
-func (peer *Peer) run() {
-	for {
-		select {
-		case tp := <-peer.endorsementChannel:
-			recordBandwidth(fmt.Sprintf("user-%d", tp.authorID), fmt.Sprintf("peer-%d", peer.id), tp)
-			if e := peer.endorsementSemaphore.Acquire(peer.ctx, 1); e != nil {
-				panic(e)
-			}
-			go peer.endorse(tp)
-			continue
-		case tx := <-peer.orderingChannel:
-			recordBandwidth(fmt.Sprintf("user-%d", tx.proposal.authorID), fmt.Sprintf("peer-%d", peer.id), tx)
-			go peer.order(tx)
+// a nil message on any of the channels shuts the loop down
+
+func (peer *Peer) runEndorsements() {
+	for message := peer.endorsementChannel.Get(); message != nil; message = peer.endorsementChannel.Get() {
+		tp := message.(*TransactionProposal)
+		if !transmit(fmt.Sprintf("user-%d", tp.authorID), peer.name(), tp, tp.faults) {
 			continue
-		case tx := <-peer.validationChannel:
-			if tx.orderer != peer.id {
-				recordBandwidth(fmt.Sprintf("peer-%d", tx.orderer), fmt.Sprintf("peer-%d", peer.id), tx)
+		}
+		peer.acquireCore(peer.endorsementSemaphore)
+		execParams.scheduler.Go(func() { peer.endorse(tp) })
+	}
+}
+
+// like the Fabric deliver client, the peer pulls blocks in order from its orderer
+// and switches to the next one that is up when its orderer goes down;
+// a block lost on the way is requested again after a while
+func (peer *Peer) runDelivery() {
+	for {
+		orderer := peer.deliverer()
+
+		if orderer != nil && peer.isLeader() && len(orderer.committedBlocks) > peer.height {
+			block := orderer.committedBlocks[peer.height]
+			affected := make(faultSet)
+			delivered := transmit(orderer.name(), peer.name(), block, affected)
+			execParams.network.deliveredBytes += block.size()
+			block.affect(affected)
+			if !delivered {
+				if execParams.scheduler.Sleep(deliveryRetry); peer.stopped {
+					return
+				}
+				continue
 			}
-			if e := peer.validationSemaphore.Acquire(peer.ctx, 1); e != nil {
-				panic(e)
+			if peer.accept(block) {
+				peer.push(block, peer.id)
 			}
-			go peer.validate(tx)
 			continue
-		case <-peer.exitChannel:
 		}
-		break
+
+		if peer.deliverySignal.Get() == nil {
+			return
+		}
+	}
+}
+
+func (peer *Peer) deliverer() *Orderer {
+	if execParams.network == nil {
+		return nil
+	}
+	orderers := execParams.network.orderers
+	for i := 0; i < len(orderers); i++ {
+		if orderer := orderers[(peer.id+i)%len(orderers)]; orderer.up {
+			return orderer
+		}
+	}
+	return nil
+}
+
+// isLeader tells whether the peer pulls blocks from the orderers;
+// with gossip, only the first peer of the organization that is up does
+func (peer *Peer) isLeader() bool {
+	if peer.down() {
+		return false
+	}
+	if !sysParams.Gossip {
+		return true
 	}
+	for _, id := range sysParams.OrganizationPeers(peer.org) {
+		if !execParams.network.peers[id].down() {
+			return id == peer.id
+		}
+	}
+	return false
+}
+
+func (peer *Peer) down() bool {
+	return execParams.faults.isDown(peer.name())
+}
+
+// blocks are committed one at a time and in order; transactions of a block are validated in parallel;
+// a crashed peer resumes from its ledger once it is back
+func (peer *Peer) runValidations() {
+	for message := peer.blockChannel.Get(); message != nil; message = peer.blockChannel.Get() {
+		for peer.down() {
+			if peer.restartSignal.Get() == nil {
+				return
+			}
+		}
+		peer.commit(message.(*Block))
+	}
+}
+
+func (peer *Peer) name() string {
+	return fmt.Sprintf("peer-%d", peer.id)
+}
+
+// acquireCore waits for a slot of the semaphore, accounting the wait to the CPU of the peer
+func (peer *Peer) acquireCore(semaphore *Semaphore) {
+	start := execParams.scheduler.Now()
+	semaphore.Acquire()
+	peer.cpuWait += execParams.scheduler.Now().Sub(start)
+	peer.cpuTasks++
 }
 
-func (peer *Peer) validate(tx *Transaction) {
+func (peer *Peer) stop() {
+	peer.stopped = true
+	peer.endorsementChannel.Put(nil)
+	peer.blockChannel.Put(nil)
+	peer.deliverySignal.Put(nil)
+	peer.restartSignal.Put(nil)
+}
 
-	defer peer.validationSemaphore.Release(1)
+func (peer *Peer) commit(block *Block) {
 
-	if e := tx.signature.VerifyNym(sysParams.H, tx.proposal.pkNym, tx.proposal.getMessage()); e != nil {
+	if !bytes.Equal(block.getDataHash(), block.header.DataHash) {
+		panic(fmt.Sprintf("peer-%d: data of block %d does not match its header", peer.id, block.header.Number))
+	}
+
+	if e := verifySchnorrMessage(peer.prg, execParams.network.orderers[block.orderer].pk, block.signature, block.getMessage()); e != nil {
 		panic(e)
 	}
-	recordCryptoEvent(verifyNym)
 
-	if len(tx.endorsements) < sysParams.Endorsements {
-		panic("too few endorsements")
+	wg := execParams.scheduler.MakeWaitGroup()
+	wg.Add(len(block.transactions))
+
+	codes := make([]validationCode, len(block.transactions))
+	spent := make([]time.Duration, len(block.transactions))
+	for i, tx := range block.transactions {
+		i, tx := i, tx
+		peer.acquireCore(peer.validationSemaphore)
+		execParams.scheduler.Go(func() {
+			defer wg.Done()
+			start := execParams.scheduler.Now()
+			codes[i] = peer.validate(tx)
+			spent[i] = execParams.scheduler.Now().Sub(start)
+		})
 	}
 
-	schnorr := dac.MakeSchnorr(helpers.NewRand(), false)
-	for _, endorsement := range tx.endorsements {
-		if e := schnorr.Verify(execParams.network.peers[endorsement.endorser].pk, endorsement.signature, tx.proposal.getMessage()); e != nil {
-			panic(e)
+	wg.Wait()
+
+	// MVCC check in block order; it is negligible in comparison to crypto
+	for i, tx := range block.transactions {
+		if codes[i] == valid {
+			codes[i] = peer.check(tx)
+		}
+		peer.txids[tx.id()] = true
+		if codes[i] == valid {
+			peer.state.Apply(tx.rwset, helpers.Version{Block: block.header.Number, Transaction: i})
+		} else {
+			recordInvalid(codes[i], spent[i], peer.id == 0)
 		}
 	}
-	recordCryptoEvent(verifySchnorr)
 
-	peer.validateIdentity(tx.proposal.author, tx.proposal.pkNym, tx.proposal.indices, verification)
+	if e := peer.ledger.Append(block.header, block.size()); e != nil {
+		panic(fmt.Sprintf("peer-%d: %v", peer.id, e))
+	}
+	peer.blocks = append(peer.blocks, block)
 
-	if sysParams.Audit {
-		if e := tx.auditProof.Verify(tx.auditEnc, tx.proposal.pkNym, execParams.network.auditor.pk, sysParams.H); e != nil {
-			panic(e)
+	for i, tx := range block.transactions {
+		if tx.replayedBy == "" {
+			tx.doneChannel.Put(codes[i])
 		}
-		recordCryptoEvent(auditVerify)
 	}
 
-	if sysParams.Revoke {
-		// Verify non-revocation
-		if e := tx.nonRevocationProof.Verify(tx.proposal.pkNym, FP256BN.NewBIGint(tx.epoch), sysParams.H, execParams.network.revocationAuthority.pk, sysParams.Ys[1]); e != nil {
-			panic(e)
-		}
-		recordCryptoEvent(nonRevokeVerify)
+	logger.Debugf("peer-%d has committed block %d", peer.id, block.header.Number)
+
+	peer.replay(block)
+}
+
+// check decides whether a transaction that passed the crypto checks updates the world state
+func (peer *Peer) check(tx *Transaction) validationCode {
+
+	// an earlier transaction of the same block may have had the ID
+	if peer.txids[tx.id()] {
+		return duplicateTxID
 	}
 
-	// somewhere here are read/write conflict check and ledger update
-	// but they are negligible in comparison to crypto
+	// all endorsers must have simulated the same outcome
+	for _, endorsement := range tx.endorsements {
+		if !endorsement.rwset.Equal(tx.rwset) {
+			return endorsementMismatch
+		}
+	}
 
-	executeChaincode()
+	if !peer.state.Validate(tx.rwset) {
+		return mvccReadConflict
+	}
 
-	tx.doneChannel <- true
+	return valid
 }
 
-func (peer *Peer) order(tx *Transaction) {
+// validate runs the checks in the order of Fabric and stops at the first one that fails
+func (peer *Peer) validate(tx *Transaction) validationCode {
 
-	peer.validateIdentity(tx.proposal.author, tx.proposal.pkNym, tx.proposal.indices, ordering)
+	defer peer.validationSemaphore.Release()
 
-	tx.orderer = peer.id
+	if e := tx.proposal.verifySignature(tx.signature, tx.proposal.getMessage()); e != nil {
+		return badCreatorSignature
+	}
+
+	if peer.txids[tx.id()] {
+		return duplicateTxID
+	}
+
+	// endorsers are known only by the certificates their organizations issued
+	endorsers := make([]helpers.Identity, 0, len(tx.endorsements))
+	for _, endorsement := range tx.endorsements {
+		if e := peer.certificates.validate(peer.prg, endorsement.certificate); e != nil {
+			logger.Debugf("peer-%d rejects an endorsement: %v", peer.id, e)
+			return badCertificate
+		}
+		if e := verifySchnorrMessage(peer.prg, endorsement.certificate.pk, endorsement.signature, tx.proposal.getMessage()); e != nil {
+			logger.Debugf("peer-%d rejects an endorsement of %s: %v", peer.id, endorsement.certificate.subject(), e)
+			return badEndorsementSignature
+		}
+		endorsers = append(endorsers, endorsement.certificate.identity())
+	}
+	if satisfied, e := execParams.chaincodes.Get(tx.proposal.chaincode).Policy().Satisfied(endorsers); e != nil {
+		panic(e)
+	} else if !satisfied {
+		return endorsementPolicyFailure
+	}
+
+	if e := peer.cache.validate(&tx.proposal, verification); e != nil {
+		return badIdentityProof
+	}
+
+	if sysParams.Audit {
+		if e := auditingVerify(tx.auditProof, tx.auditEnc, tx.proposal.pkNym, execParams.network.auditor.pk); e != nil {
+			return badAuditProof
+		}
+	}
 
-	for _, other := range execParams.network.peers {
-		other.validationChannel <- tx
+	if tx.proposal.revocable() {
+		// Verify non-revocation
+		if e := verifyNonRevocation(tx.nonRevocationProof, tx.proposal.pkNym, tx.epoch, execParams.network.revocationAuthority.pk); e != nil {
+			return badNonRevocationProof
+		}
 	}
 
-	logger.Debugf("peer-%d has ordered a transaction", peer.id)
+	// charged again as in endorsement, the outcome is already in the transaction
+	peer.executeChaincode(&tx.proposal)
+
+	return valid
 }
 
 func (peer *Peer) endorse(tp *TransactionProposal) {
 
-	defer peer.endorsementSemaphore.Release(1)
+	defer peer.endorsementSemaphore.Release()
 
 	// Verify signature
-	if e := tp.signature.VerifyNym(sysParams.H, tp.pkNym, tp.getMessage()); e != nil {
+	if e := tp.verifySignature(tp.signature, tp.getMessage()); e != nil {
 		panic(e)
 	}
-	recordCryptoEvent(verifyNym)
 	// Verify author
 	// Ideally should verify that tp.indices[0].Attribute is equal to the expected value that permits using the blockchain
-	peer.validateIdentity(tp.author, tp.pkNym, tp.indices, endorsement)
+	if e := peer.cache.validate(tp, endorsement); e != nil {
+		panic(e)
+	}
 
 	// Verify read / write permissions (should be cached)
-	peer.validateIdentity(tp.author, tp.pkNym, tp.indices, endorsement)
+	if e := peer.cache.validate(tp, endorsement); e != nil {
+		panic(e)
+	}
 
 	// Execute proposal
-	executeChaincode()
+	rwset := peer.executeChaincode(peer.tamper(tp))
 
 	// All set!
-	schnorr := dac.MakeSchnorr(helpers.NewRand(), false)
-
 	logger.Debugf("peer-%d endorsed transaction payload %s", peer.id, fmt.Sprintf("user-%d", tp.authorID))
-	endorsement := Endorsement{
-		signature: schnorr.Sign(peer.sk, tp.getMessage()),
-		endorser:  peer.id,
+	endorsement := peer.sign(tp, rwset)
+	if transmit(peer.name(), fmt.Sprintf("user-%d", tp.authorID), endorsement, tp.faults) {
+		tp.doneChannel.Put(endorsement)
 	}
-	recordCryptoEvent(signSchnorr)
-	recordBandwidth(fmt.Sprintf("peer-%d", peer.id), fmt.Sprintf("user-%d", tp.authorID), endorsement)
+}
+
+// cacheEntrySize is the memory a verified identity or certificate takes in a cache, deserialized
+const cacheEntrySize = 4 << 10
+
+// verifiedSet remembers what an actor has verified and forgets the oldest entries once it is full
+type verifiedSet struct {
+	entries  map[[32]byte]bool
+	order    [][32]byte
+	capacity int // unlimited if 0
+}
 
-	tp.doneChannel <- endorsement
+func makeVerifiedSet(capacity int) *verifiedSet {
+	return &verifiedSet{
+		entries:  make(map[[32]byte]bool),
+		capacity: capacity,
+	}
 }
 
-func (peer *Peer) validateIdentity(proof []byte, pkNym interface{}, indices dac.Indices, op operation) {
+func (set *verifiedSet) contains(key [32]byte) bool {
+	return set.entries[key]
+}
 
+func (set *verifiedSet) add(key [32]byte) {
+	if set.capacity > 0 && len(set.order) == set.capacity {
+		delete(set.entries, set.order[0])
+		set.order = set.order[1:]
+	}
+	set.entries[key] = true
+	set.order = append(set.order, key)
+}
+
+// identityCache remembers identities an actor has already verified, per operation
+type identityCache map[operation]*verifiedSet
+
+func makeIdentityCache(capacity int) (cache identityCache) {
+	cache = make(map[operation]*verifiedSet, 3)
+	for _, op := range []operation{endorsement, ordering, verification} {
+		cache[op] = makeVerifiedSet(capacity)
+	}
+	return
+}
+
+func (cache identityCache) validate(tp *TransactionProposal, op operation) (e error) {
+
+	// proposal hash is part of the key since in cost-model mode all proofs are the same
 	var key [32]byte
-	copy(key[:], helpers.Sha3(proof)[:4])
+	copy(key[:], helpers.Sha3(append(append([]byte{}, tp.author...), tp.hash...))[:4])
 	recordCryptoEvent(sha3hash)
-	for _, cached := range peer.cache[op] {
-		if cached == key {
-			return
-		}
+	if cache[op].contains(key) {
+		return
 	}
-	proofObj := dac.ProofFromBytes(proof)
-	if e := proofObj.VerifyProof(sysParams.RootPk, sysParams.Ys, sysParams.H, pkNym, indices, []byte{}); e != nil {
-		panic(e)
+	if e = tp.verifyAuthor(); e != nil {
+		return
 	}
-	recordCryptoEvent(credVerify)
 
-	peer.cache[op] = append(peer.cache[op], key)
+	cache[op].add(key)
+
+	return
 }
 
-func executeChaincode() {
-	// TODO
-	time.Sleep(50 * time.Millisecond)
+func (peer *Peer) executeChaincode(tp *TransactionProposal) helpers.ReadWriteSet {
+
+	chaincode := execParams.chaincodes.Get(tp.chaincode)
+	if chaincode == nil {
+		panic(fmt.Sprintf("peer-%d does not have chaincode %s", peer.id, tp.chaincode))
+	}
+
+	rwset, cost := chaincode.Execute(helpers.Invocation{Keys: tp.keys, Argument: tp.argument()}, peer.state, execParams.chaincodeSource)
+	execParams.scheduler.Sleep(onCPU(cost))
+
+	return rwset
 }
 
 // Endorsement ...
 type Endorsement struct {
-	signature dac.SchnorrSignature
-	endorser  int
+	endorser    int // known to the client from the connection
+	signature   dac.SchnorrSignature
+	certificate Certificate
+	rwset       helpers.ReadWriteSet
+}
+
+func (endorsement Endorsement) wire() helpers.WireEndorsement {
+	return helpers.WireEndorsement{
+		Signature:   encoded("signature", endorsement.signature.ToBytes),
+		Certificate: endorsement.certificate.wire(),
+		RWSet:       endorsement.rwset,
+	}
 }
 
 func (endorsement Endorsement) size() int {
-	// Schnorr(ECP2 + BIG) + endorser ID
-	return 5*32 + CertificateSize
+	return helpers.EncodedSize(endorsement.wire())
 }
 
 func (endorsement Endorsement) name() string {
@@ -228,27 +528,53 @@ func (endorsement Endorsement) name() string {
 
 // Transaction ...
 type Transaction struct {
-	signature          dac.NymSignature
+	signature          creatorSignature
 	proposal           TransactionProposal
 	auditProof         dac.AuditingProof
 	auditEnc           dac.AuditingEncryption
 	endorsements       []Endorsement
+	rwset              helpers.ReadWriteSet
 	nonRevocationProof dac.RevocationProof
 	epoch              int
-	orderer            int
-	doneChannel        chan bool
+	orderer            int       // the orderer that accepted the transaction
+	ordered            time.Time // when the block with the transaction was committed by the orderers
+	doneChannel        *Queue
+	replayedBy         string // the Byzantine peer that has submitted the transaction again
 }
 
-func (transaction Transaction) size() int {
-	auditingSize := 0
+// id is unique for a proposal, as the Fabric transaction ID derived from the nonce and the creator
+func (transaction *Transaction) id() string {
+	return string(transaction.proposal.hash)
+}
+
+func (transaction Transaction) wire() (message helpers.WireTransaction) {
+
+	message = helpers.WireTransaction{
+		Signature: transaction.signature.bytes(),
+		Proposal:  transaction.proposal.wire(),
+		RWSet:     transaction.rwset,
+		Epoch:     transaction.epoch,
+	}
+
+	// endorsements carry the same read/write set, which is only included once
+	for _, endorsement := range transaction.endorsements {
+		endorsement.rwset = helpers.ReadWriteSet{}
+		message.Endorsements = append(message.Endorsements, endorsement.wire())
+	}
+
 	if sysParams.Audit {
-		auditingSize = 4*32 + 2*4*32
+		message.AuditProof = encoded("auditing-proof", transaction.auditProof.ToBytes)
+		message.AuditEnc = encoded("auditing-encryption", transaction.auditEnc.ToBytes)
 	}
-	revocationSize := 0
-	if sysParams.Revoke {
-		revocationSize = 3*32 + 3*(1+2*32) + 4*32 + 4
+	if transaction.proposal.revocable() {
+		message.NonRevocationProof = encoded("non-revocation-proof", transaction.nonRevocationProof.ToBytes)
 	}
-	return len(transaction.signature.ToBytes()) + transaction.proposal.size() + auditingSize + len(transaction.endorsements)*transaction.endorsements[0].size() + revocationSize
+
+	return
+}
+
+func (transaction Transaction) size() int {
+	return helpers.EncodedSize(transaction.wire())
 }
 
 func (transaction Transaction) name() string {
@@ -0,0 +1,134 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// CostProfileVersion is bumped whenever the profile format changes incompatibly
+const CostProfileVersion = 1
+
+// CostProfile describes how long every crypto event takes on some machine
+type CostProfile struct {
+	Version    int
+	Host       string
+	GOMAXPROCS int
+	Created    string
+	Attributes int // attributes per credential link
+	YsNum      int
+	Events     []EventCost
+}
+
+// EventCost ...
+type EventCost struct {
+	Event CryptoEvent
+	Level int // delegation level the event runs at; 0 if cost does not depend on it
+	helpers.DurationDistribution
+}
+
+type costKey struct {
+	event CryptoEvent
+	level int
+}
+
+// DefaultCostProfile is the calibrated profile built into the simulator;
+// calibrate the host to simulate for a profile of its own
+func DefaultCostProfile() *CostProfile {
+
+	profile, e := parseCostProfile([]byte(calibratedCostProfile))
+	if e != nil {
+		panic(e)
+	}
+
+	return profile
+}
+
+// LoadCostProfile reads and validates a JSON cost profile
+func LoadCostProfile(path string) (profile *CostProfile, e error) {
+
+	raw, e := ioutil.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+
+	if profile, e = parseCostProfile(raw); e != nil {
+		return nil, fmt.Errorf("cost profile %s: %v", path, e)
+	}
+
+	return
+}
+
+func parseCostProfile(raw []byte) (profile *CostProfile, e error) {
+
+	profile = &CostProfile{}
+	if e = json.Unmarshal(raw, profile); e != nil {
+		return nil, e
+	}
+
+	if e = profile.Validate(); e != nil {
+		return nil, e
+	}
+
+	return
+}
+
+// Save writes the profile as indented JSON
+func (profile *CostProfile) Save(path string) (e error) {
+
+	raw, e := json.MarshalIndent(profile, "", "\t")
+	if e != nil {
+		return
+	}
+
+	return ioutil.WriteFile(path, raw, 0666)
+}
+
+// Validate ...
+func (profile *CostProfile) Validate() (e error) {
+
+	if profile.Version != CostProfileVersion {
+		return fmt.Errorf("version %d is not supported (expected %d)", profile.Version, CostProfileVersion)
+	}
+
+	seen := make(map[costKey]bool)
+
+	for i, cost := range profile.Events {
+		where := fmt.Sprintf("event #%d (%s, level %d)", i, cost.Event, cost.Level)
+
+		if !knownCryptoEvent(cost.Event) {
+			return fmt.Errorf("%s: unknown event", where)
+		}
+		if seen[costKey{cost.Event, cost.Level}] {
+			return fmt.Errorf("%s: duplicate entry", where)
+		}
+		seen[costKey{cost.Event, cost.Level}] = true
+
+		if e = cost.DurationDistribution.Validate(); e != nil {
+			return fmt.Errorf("%s: %v", where, e)
+		}
+	}
+
+	return
+}
+
+func knownCryptoEvent(event CryptoEvent) bool {
+	for _, known := range allCryptoEvents {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (profile *CostProfile) lookup() (costs map[costKey]EventCost) {
+
+	costs = make(map[costKey]EventCost, len(profile.Events))
+	for _, cost := range profile.Events {
+		costs[costKey{cost.Event, cost.Level}] = cost
+	}
+
+	return
+}
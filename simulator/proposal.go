@@ -1,67 +1,99 @@
 package simulator
 
 import (
+	"crypto/ecdsa"
+
 	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-simulator/helpers"
 )
 
 // TransactionProposal ...
 type TransactionProposal struct {
 	hash        []byte
-	authorID    int // for checking auditing correctness
+	authorID    int    // for checking auditing correctness
+	class       string // of the author, disclosed so that peers know whether to expect a non-revocation proof
 	chaincode   string
-	doneChannel chan Endorsement
-	signature   dac.NymSignature
-	author      []byte // marshalled dac.Proof
+	doneChannel *Queue
+	signature   creatorSignature
+	author      []byte // marshalled dac.Proof, or the X.509 certificate
 	pkNym       interface{}
 	indices     dac.Indices
+	creator     *ecdsa.PublicKey // in the certificate of an X.509 author
+	keys        []string         // as many as the chaincode touches
+	payload     []byte           // chaincode argument of a trace record; the hash if nil
+	faults      faultSet         // that have lost or delayed the messages of the transaction
 }
 
-// MakeTransactionProposal ...
-func MakeTransactionProposal(hash []byte, user User) (tp *TransactionProposal, pkNym interface{}, skNym dac.SK) {
+// MakeTransactionProposal returns the nym keys of an Idemix author, to sign the transaction with
+func MakeTransactionProposal(prg *amcl.RAND, hash []byte, user User, chaincode string, keys []string, payload []byte) (tp *TransactionProposal, pkNym interface{}, skNym dac.SK) {
 
-	prg := helpers.NewRand()
+	tp = &TransactionProposal{
+		chaincode:   chaincode,
+		authorID:    user.id,
+		class:       user.class.Name,
+		hash:        hash,
+		keys:        keys,
+		payload:     payload,
+		doneChannel: execParams.scheduler.MakeQueue(),
+		faults:      make(faultSet),
+	}
 
-	skNym, pkNym = dac.GenerateNymKeys(prg, user.sk, sysParams.H)
-	indices := dac.Indices{
-		dac.Index{
-			I:         1,
-			J:         1,
-			Attribute: user.credentials.Attributes[1][1],
-		},
+	if sysParams.X509() {
+		tp.author = user.certificate
+		tp.creator = &user.ecdsaKey.PublicKey
+	} else {
+		skNym, pkNym = generateNymKeys(prg, user.sk)
+		tp.pkNym = pkNym
+		tp.indices = identityIndices(&user.credentials)
+
+		var e error
+		if tp.author, e = proveIdentity(prg, user, tp.indices, skNym); e != nil {
+			panic(e)
+		}
 	}
 
-	proof, e := user.credentials.Prove(
-		prg,
-		user.sk,
-		sysParams.RootPk,
-		indices,
-		[]byte{},
-		sysParams.Ys,
-		sysParams.H,
-		skNym,
-	)
-	recordCryptoEvent(credProve)
-
-	if e != nil {
-		panic(e)
+	tp.signature = signAsCreator(prg, user, pkNym, skNym, tp.getMessage())
+
+	return
+}
+
+// creatorSignature is by the nym of an Idemix author, or by the key in the certificate of an X.509 one
+type creatorSignature struct {
+	nym   dac.NymSignature
+	ecdsa []byte
+}
+
+func signAsCreator(prg *amcl.RAND, user User, pkNym interface{}, skNym dac.SK, message []byte) creatorSignature {
+	if sysParams.X509() {
+		return creatorSignature{ecdsa: signECDSAMessage(prg, user.ecdsaKey, message)}
 	}
-	author := proof.ToBytes()
+	return creatorSignature{nym: signNymMessage(prg, pkNym, skNym, user.sk, message)}
+}
 
-	tp = &TransactionProposal{
-		chaincode:   "chaincode: hash | policy: write",
-		authorID:    user.id,
-		hash:        hash,
-		author:      author,
-		pkNym:       pkNym,
-		indices:     indices,
-		doneChannel: make(chan Endorsement, sysParams.Endorsements),
+func (signature creatorSignature) bytes() []byte {
+	if sysParams.X509() {
+		return signature.ecdsa
 	}
+	return encoded("nym-signature", signature.nym.ToBytes)
+}
 
-	tp.signature = dac.SignNym(prg, pkNym, skNym, user.sk, sysParams.H, tp.getMessage())
-	recordCryptoEvent(signNym)
+// verifySignature checks a signature by the author of the proposal, over the proposal or its transaction
+func (tp *TransactionProposal) verifySignature(signature creatorSignature, message []byte) error {
+	if sysParams.X509() {
+		return verifyECDSAMessage(tp.creator, signature.ecdsa, message)
+	}
+	return verifyNymMessage(signature.nym, tp.pkNym, message)
+}
 
-	return
+// verifyAuthor checks the proof of Idemix credentials, or that the certificate authority of an organization
+// has issued the X.509 certificate; peers trust all of them, the author names its own by the organization
+func (tp *TransactionProposal) verifyAuthor() error {
+	if sysParams.X509() {
+		network := execParams.network
+		return verifyX509Certificate(network.organizations[network.users[tp.authorID].org].authority, tp.author)
+	}
+	return verifyIdentity(tp.author, tp.pkNym, tp.indices)
 }
 
 func (tp *TransactionProposal) getMessage() (message []byte) {
@@ -71,14 +103,53 @@ func (tp *TransactionProposal) getMessage() (message []byte) {
 	message = append(message, tp.hash...)
 	message = append(message, []byte(tp.chaincode)...)
 	message = append(message, byte(tp.authorID))
+	message = append(message, []byte(tp.class)...)
 	message = append(message, tp.author...)
+	for _, key := range tp.keys {
+		message = append(message, []byte(key)...)
+	}
+	message = append(message, tp.payload...)
+
+	return
+}
+
+// revocable tells whether the transaction carries a non-revocation proof, as the class of its author does
+func (tp TransactionProposal) revocable() bool {
+	class, _ := sysParams.Class(tp.class)
+	return class.Revoke
+}
+
+// argument is what the chaincode writes
+func (tp TransactionProposal) argument() []byte {
+	if tp.payload != nil {
+		return tp.payload
+	}
+	return tp.hash
+}
+
+func (tp TransactionProposal) wire() (message helpers.WireProposal) {
+
+	message = helpers.WireProposal{
+		Hash:      tp.hash,
+		Class:     tp.class,
+		Chaincode: tp.chaincode,
+		Signature: tp.signature.bytes(),
+		Author:    tp.author,
+		Keys:      tp.keys,
+		Payload:   tp.payload,
+	}
+
+	// the certificate holds the key of an X.509 author
+	if !sysParams.X509() {
+		message.PkNym = encoded("pk-nym", pointBytes(tp.pkNym))
+		message.IndexValue = encoded("index-value", pointBytes(tp.indices[0].Attribute))
+	}
 
 	return
 }
 
 func (tp TransactionProposal) size() int {
-	// hash + chaincode + signature + proof + pkNym + attribute (value + 2 ints)
-	return len(tp.hash) + len(tp.chaincode) + len(tp.signature.ToBytes()) + len(tp.author) + 4*32 + 4*32 + 2*4
+	return helpers.EncodedSize(tp.wire())
 }
 
 func (tp TransactionProposal) name() string {
@@ -0,0 +1,538 @@
+package simulator
+
+import (
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+type raftState int
+
+const (
+	follower  raftState = 0
+	candidate raftState = 1
+	leader    raftState = 2
+)
+
+func (state raftState) String() string {
+	return [...]string{"follower", "candidate", "leader"}[state]
+}
+
+// raftEntry is a log entry; a nil block is the no-op a new leader appends to commit entries of earlier terms
+type raftEntry struct {
+	term  int
+	block *Block
+}
+
+func (entry raftEntry) wire() (message helpers.WireRaftEntry) {
+	message.Term = entry.term
+	if entry.block != nil {
+		message.Block = entry.block.encoded
+	}
+	return
+}
+
+// raft is the consensus state of an orderer; indices are 1-based as in the Raft paper
+type raft struct {
+	state       raftState
+	currentTerm int
+	votedFor    int
+	leaderID    int // -1 if unknown
+
+	log             []raftEntry
+	commitIndex     int
+	committedBlocks []*Block
+
+	electionElapsed  int
+	electionTimeout  int // randomized in [ElectionTicks, 2*ElectionTicks)
+	heartbeatElapsed int
+
+	votes map[int]bool
+
+	// leader only
+	nextIndex  map[int]int
+	matchIndex map[int]int
+	inflight   map[int]int // ticks since entries were sent to a follower, -1 if none are in flight
+}
+
+func makeRaft() raft {
+	return raft{
+		state:    follower,
+		votedFor: -1,
+		leaderID: -1,
+		log:      make([]raftEntry, 0),
+	}
+}
+
+type raftTick struct{}
+
+type voteRequest struct {
+	term      int
+	candidate int
+	lastIndex int
+	lastTerm  int
+}
+
+type voteResponse struct {
+	term    int
+	from    int
+	granted bool
+}
+
+type appendRequest struct {
+	term         int
+	leader       int
+	prevIndex    int
+	prevTerm     int
+	entries      []raftEntry
+	leaderCommit int
+}
+
+// match is the last index the follower has in common with the leader, or a hint where to retry from
+type appendResponse struct {
+	term    int
+	from    int
+	success bool
+	match   int
+	entries int
+}
+
+func (request voteRequest) size() int {
+	return helpers.EncodedSize(helpers.WireVoteRequest{
+		Term:      request.term,
+		Candidate: request.candidate,
+		LastIndex: request.lastIndex,
+		LastTerm:  request.lastTerm,
+	})
+}
+
+func (request voteRequest) name() string {
+	return "raft-vote-request"
+}
+
+func (response voteResponse) size() int {
+	return helpers.EncodedSize(helpers.WireVoteResponse{
+		Term:    response.term,
+		From:    response.from,
+		Granted: response.granted,
+	})
+}
+
+func (response voteResponse) name() string {
+	return "raft-vote"
+}
+
+func (request appendRequest) size() int {
+	message := helpers.WireAppendRequest{
+		Term:         request.term,
+		Leader:       request.leader,
+		PrevIndex:    request.prevIndex,
+		PrevTerm:     request.prevTerm,
+		LeaderCommit: request.leaderCommit,
+	}
+	for _, entry := range request.entries {
+		message.Entries = append(message.Entries, entry.wire())
+	}
+	return helpers.EncodedSize(message)
+}
+
+func (request appendRequest) name() string {
+	if len(request.entries) == 0 {
+		return "raft-heartbeat"
+	}
+	return "raft-append"
+}
+
+func (response appendResponse) size() int {
+	return helpers.EncodedSize(helpers.WireAppendResponse{
+		Term:    response.term,
+		From:    response.from,
+		Success: response.success,
+		Match:   response.match,
+		Entries: response.entries,
+	})
+}
+
+func (response appendResponse) name() string {
+	return "raft-append-response"
+}
+
+func (orderer *Orderer) quorum() int {
+	return sysParams.Orderers/2 + 1
+}
+
+func (orderer *Orderer) lastIndex() int {
+	return len(orderer.log)
+}
+
+func (orderer *Orderer) termAt(index int) int {
+	if index == 0 {
+		return 0
+	}
+	return orderer.log[index-1].term
+}
+
+func (orderer *Orderer) resetElectionTimeout() {
+	orderer.electionElapsed = 0
+	orderer.electionTimeout = sysParams.ElectionTicks + int(helpers.RandomULong(orderer.prg)%uint64(sysParams.ElectionTicks))
+}
+
+func (orderer *Orderer) tick() {
+	if orderer.state == leader {
+		for follower, ticks := range orderer.inflight {
+			// entries sent to a follower that was down are lost; send them again
+			if ticks >= 0 {
+				orderer.inflight[follower]++
+				if orderer.inflight[follower] >= sysParams.ElectionTicks {
+					orderer.inflight[follower] = -1
+				}
+			}
+		}
+
+		orderer.heartbeatElapsed++
+		if orderer.heartbeatElapsed >= sysParams.HeartbeatTicks {
+			orderer.heartbeatElapsed = 0
+			orderer.broadcastAppend()
+		}
+		return
+	}
+
+	orderer.electionElapsed++
+	if orderer.electionElapsed >= orderer.electionTimeout {
+		orderer.campaign()
+	}
+}
+
+func (orderer *Orderer) becomeFollower(term int, leaderID int) {
+
+	if orderer.state == leader {
+		// the uncut batch is lost; the transactions are still outstanding at the orderers that accepted them
+		orderer.pending = nil
+		orderer.pendingBytes = 0
+		orderer.batch++
+	}
+
+	orderer.state = follower
+	if term > orderer.currentTerm {
+		orderer.currentTerm = term
+		orderer.votedFor = -1
+	}
+	orderer.resetElectionTimeout()
+
+	if leaderID != orderer.leaderID {
+		orderer.leaderID = leaderID
+		if leaderID >= 0 {
+			orderer.forwardOutstanding()
+		}
+	}
+}
+
+func (orderer *Orderer) campaign() {
+
+	orderer.state = candidate
+	orderer.currentTerm++
+	orderer.votedFor = orderer.id
+	orderer.leaderID = -1
+	orderer.votes = map[int]bool{orderer.id: true}
+	orderer.resetElectionTimeout()
+
+	execParams.network.elections++
+	logger.Noticef("%s starts an election for term %d", orderer.name(), orderer.currentTerm)
+
+	if len(orderer.votes) >= orderer.quorum() {
+		orderer.becomeLeader()
+		return
+	}
+
+	for other := 0; other < sysParams.Orderers; other++ {
+		if other != orderer.id {
+			orderer.send(other, voteRequest{
+				term:      orderer.currentTerm,
+				candidate: orderer.id,
+				lastIndex: orderer.lastIndex(),
+				lastTerm:  orderer.termAt(orderer.lastIndex()),
+			})
+		}
+	}
+}
+
+func (orderer *Orderer) becomeLeader() {
+
+	orderer.lead()
+
+	logger.Noticef("%s is the leader of term %d", orderer.name(), orderer.currentTerm)
+
+	orderer.append(raftEntry{term: orderer.currentTerm})
+
+	for _, tx := range orderer.outstanding {
+		if !orderer.seen[tx] {
+			orderer.enqueue(tx)
+		}
+	}
+}
+
+// lead sets up the leader state without sending anything
+func (orderer *Orderer) lead() {
+
+	orderer.state = leader
+	orderer.leaderID = orderer.id
+	orderer.heartbeatElapsed = 0
+
+	orderer.nextIndex = make(map[int]int, sysParams.Orderers)
+	orderer.matchIndex = make(map[int]int, sysParams.Orderers)
+	orderer.inflight = make(map[int]int, sysParams.Orderers)
+	for other := 0; other < sysParams.Orderers; other++ {
+		if other != orderer.id {
+			orderer.nextIndex[other] = orderer.lastIndex() + 1
+			orderer.matchIndex[other] = 0
+			orderer.inflight[other] = -1
+		}
+	}
+
+	// transactions already in the log must not be ordered twice
+	orderer.seen = make(map[*Transaction]bool)
+	orderer.blockHeight = 0
+	orderer.previousHash = nil
+	for _, entry := range orderer.log {
+		if entry.block != nil {
+			orderer.blockHeight++
+			orderer.previousHash = entry.block.header.Hash()
+			for _, tx := range entry.block.transactions {
+				orderer.seen[tx] = true
+			}
+		}
+	}
+}
+
+// a candidate's log is up to date if its last term is later, or the same with at least as many entries
+func (orderer *Orderer) handleVoteRequest(request voteRequest) {
+
+	if request.term > orderer.currentTerm {
+		orderer.becomeFollower(request.term, -1)
+	}
+
+	lastTerm := orderer.termAt(orderer.lastIndex())
+	upToDate := request.lastTerm > lastTerm || (request.lastTerm == lastTerm && request.lastIndex >= orderer.lastIndex())
+
+	granted := request.term == orderer.currentTerm &&
+		(orderer.votedFor == -1 || orderer.votedFor == request.candidate) &&
+		upToDate
+
+	if granted {
+		orderer.votedFor = request.candidate
+		orderer.resetElectionTimeout()
+	}
+
+	orderer.send(request.candidate, voteResponse{
+		term:    orderer.currentTerm,
+		from:    orderer.id,
+		granted: granted,
+	})
+}
+
+func (orderer *Orderer) handleVoteResponse(response voteResponse) {
+
+	if response.term > orderer.currentTerm {
+		orderer.becomeFollower(response.term, -1)
+		return
+	}
+
+	if orderer.state != candidate || response.term != orderer.currentTerm || !response.granted {
+		return
+	}
+
+	orderer.votes[response.from] = true
+	if len(orderer.votes) >= orderer.quorum() {
+		orderer.becomeLeader()
+	}
+}
+
+func (orderer *Orderer) propose(block *Block) {
+	orderer.append(raftEntry{term: orderer.currentTerm, block: block})
+}
+
+func (orderer *Orderer) append(entry raftEntry) {
+	orderer.log = append(orderer.log, entry)
+	orderer.broadcastAppend()
+	orderer.advanceCommit()
+}
+
+func (orderer *Orderer) broadcastAppend() {
+	for other := 0; other < sysParams.Orderers; other++ {
+		if other != orderer.id {
+			orderer.sendAppend(other)
+		}
+	}
+}
+
+// sends the entries a follower is missing, or a heartbeat if some are already in flight;
+// a heartbeat only covers what the follower is known to have, so that it does not fail the consistency check
+func (orderer *Orderer) sendAppend(follower int) {
+
+	prevIndex := orderer.nextIndex[follower] - 1
+	entries := []raftEntry{}
+
+	if orderer.inflight[follower] >= 0 {
+		prevIndex = orderer.matchIndex[follower]
+	} else if prevIndex < orderer.lastIndex() {
+		entries = append(entries, orderer.log[prevIndex:]...)
+		orderer.inflight[follower] = 0
+	}
+
+	orderer.send(follower, appendRequest{
+		term:         orderer.currentTerm,
+		leader:       orderer.id,
+		prevIndex:    prevIndex,
+		prevTerm:     orderer.termAt(prevIndex),
+		entries:      entries,
+		leaderCommit: orderer.commitIndex,
+	})
+}
+
+func (orderer *Orderer) handleAppendRequest(request appendRequest) {
+
+	if request.term < orderer.currentTerm {
+		orderer.send(request.leader, appendResponse{
+			term:  orderer.currentTerm,
+			from:  orderer.id,
+			match: orderer.lastIndex(),
+		})
+		return
+	}
+
+	orderer.becomeFollower(request.term, request.leader)
+
+	if request.prevIndex > orderer.lastIndex() || orderer.termAt(request.prevIndex) != request.prevTerm {
+		hint := request.prevIndex - 1
+		if orderer.lastIndex() < hint {
+			hint = orderer.lastIndex()
+		}
+		orderer.send(request.leader, appendResponse{
+			term:    orderer.currentTerm,
+			from:    orderer.id,
+			match:   hint,
+			entries: len(request.entries),
+		})
+		return
+	}
+
+	for i, entry := range request.entries {
+		index := request.prevIndex + 1 + i
+		if index <= orderer.lastIndex() {
+			if orderer.termAt(index) == entry.term {
+				continue
+			}
+			orderer.log = orderer.log[:index-1]
+		}
+		orderer.log = append(orderer.log, entry)
+	}
+
+	match := request.prevIndex + len(request.entries)
+	if commit := request.leaderCommit; commit > orderer.commitIndex {
+		if commit > match {
+			commit = match
+		}
+		orderer.commitTo(commit)
+	}
+
+	orderer.send(request.leader, appendResponse{
+		term:    orderer.currentTerm,
+		from:    orderer.id,
+		success: true,
+		match:   match,
+		entries: len(request.entries),
+	})
+}
+
+func (orderer *Orderer) handleAppendResponse(response appendResponse) {
+
+	if response.term > orderer.currentTerm {
+		orderer.becomeFollower(response.term, -1)
+		return
+	}
+
+	if orderer.state != leader || response.term != orderer.currentTerm {
+		return
+	}
+
+	follower := response.from
+
+	if response.entries > 0 || !response.success {
+		orderer.inflight[follower] = -1
+	}
+
+	if response.success {
+		if response.match > orderer.matchIndex[follower] {
+			orderer.matchIndex[follower] = response.match
+		}
+		orderer.nextIndex[follower] = orderer.matchIndex[follower] + 1
+		orderer.advanceCommit()
+	} else {
+		orderer.nextIndex[follower] = response.match + 1
+	}
+
+	if orderer.nextIndex[follower] <= orderer.lastIndex() && orderer.inflight[follower] < 0 {
+		orderer.sendAppend(follower)
+	}
+}
+
+// a leader only counts replicas for entries of its own term, earlier ones are committed along with them
+func (orderer *Orderer) advanceCommit() {
+	for index := orderer.lastIndex(); index > orderer.commitIndex; index-- {
+		if orderer.termAt(index) != orderer.currentTerm {
+			return
+		}
+
+		replicas := 1
+		for _, match := range orderer.matchIndex {
+			if match >= index {
+				replicas++
+			}
+		}
+
+		if replicas >= orderer.quorum() {
+			orderer.commitTo(index)
+			// let the followers know right away instead of on the next heartbeat
+			orderer.broadcastAppend()
+			return
+		}
+	}
+}
+
+func (orderer *Orderer) commitTo(index int) {
+
+	committed := make(map[*Transaction]bool)
+
+	for ; orderer.commitIndex < index; orderer.commitIndex++ {
+		block := orderer.log[orderer.commitIndex].block
+		if block == nil {
+			continue
+		}
+
+		orderer.committedBlocks = append(orderer.committedBlocks, block)
+		if len(orderer.committedBlocks) > execParams.network.blocks {
+			execParams.network.blocks = len(orderer.committedBlocks)
+		}
+
+		for _, tx := range block.transactions {
+			committed[tx] = true
+			if tx.ordered.IsZero() {
+				tx.ordered = execParams.scheduler.Now()
+			}
+		}
+
+		logger.Debugf("%s has committed block %d", orderer.name(), block.header.Number)
+	}
+
+	if len(committed) == 0 {
+		return
+	}
+
+	outstanding := make([]*Transaction, 0, len(orderer.outstanding))
+	for _, tx := range orderer.outstanding {
+		if !committed[tx] {
+			outstanding = append(outstanding, tx)
+		}
+	}
+	orderer.outstanding = outstanding
+
+	execParams.network.notifyDelivery()
+}
@@ -0,0 +1,210 @@
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Results summarizes a finished simulation; durations are in virtual time
+type Results struct {
+	Transactions int
+	Failed       int // given up by the users, because of the faults or out of endorsement attempts
+	Valid        int
+	Conflicts    int                              // MVCC read conflicts
+	Mismatches   int                              // endorsers simulated different outcomes
+	Invalid      map[validationCode]int           // by reason, as seen by peer-0 or by the clients
+	Wasted       map[validationCode]time.Duration // validation time spent on invalid transactions, over all peers
+	Rejected     int                              // by clients before ordering
+	Retries      int                              // endorsement requests sent again after a timeout
+	RetryLatency time.Duration                    // mean over the retried transactions, from the first timeout to the last endorsement
+	Duration     time.Duration
+	Throughput   float64 // transactions per second
+	Latency      LatencyStats
+	Endorsements LatencyStats
+	Ordering     LatencyStats
+	Validations  LatencyStats
+	Blocks       int
+	Elections    int // Raft elections started after the initial leader
+	LedgerBytes  int // of a peer
+	CryptoEvents map[CryptoEvent]int
+	Messages     int
+	Bytes        int
+
+	Organizations []GroupResults
+	Classes       []GroupResults // of users, the default class last; none if the workload has no classes
+}
+
+// GroupResults summarizes the transactions of the users of an organization or a class, to compare how they fare
+type GroupResults struct {
+	Name         string
+	Users        int
+	Transactions int
+	Failed       int
+	Valid        int
+	Throughput   float64 // transactions per second
+	Latency      LatencyStats
+}
+
+// defaultClass names the users without a class among the classes
+const defaultClass = "(default)"
+
+// LatencyStats ...
+type LatencyStats struct {
+	Min  time.Duration
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+func collectResults() (results *Results) {
+
+	results = &Results{
+		Transactions: len(execParams.transactionTimings),
+		Failed:       execParams.faults.failed,
+		Invalid:      execParams.invalid,
+		Wasted:       execParams.wasted,
+		Rejected:     execParams.rejected,
+		Duration:     execParams.completed,
+		CryptoEvents: make(map[CryptoEvent]int, len(allCryptoEvents)),
+		Blocks:       execParams.network.blocks,
+		Elections:    execParams.network.elections,
+		LedgerBytes:  execParams.network.peers[0].ledger.Bytes(),
+		Messages:     execParams.messages,
+		Bytes:        execParams.bytes,
+	}
+
+	if results.Duration > 0 {
+		results.Throughput = float64(results.Transactions) / results.Duration.Seconds()
+	}
+
+	retried := 0
+	for _, info := range execParams.transactionTimings {
+		if info.retries > 0 {
+			retried++
+			results.Retries += info.retries
+			results.RetryLatency += info.retryLatency
+		}
+		switch info.code {
+		case valid:
+			results.Valid++
+		case mvccReadConflict:
+			results.Conflicts++
+		case endorsementMismatch:
+			results.Mismatches++
+		}
+	}
+
+	if retried > 0 {
+		results.RetryLatency /= time.Duration(retried)
+	}
+
+	for _, event := range allCryptoEvents {
+		results.CryptoEvents[event] = execParams.cryptoEvents[event]
+	}
+
+	timings := execParams.transactionTimings
+	results.Latency = latencyStats(timings, totalLatency)
+	results.Endorsements = latencyStats(timings, func(info TransactionTimingInfo) time.Duration {
+		return info.endorsementsEnd.Sub(info.endorsementsStart)
+	})
+	results.Ordering = latencyStats(timings, func(info TransactionTimingInfo) time.Duration {
+		return info.orderingEnd.Sub(info.orderingStart)
+	})
+	results.Validations = latencyStats(timings, func(info TransactionTimingInfo) time.Duration {
+		return info.validationEnd.Sub(info.validationStart)
+	})
+
+	organizations := make([]string, sysParams.Orgs)
+	for org := range organizations {
+		organizations[org] = fmt.Sprintf("org-%d", org)
+	}
+	results.Organizations = groupResults(organizations, sysParams.UserOrganization)
+
+	if len(sysParams.Classes) > 0 {
+		classes := make([]string, 0, len(sysParams.Classes)+1)
+		indices := make(map[string]int)
+		for i, class := range sysParams.Classes {
+			classes = append(classes, class.Name)
+			indices[class.Name] = i
+		}
+		classes = append(classes, defaultClass)
+		indices[""] = len(sysParams.Classes)
+
+		results.Classes = groupResults(classes, func(user int) int {
+			return indices[sysParams.UserClass(user).Name]
+		})
+		if last := results.Classes[len(results.Classes)-1]; last.Users == 0 {
+			results.Classes = results.Classes[:len(results.Classes)-1]
+		}
+	}
+
+	return
+}
+
+func totalLatency(info TransactionTimingInfo) time.Duration {
+	return info.end.Sub(info.start)
+}
+
+// groupResults splits the transactions by the groups of their users
+func groupResults(names []string, groupOf func(user int) int) (groups []GroupResults) {
+
+	groups = make([]GroupResults, len(names))
+	timings := make([][]TransactionTimingInfo, len(names))
+
+	for i, name := range names {
+		groups[i].Name = name
+	}
+	for user := 0; user < sysParams.TotalUsers(); user++ {
+		groups[groupOf(user)].Users++
+		groups[groupOf(user)].Failed += execParams.faults.failedBy[user]
+	}
+	for _, info := range execParams.transactionTimings {
+		group := groupOf(info.user)
+		timings[group] = append(timings[group], info)
+		groups[group].Transactions++
+		if info.code == valid {
+			groups[group].Valid++
+		}
+	}
+
+	for i := range groups {
+		if execParams.completed > 0 {
+			groups[i].Throughput = float64(groups[i].Transactions) / execParams.completed.Seconds()
+		}
+		groups[i].Latency = latencyStats(timings[i], totalLatency)
+	}
+
+	return
+}
+
+func latencyStats(timings []TransactionTimingInfo, elapsed func(TransactionTimingInfo) time.Duration) (stats LatencyStats) {
+
+	if len(timings) == 0 {
+		return
+	}
+
+	durations := make([]time.Duration, 0, len(timings))
+	var total time.Duration
+	for _, info := range timings {
+		durations = append(durations, elapsed(info))
+		total += elapsed(info)
+	}
+
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+
+	return LatencyStats{
+		Min:  durations[0],
+		Mean: total / time.Duration(len(durations)),
+		P50:  percentile(durations, 50),
+		P90:  percentile(durations, 90),
+		P95:  percentile(durations, 95),
+		P99:  percentile(durations, 99),
+		Max:  durations[len(durations)-1],
+	}
+}
@@ -1,98 +1,105 @@
 package simulator
 
 import (
-	"context"
 	"fmt"
 	"time"
 
 	"github.com/dbogatov/dac-lib/dac"
-	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
+	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-simulator/helpers"
-	"golang.org/x/sync/semaphore"
 )
 
 // RevocationAuthority ...
 type RevocationAuthority struct {
 	KeysHolder
 
-	semaphore *semaphore.Weighted
-	ctx       context.Context
+	prg       *amcl.RAND
+	semaphore *Semaphore
 
-	requestChannel chan *NonRevocationRequest
-	exitChannel    chan bool
+	requestChannel *Queue
+	stopped        bool
 }
 
 // MakeRevocationAuthority ...
-func MakeRevocationAuthority() (revocation *RevocationAuthority) {
+func MakeRevocationAuthority(prg *amcl.RAND) (revocation *RevocationAuthority) {
 
-	groth := dac.MakeGroth(helpers.NewRand(), true, sysParams.Ys[1])
+	groth := dac.MakeGroth(prg, true, sysParams.Ys[1])
 	sk, pk := groth.Generate()
+	scheduler := execParams.scheduler
 
 	revocation = &RevocationAuthority{
-		semaphore:      semaphore.NewWeighted(int64(sysParams.ConcurrentRevocations)),
-		ctx:            context.TODO(),
-		requestChannel: make(chan *NonRevocationRequest),
-		exitChannel:    make(chan bool),
+		prg:            prg,
+		semaphore:      scheduler.MakeSemaphore(sysParams.ConcurrentRevocations),
+		requestChannel: scheduler.MakeQueue(),
 		KeysHolder: KeysHolder{
 			pk: pk,
 			sk: sk,
 		},
 	}
 
-	go revocation.run()
+	scheduler.Go(revocation.run)
+	scheduler.Go(revocation.runEpochs)
 
 	return
 }
 
 func (revocation *RevocationAuthority) run() {
-	for {
-		select {
-		case nrr := <-revocation.requestChannel:
-			recordBandwidth(fmt.Sprintf("user-%d", nrr.userID), "revocation-authority", nrr)
-			if e := revocation.semaphore.Acquire(revocation.ctx, 1); e != nil {
-				panic(e)
-			}
-
-			go revocation.grant(nrr)
+	for message := revocation.requestChannel.Get(); message != nil; message = revocation.requestChannel.Get() {
+		nrr := message.(*NonRevocationRequest)
+		if !transmit(fmt.Sprintf("user-%d", nrr.userID), "revocation-authority", nrr, nrr.faults) {
 			continue
-		case <-time.After(time.Duration(sysParams.Epoch) * time.Second):
+		}
+		revocation.semaphore.Acquire()
 
-			if sysParams.Revoke && execParams.network != nil {
-				execParams.network.epoch++
-			}
+		execParams.scheduler.Go(func() { revocation.grant(nrr) })
+	}
+}
 
-			continue
-		case <-revocation.exitChannel:
+func (revocation *RevocationAuthority) runEpochs() {
+	for {
+		execParams.scheduler.Sleep(time.Duration(sysParams.Epoch) * time.Second)
+
+		if revocation.stopped {
+			break
+		}
+
+		if sysParams.Revocations() && execParams.network != nil {
+			execParams.network.epoch++
 		}
-		break
 	}
 }
 
+func (revocation *RevocationAuthority) stop() {
+	revocation.stopped = true
+	revocation.requestChannel.Put(nil)
+}
+
 func (revocation *RevocationAuthority) grant(nrr *NonRevocationRequest) {
 
-	defer revocation.semaphore.Release(1)
+	defer revocation.semaphore.Release()
 
 	nrh := &NonRevocationHandle{
-		handle: dac.SignNonRevoke(helpers.NewRand(), revocation.sk, nrr.userPk, FP256BN.NewBIGint(execParams.network.epoch), sysParams.Ys[1]),
+		handle: grantNonRevocation(revocation.prg, revocation.sk, nrr.userPk, execParams.network.epoch),
+	}
+	if !transmit("revocation-authority", fmt.Sprintf("user-%d", nrr.userID), nrh, nrr.faults) {
+		return
 	}
-
-	recordCryptoEvent(nonRevokeGrant)
-	recordBandwidth("revocation-authority", fmt.Sprintf("user-%d", nrr.userID), nrh)
 
 	logger.Debugf("Non-revocation granted to user-%d", nrr.userID)
 
-	nrr.doneChannel <- nrh
+	nrr.doneChannel.Put(nrh)
 }
 
 // NonRevocationRequest ...
 type NonRevocationRequest struct {
 	userPk      dac.PK
 	userID      int
-	doneChannel chan *NonRevocationHandle
+	doneChannel *Queue
+	faults      faultSet // of the transaction that needs the handle
 }
 
 func (nrr NonRevocationRequest) size() int {
-	return 1 + 2*32 + CertificateSize
+	return helpers.EncodedSize(helpers.WireNonRevocationRequest{PK: encoded("revocation-pk", pointBytes(nrr.userPk))})
 }
 
 func (nrr NonRevocationRequest) name() string {
@@ -105,7 +112,7 @@ type NonRevocationHandle struct {
 }
 
 func (nrh NonRevocationHandle) size() int {
-	return 3*(1+2*32) + 4*32
+	return helpers.EncodedSize(helpers.WireNonRevocationHandle{Handle: encoded("non-revocation-handle", nrh.handle.ToBytes)})
 }
 
 func (nrh NonRevocationHandle) name() string {
@@ -0,0 +1,301 @@
+package simulator
+
+import (
+	"container/heap"
+	"runtime"
+	"time"
+)
+
+// VirtualEpoch is the wall-clock instant that corresponds to virtual time zero
+var VirtualEpoch = time.Unix(0, 0).UTC()
+
+// Scheduler is a discrete-event scheduler that runs cooperative processes on a virtual clock.
+// Exactly one process runs at a time; a process gives up control only when it sleeps or blocks
+// on one of the primitives below, so the order of events depends only on virtual time.
+type Scheduler struct {
+	now     time.Duration
+	queue   eventQueue
+	seq     uint64
+	current *process
+
+	yield   chan bool
+	done    chan bool
+	stopped bool
+}
+
+type process struct {
+	resume chan bool
+	speed  float64 // of the CPU the process runs on, relative to the host
+}
+
+type event struct {
+	at        time.Duration
+	seq       uint64
+	process   *process
+	cancelled bool // the process is woken at another time instead
+}
+
+// MakeScheduler ...
+func MakeScheduler() (scheduler *Scheduler) {
+	scheduler = &Scheduler{
+		queue: make(eventQueue, 0),
+		yield: make(chan bool),
+		done:  make(chan bool),
+	}
+
+	return
+}
+
+// Now ...
+func (scheduler *Scheduler) Now() time.Time {
+	return VirtualEpoch.Add(scheduler.now)
+}
+
+// Elapsed ...
+func (scheduler *Scheduler) Elapsed() time.Duration {
+	return scheduler.now
+}
+
+// Go spawns a new process that starts at the current virtual time, on the CPU of the process that spawns it
+func (scheduler *Scheduler) Go(routine func()) {
+	scheduler.GoOn(scheduler.Speed(), routine)
+}
+
+// GoOn spawns a new process on a CPU of a speed relative to the host
+func (scheduler *Scheduler) GoOn(speed float64, routine func()) {
+	p := &process{
+		resume: make(chan bool),
+		speed:  speed,
+	}
+
+	go func() {
+		scheduler.park(p)
+		routine()
+		scheduler.yield <- true
+	}()
+
+	scheduler.wake(p, 0)
+}
+
+// Speed is that of the CPU the current process runs on, relative to the host
+func (scheduler *Scheduler) Speed() float64 {
+	if scheduler.current == nil {
+		return 1
+	}
+	return scheduler.current.speed
+}
+
+// Sleep suspends the current process for the given amount of virtual time
+func (scheduler *Scheduler) Sleep(duration time.Duration) {
+	if duration < 0 {
+		duration = 0
+	}
+
+	p := scheduler.current
+	scheduler.wake(p, duration)
+	scheduler.block(p)
+}
+
+// Run executes events until none are left or Stop is called
+func (scheduler *Scheduler) Run() {
+	for !scheduler.stopped && scheduler.queue.Len() > 0 {
+		next := heap.Pop(&scheduler.queue).(*event)
+		if next.cancelled {
+			continue
+		}
+
+		scheduler.now = next.at
+		scheduler.current = next.process
+
+		next.process.resume <- true
+		<-scheduler.yield
+	}
+
+	// release processes that are still blocked, e.g. actors waiting for messages
+	scheduler.stopped = true
+	close(scheduler.done)
+}
+
+// Stop makes Run return once the current process yields
+func (scheduler *Scheduler) Stop() {
+	scheduler.stopped = true
+}
+
+func (scheduler *Scheduler) wake(p *process, after time.Duration) (e *event) {
+	scheduler.seq++
+	e = &event{
+		at:      scheduler.now + after,
+		seq:     scheduler.seq,
+		process: p,
+	}
+	heap.Push(&scheduler.queue, e)
+	return
+}
+
+func (scheduler *Scheduler) block(p *process) {
+	select {
+	case scheduler.yield <- true:
+	case <-scheduler.done:
+		runtime.Goexit()
+	}
+	scheduler.park(p)
+}
+
+func (scheduler *Scheduler) park(p *process) {
+	select {
+	case <-p.resume:
+	case <-scheduler.done:
+		runtime.Goexit()
+	}
+}
+
+/// Synchronization primitives
+
+// Queue is an unbounded FIFO mailbox between processes
+type Queue struct {
+	scheduler *Scheduler
+	items     []interface{}
+	waiters   []*process
+}
+
+// MakeQueue ...
+func (scheduler *Scheduler) MakeQueue() *Queue {
+	return &Queue{
+		scheduler: scheduler,
+	}
+}
+
+// Put never blocks
+func (queue *Queue) Put(item interface{}) {
+	queue.items = append(queue.items, item)
+
+	if len(queue.waiters) > 0 {
+		waiter := queue.waiters[0]
+		queue.waiters = queue.waiters[1:]
+		queue.scheduler.wake(waiter, 0)
+	}
+}
+
+// Get blocks the current process until an item is available
+func (queue *Queue) Get() (item interface{}) {
+	for len(queue.items) == 0 {
+		p := queue.scheduler.current
+		queue.waiters = append(queue.waiters, p)
+		queue.scheduler.block(p)
+	}
+
+	item = queue.items[0]
+	queue.items[0] = nil
+	queue.items = queue.items[1:]
+
+	return
+}
+
+// Semaphore ...
+type Semaphore struct {
+	scheduler *Scheduler
+	capacity  int
+	used      int
+	waiters   []*process
+}
+
+// MakeSemaphore ...
+func (scheduler *Scheduler) MakeSemaphore(capacity int) *Semaphore {
+	return &Semaphore{
+		scheduler: scheduler,
+		capacity:  capacity,
+	}
+}
+
+// Acquire blocks the current process until a slot is available
+func (semaphore *Semaphore) Acquire() {
+	for semaphore.used >= semaphore.capacity {
+		p := semaphore.scheduler.current
+		semaphore.waiters = append(semaphore.waiters, p)
+		semaphore.scheduler.block(p)
+	}
+	semaphore.used++
+}
+
+// Release ...
+func (semaphore *Semaphore) Release() {
+	semaphore.used--
+
+	if len(semaphore.waiters) > 0 {
+		waiter := semaphore.waiters[0]
+		semaphore.waiters = semaphore.waiters[1:]
+		semaphore.scheduler.wake(waiter, 0)
+	}
+}
+
+// WaitGroup ...
+type WaitGroup struct {
+	scheduler *Scheduler
+	counter   int
+	waiters   []*process
+}
+
+// MakeWaitGroup ...
+func (scheduler *Scheduler) MakeWaitGroup() *WaitGroup {
+	return &WaitGroup{
+		scheduler: scheduler,
+	}
+}
+
+// Add ...
+func (wg *WaitGroup) Add(delta int) {
+	wg.counter += delta
+
+	if wg.counter < 0 {
+		panic("negative WaitGroup counter")
+	}
+
+	if wg.counter == 0 {
+		for _, waiter := range wg.waiters {
+			wg.scheduler.wake(waiter, 0)
+		}
+		wg.waiters = nil
+	}
+}
+
+// Done ...
+func (wg *WaitGroup) Done() {
+	wg.Add(-1)
+}
+
+// Wait blocks the current process until the counter drops to zero
+func (wg *WaitGroup) Wait() {
+	for wg.counter > 0 {
+		p := wg.scheduler.current
+		wg.waiters = append(wg.waiters, p)
+		wg.scheduler.block(p)
+	}
+}
+
+/// Event queue
+
+type eventQueue []*event
+
+func (queue eventQueue) Len() int { return len(queue) }
+
+func (queue eventQueue) Less(i, j int) bool {
+	if queue[i].at == queue[j].at {
+		return queue[i].seq < queue[j].seq
+	}
+	return queue[i].at < queue[j].at
+}
+
+func (queue eventQueue) Swap(i, j int) { queue[i], queue[j] = queue[j], queue[i] }
+
+func (queue *eventQueue) Push(x interface{}) {
+	*queue = append(*queue, x.(*event))
+}
+
+func (queue *eventQueue) Pop() interface{} {
+	old := *queue
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*queue = old[:n-1]
+	return item
+}
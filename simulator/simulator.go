@@ -3,14 +3,13 @@ package simulator
 import (
 	"fmt"
 	"math"
-	"math/rand"
 	"sort"
-	"sync"
 	"time"
 
 	"github.com/dbogatov/dac-lib/dac"
 	"github.com/dbogatov/fabric-simulator/helpers"
 	"github.com/op/go-logging"
+	"golang.org/x/exp/rand"
 )
 
 var logger *logging.Logger
@@ -21,66 +20,132 @@ func SetLogger(l *logging.Logger) {
 }
 
 var sysParams helpers.SystemParameters
-var execParams ExecutionParameters = ExecutionParameters{
-	cryptoEvents:       make(map[CryptoEvent]int, 0),
-	transactionTimings: make([]TransactionTimingInfo, 0),
-}
+var execParams ExecutionParameters
 
-// Simulate ...
-func Simulate(rootSk dac.SK, params *helpers.SystemParameters) (e error) {
+// Simulate runs one simulation; it may be called repeatedly, every call starts from a clean state
+func Simulate(rootSk dac.SK, params *helpers.SystemParameters) (results *Results, e error) {
 
 	sysParams = *params
+	execParams = ExecutionParameters{
+		flows:              makeFlowNetwork(),
+		encodings:          make(map[string][]byte),
+		sizes:              make(messageSizes),
+		cryptoEvents:       make(map[CryptoEvent]int, 0),
+		transactionTimings: make([]TransactionTimingInfo, 0),
+		invalid:            make(map[validationCode]int),
+		wasted:             make(map[validationCode]time.Duration),
+	}
+	networkEventID = 1
+
+	profile := DefaultCostProfile()
+	if sysParams.CostProfile != "" {
+		if profile, e = LoadCostProfile(sysParams.CostProfile); e != nil {
+			return
+		}
+	}
+	logger.Noticef("Using cost profile of %s (created %s)", profile.Host, profile.Created)
+	execParams.costs = profile.lookup()
+	if _, measured := execParams.costs[costKey{verifyECDSA, 0}]; sysParams.X509() && !measured {
+		logger.Warning("The cost profile has no ECDSA events, X.509 signatures cost nothing; calibrate again")
+	}
+	execParams.costSource = rand.NewSource(helpers.RandomULong(helpers.NewRandDerived(sysParams.Seed, "costs")))
+
+	if execParams.keySpace, e = helpers.MakeKeySpace(sysParams.KeyAccess, sysParams.Keys, sysParams.Zipf, sysParams.HotKeys, sysParams.HotShare); e != nil {
+		return
+	}
+	if execParams.chaincodes, e = helpers.MakeChaincodeMix(&sysParams); e != nil {
+		return
+	}
+	execParams.chaincodeSource = rand.NewSource(helpers.RandomULong(helpers.NewRandDerived(sysParams.Seed, "chaincodes")))
+	if e = sysParams.LoadArrivals(); e != nil {
+		return
+	}
+	execParams.faults = makeFaults()
 
 	start := time.Now()
 
-	execParams.network = MakeNetwork(helpers.NewRand(), rootSk)
+	execParams.scheduler = MakeScheduler()
+	execParams.scheduler.Go(func() { e = run(rootSk) })
+	execParams.scheduler.Run()
+
+	logger.Noticef(
+		"Simulation completed in %d seconds (%d seconds of virtual time)",
+		int(math.Round(time.Since(start).Seconds())),
+		int(math.Round(execParams.completed.Seconds())),
+	)
+
+	if len(execParams.transactionTimings) > 0 {
+		printStats()
+	}
+
+	return collectResults(), e
+}
+
+func run(rootSk dac.SK) (e error) {
+
+	scheduler := execParams.scheduler
+
+	execParams.network = MakeNetwork(helpers.NewRandDerived(sysParams.Seed, "network"), rootSk)
 
-	var wgUser sync.WaitGroup
-	wgUser.Add(sysParams.Orgs * sysParams.Users)
+	wgUser := scheduler.MakeWaitGroup()
+	wgUser.Add(len(execParams.network.users))
 
-	for user := 0; user < sysParams.Orgs*sysParams.Users; user++ {
+	start := scheduler.Elapsed() // of the workload
+	for user := 0; user < len(execParams.network.users); user++ {
 
-		if sysParams.Revoke {
-			execParams.network.users[user].requestNonRevocation()
+		if execParams.network.users[user].class.Revoke && !execParams.network.users[user].requestNonRevocation(make(faultSet)) {
+			execParams.network.users[user].epoch = -1 // ask again with the first transaction
 		}
 
-		go func(user int) {
+		user := user
+		scheduler.Go(func() {
 			defer wgUser.Done()
 
+			userObj := &execParams.network.users[user]
+			arrivals := sysParams.UserArrivals(user)
+
+			if arrivals.Open() {
+				userObj.runArrivals(start)
+				return
+			}
+
 			// first sleep uniform
-			if sysParams.Frequency > 0 {
-				time.Sleep(time.Duration(rand.Intn(sysParams.Frequency*1000)) * time.Millisecond)
+			if arrivals.Frequency > 0 {
+				scheduler.Sleep(time.Duration(helpers.RandomULong(userObj.prg)%uint64(arrivals.Frequency*1000)) * time.Millisecond)
 			}
 
-			for i := 0; i < sysParams.Transactions; i++ {
-				userObj := execParams.network.users[user]
+			for i := 0; i < userObj.class.Transactions; i++ {
 
 				// subsequent sleeps Poisson
-				if sysParams.Frequency > 0 {
+				if arrivals.Frequency > 0 {
 					sleep := time.Duration((3600.0/userObj.poisson.Rand())*1000) * time.Millisecond
 					logger.Debugf("user-%d will wait %d ms", user, sleep.Milliseconds())
-					time.Sleep(sleep)
+					scheduler.Sleep(sleep)
 				}
 
-				message := helpers.RandomString(helpers.NewRand(), 16)
-				userObj.submitTransaction(message)
+				message := helpers.RandomString(userObj.prg, 16)
+				userObj.submitTransaction(message, helpers.Arrival{})
 			}
 
-		}(user)
+		})
 	}
 
 	wgUser.Wait()
 
+	// every transaction is committed by every peer once its user is done, unless faults held peers back
+	execParams.network.settle()
+	e = execParams.network.checkLedgers()
+
 	// Auditing
-	if sysParams.Audit {
+	if sysParams.Audit && e == nil {
 
-		logger.Noticef("Audit started over %d transactions", len(execParams.network.transactions))
+		logger.Noticef("Audit started over %d blocks", len(execParams.network.peers[0].blocks))
 
-		for _, transaction := range execParams.network.transactions {
-			authorPk := transaction.auditEnc.AuditingDecrypt(execParams.network.auditor.sk)
-			recordCryptoEvent(auditDecrypt)
-			if !dac.PkEqual(authorPk, execParams.network.users[transaction.proposal.authorID].CredentialsHolder.pk) {
-				panic("auditing failed")
+		for _, block := range execParams.network.peers[0].blocks {
+			for _, transaction := range block.transactions {
+				if !auditingDecrypt(transaction.auditEnc, execParams.network.auditor.sk, execParams.network.users[transaction.proposal.authorID].CredentialsHolder.pk) {
+					panic("auditing failed")
+				}
 			}
 		}
 
@@ -88,13 +153,9 @@ func Simulate(rootSk dac.SK, params *helpers.SystemParameters) (e error) {
 
 	}
 
-	execParams.network.stop()
-
-	logger.Noticef("Simulation completed in %d seconds", int(math.Round(time.Since(start).Seconds())))
+	execParams.completed = scheduler.Elapsed()
 
-	if len(execParams.transactionTimings) > 0 {
-		printStats()
-	}
+	execParams.network.stop()
 
 	return
 }
@@ -103,12 +164,33 @@ func printStats() {
 
 	// crypto events
 	logger.Critical("Crypto events:")
-	for event, times := range execParams.cryptoEvents {
-		logger.Criticalf("\t%-20s : %3d : (%4.1f per transaction)\n", event, times, float64(times)/float64(len(execParams.network.transactions)))
+	events := make([]CryptoEvent, 0, len(execParams.cryptoEvents))
+	for event := range execParams.cryptoEvents {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i] < events[j]
+	})
+	for _, event := range events {
+		times := execParams.cryptoEvents[event]
+		logger.Criticalf("\t%-20s : %3d : (%4.1f per transaction)\n", event, times, float64(times)/float64(len(execParams.transactionTimings)))
 	}
 
 	// transaction timings
-	logger.Criticalf("For %d transactions", len(execParams.transactionTimings))
+	logger.Criticalf("For %d transactions in %d blocks (%d Raft elections)", len(execParams.transactionTimings), execParams.network.blocks, execParams.network.elections)
+	results := collectResults()
+	logger.Criticalf(
+		"%d valid, %d MVCC read conflicts, %d endorsement mismatches, %d otherwise invalid (%.1f%% invalid)",
+		results.Valid, results.Conflicts, results.Mismatches, results.Transactions-results.Valid-results.Conflicts-results.Mismatches,
+		100*float64(results.Transactions-results.Valid)/float64(results.Transactions),
+	)
+	ledger := execParams.network.peers[0].ledger
+	logger.Criticalf("Ledger of %d bytes (%d per transaction)", ledger.Bytes(), ledger.Bytes()/len(execParams.transactionTimings))
+	logger.Criticalf("Orderers sent %d bytes of blocks, peers gossiped %d bytes", execParams.network.deliveredBytes, execParams.network.gossipBytes)
+	printFaults()
+	printRetries()
+	printHardware()
+	printInvalid()
 	printTimingBasics := func(
 		start func(TransactionTimingInfo) time.Time,
 		end func(TransactionTimingInfo) time.Time,
@@ -150,18 +232,55 @@ func printStats() {
 		func(info TransactionTimingInfo) time.Time { return info.endorsementsEnd },
 		"endorsements",
 	)
+	printTimingBasics(
+		func(info TransactionTimingInfo) time.Time { return info.orderingStart },
+		func(info TransactionTimingInfo) time.Time { return info.orderingEnd },
+		"ordering",
+	)
 	printTimingBasics(
 		func(info TransactionTimingInfo) time.Time { return info.validationStart },
 		func(info TransactionTimingInfo) time.Time { return info.validationEnd },
 		"validations",
 	)
+
+	printGroups := func(groups []GroupResults, description string) {
+		if len(groups) < 2 {
+			return
+		}
+		logger.Criticalf("By %s:", description)
+		for _, group := range groups {
+			logger.Criticalf(
+				"\t%-15s : %4d users : %5d transactions (%d valid, %d given up) : %6.2f tps : total avg %4d ms, p95 %4d ms",
+				group.Name, group.Users, group.Transactions, group.Valid, group.Failed, group.Throughput, group.Latency.Mean.Milliseconds(), group.Latency.P95.Milliseconds(),
+			)
+		}
+	}
+	printGroups(results.Organizations, "organization")
+	printGroups(results.Classes, "class")
 }
 
 // ExecutionParameters ...
 type ExecutionParameters struct {
+	scheduler          *Scheduler
+	completed          time.Duration
+	costs              map[costKey]EventCost
+	costSource         rand.Source
+	keySpace           *helpers.KeySpace
+	chaincodes         *helpers.ChaincodeMix
+	chaincodeSource    rand.Source // execution times, kept apart from crypto costs
+	templates          *cryptoTemplates
+	encodings          map[string][]byte // of crypto objects by kind, in cost-model mode
+	flows              *flowNetwork
+	messages           int
+	bytes              int
+	sizes              messageSizes
 	network            *Network
+	faults             *Faults
 	cryptoEvents       map[CryptoEvent]int
 	transactionTimings []TransactionTimingInfo
+	invalid            map[validationCode]int           // transactions by reason
+	wasted             map[validationCode]time.Duration // validation time spent on them
+	rejected           int                              // by clients before ordering
 }
 
 // KeysHolder ...
@@ -185,4 +304,5 @@ func (credHolder CredentialsHolder) name() string {
 // Organization ...
 type Organization struct {
 	CredentialsHolder
+	authority *helpers.X509Authority // of the users, in X.509 mode
 }
@@ -0,0 +1,63 @@
+package simulator
+
+import (
+	"sort"
+
+	"github.com/dbogatov/dac-lib/dac"
+	"github.com/dbogatov/fabric-simulator/helpers"
+)
+
+// messageSizes are the encoded sizes of the messages sent, by name
+type messageSizes map[string]*messageSize
+
+type messageSize struct {
+	count int
+	total int
+	min   int
+	max   int
+}
+
+func (sizes messageSizes) add(name string, size int) {
+	stats, exists := sizes[name]
+	if !exists {
+		stats = &messageSize{min: size, max: size}
+		sizes[name] = stats
+	}
+	stats.count++
+	stats.total += size
+	if size < stats.min {
+		stats.min = size
+	}
+	if size > stats.max {
+		stats.max = size
+	}
+}
+
+// InspectSizes simulates the scenario with the cost model, whose crypto objects are encoded as real ones are,
+// and prints the encoded size of every kind of message sent
+func InspectSizes(rootSk dac.SK, params *helpers.SystemParameters) (e error) {
+
+	inspected := *params
+	inspected.CostModel = true
+
+	if _, e = Simulate(rootSk, &inspected); e != nil {
+		return
+	}
+
+	names := make([]string, 0, len(execParams.sizes))
+	for name := range execParams.sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	logger.Critical("Encoded message sizes:")
+	for _, name := range names {
+		stats := execParams.sizes[name]
+		logger.Criticalf(
+			"\t%-25s : %6d sent : min %7d B, max %7d B, avg %7d B\n",
+			name, stats.count, stats.min, stats.max, stats.total/stats.count,
+		)
+	}
+
+	return
+}
@@ -0,0 +1,333 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbogatov/fabric-simulator/helpers"
+	"gopkg.in/yaml.v2"
+)
+
+// SweepParameter is one axis of the grid: a dotted scenario path and the values it takes
+type SweepParameter struct {
+	Path   string
+	Values []string
+}
+
+// ParseSweepParameters parses "path=v1,v2,..." specifications
+func ParseSweepParameters(specs []string) (grid []SweepParameter, e error) {
+
+	for _, spec := range specs {
+		equals := strings.Index(spec, "=")
+		if equals < 0 {
+			return nil, fmt.Errorf("grid parameter \"%s\" must look like path=value,value,...", spec)
+		}
+
+		parameter := SweepParameter{
+			Path: strings.TrimSpace(spec[:equals]),
+		}
+		for _, value := range strings.Split(spec[equals+1:], ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				parameter.Values = append(parameter.Values, value)
+			}
+		}
+
+		if parameter.Path == "" || len(parameter.Values) == 0 {
+			return nil, fmt.Errorf("grid parameter \"%s\" needs a path and at least one value", spec)
+		}
+		if parameter.Path == "seed" {
+			return nil, fmt.Errorf("seeds are swept with their own option, not as a grid parameter")
+		}
+
+		grid = append(grid, parameter)
+	}
+
+	return
+}
+
+type sweepPoint struct {
+	values []string // one per grid parameter
+	seed   int
+}
+
+func (point sweepPoint) key(grid []SweepParameter) string {
+	parts := make([]string, 0, len(grid)+1)
+	for i, parameter := range grid {
+		parts = append(parts, fmt.Sprintf("%s=%s", parameter.Path, point.values[i]))
+	}
+	parts = append(parts, fmt.Sprintf("seed=%d", point.seed))
+	return strings.Join(parts, " ")
+}
+
+// Sweep runs the simulator over the cartesian product of the grid and the seeds and appends a row
+// per run to output (.csv or .jsonl); points already present in output are skipped, so an
+// interrupted sweep resumes where it stopped
+func Sweep(base *helpers.Scenario, grid []SweepParameter, seeds []int, output string) (e error) {
+
+	if len(seeds) == 0 {
+		seeds = []int{base.Seed}
+	}
+
+	points := []sweepPoint{{}}
+	for _, parameter := range grid {
+		expanded := make([]sweepPoint, 0, len(points)*len(parameter.Values))
+		for _, point := range points {
+			for _, value := range parameter.Values {
+				expanded = append(expanded, sweepPoint{
+					values: append(append([]string{}, point.values...), value),
+				})
+			}
+		}
+		points = expanded
+	}
+	seeded := make([]sweepPoint, 0, len(points)*len(seeds))
+	for _, point := range points {
+		for _, seed := range seeds {
+			seeded = append(seeded, sweepPoint{point.values, seed})
+		}
+	}
+
+	// validate every point before spending time on any of them
+	scenarios := make([]*helpers.Scenario, len(seeded))
+	for i, point := range seeded {
+		scenario := base
+		for j, parameter := range grid {
+			if scenario, e = scenario.Override(parameter.Path, point.values[j]); e != nil {
+				return
+			}
+		}
+		scenario.Seed = point.seed
+		if e = scenario.Validate(true); e != nil {
+			return fmt.Errorf("point %s: %v", point.key(grid), e)
+		}
+		scenarios[i] = scenario
+	}
+
+	writer, e := openSweepOutput(output, sweepColumns(grid))
+	if e != nil {
+		return
+	}
+	defer writer.close()
+
+	for i, point := range seeded {
+		key := point.key(grid)
+
+		if writer.done[key] {
+			logger.Noticef("Sweep point %d / %d (%s) is already done", i+1, len(seeded), key)
+			continue
+		}
+		logger.Noticef("Sweep point %d / %d (%s)", i+1, len(seeded), key)
+
+		params, rootSk, _ := helpers.MakeSystemParameters(logger, scenarios[i])
+
+		results, e := Simulate(rootSk, params)
+		if e != nil {
+			return fmt.Errorf("point %s: %v", key, e)
+		}
+
+		if e = writer.write(sweepRow(key, point, results)); e != nil {
+			return e
+		}
+	}
+
+	logger.Noticef("Sweep of %d points written to %s", len(seeded), output)
+
+	return
+}
+
+func sweepColumns(grid []SweepParameter) (columns []string) {
+
+	columns = []string{"point", "seed"}
+	for _, parameter := range grid {
+		columns = append(columns, parameter.Path)
+	}
+
+	columns = append(columns, "transactions", "failed", "endorsement-retries", "valid", "mvcc-conflicts", "endorsement-mismatches", "blocks", "elections", "ledger-bytes", "duration-s", "throughput-tps")
+	for _, kind := range []string{"latency", "endorsement", "ordering", "validation"} {
+		for _, stat := range []string{"min", "mean", "p50", "p90", "p95", "p99", "max"} {
+			columns = append(columns, fmt.Sprintf("%s-%s-ms", kind, stat))
+		}
+	}
+	columns = append(columns, "messages", "bytes")
+	for _, event := range allCryptoEvents {
+		columns = append(columns, string(event))
+	}
+
+	return
+}
+
+// values in the order of sweepColumns
+func sweepRow(key string, point sweepPoint, results *Results) (row []interface{}) {
+
+	row = []interface{}{key, point.seed}
+	for _, value := range point.values {
+		// typed, so that JSON has numbers and booleans
+		var parsed interface{}
+		if yaml.Unmarshal([]byte(value), &parsed) != nil {
+			parsed = value
+		}
+		row = append(row, parsed)
+	}
+
+	row = append(row, results.Transactions, results.Failed, results.Retries, results.Valid, results.Conflicts, results.Mismatches, results.Blocks, results.Elections, results.LedgerBytes, results.Duration.Seconds(), results.Throughput)
+	for _, stats := range []LatencyStats{results.Latency, results.Endorsements, results.Ordering, results.Validations} {
+		for _, duration := range []time.Duration{stats.Min, stats.Mean, stats.P50, stats.P90, stats.P95, stats.P99, stats.Max} {
+			row = append(row, milliseconds(duration))
+		}
+	}
+	row = append(row, results.Messages, results.Bytes)
+	for _, event := range allCryptoEvents {
+		row = append(row, results.CryptoEvents[event])
+	}
+
+	return
+}
+
+/// Output
+
+type sweepOutput struct {
+	file    *os.File
+	csv     bool
+	columns []string
+	done    map[string]bool // keys of points found in the file
+}
+
+func openSweepOutput(path string, columns []string) (output *sweepOutput, e error) {
+
+	output = &sweepOutput{
+		columns: columns,
+		done:    make(map[string]bool),
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		output.csv = true
+	case ".jsonl":
+	default:
+		return nil, fmt.Errorf("sweep output %s: unknown format, expected .csv or .jsonl", path)
+	}
+
+	fresh := true
+	if existing, e := os.Open(path); e == nil {
+		fresh, e = output.resume(existing)
+		existing.Close()
+		if e != nil {
+			return nil, fmt.Errorf("sweep output %s: %v", path, e)
+		}
+	}
+
+	if output.file, e = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666); e != nil {
+		return nil, e
+	}
+
+	if fresh && output.csv {
+		header := make([]interface{}, len(columns))
+		for i, column := range columns {
+			header[i] = column
+		}
+		if e = output.write(header); e != nil {
+			return nil, e
+		}
+	}
+
+	if len(output.done) > 0 {
+		logger.Noticef("Resuming sweep: %d points found in %s", len(output.done), path)
+	}
+
+	return
+}
+
+// collects keys of finished points; fresh is true if the file has no content yet
+func (output *sweepOutput) resume(existing *os.File) (fresh bool, e error) {
+
+	if output.csv {
+		records, e := csv.NewReader(existing).ReadAll()
+		if e != nil {
+			return false, e
+		}
+		if len(records) == 0 {
+			return true, nil
+		}
+		if strings.Join(records[0], ",") != strings.Join(output.columns, ",") {
+			return false, fmt.Errorf("columns differ from this sweep; use another output file")
+		}
+		for _, record := range records[1:] {
+			output.done[record[0]] = true
+		}
+		return false, nil
+	}
+
+	scanner := bufio.NewScanner(existing)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		row := make(map[string]interface{})
+		if e = json.Unmarshal(scanner.Bytes(), &row); e != nil {
+			return false, fmt.Errorf("line %d: %v", line, e)
+		}
+		if len(row) != len(output.columns) {
+			return false, fmt.Errorf("line %d: columns differ from this sweep; use another output file", line)
+		}
+		key, _ := row["point"].(string)
+		output.done[key] = true
+	}
+
+	return line == 0, scanner.Err()
+}
+
+// the whole row is written with a single call and synced, so an interruption loses at most the current point
+func (output *sweepOutput) write(row []interface{}) (e error) {
+
+	var line strings.Builder
+
+	if output.csv {
+		fields := make([]string, len(row))
+		for i, value := range row {
+			fields[i] = formatSweepValue(value)
+		}
+		writer := csv.NewWriter(&line)
+		writer.Write(fields)
+		writer.Flush()
+	} else {
+		// keep the column order, which a map would not
+		line.WriteString("{")
+		for i, value := range row {
+			if i > 0 {
+				line.WriteString(",")
+			}
+			column, _ := json.Marshal(output.columns[i])
+			encoded, _ := json.Marshal(value)
+			line.Write(column)
+			line.WriteString(":")
+			line.Write(encoded)
+		}
+		line.WriteString("}\n")
+	}
+
+	if _, e = output.file.WriteString(line.String()); e != nil {
+		return
+	}
+
+	return output.file.Sync()
+}
+
+func (output *sweepOutput) close() {
+	output.file.Close()
+}
+
+func formatSweepValue(value interface{}) string {
+	switch value := value.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', 3, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
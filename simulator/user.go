@@ -1,126 +1,310 @@
 package simulator
 
 import (
+	"crypto/ecdsa"
 	"fmt"
 	"time"
 
 	"github.com/dbogatov/dac-lib/dac"
-	"github.com/dbogatov/fabric-amcl/amcl/FP256BN"
+	"github.com/dbogatov/fabric-amcl/amcl"
 	"github.com/dbogatov/fabric-simulator/helpers"
+	"golang.org/x/exp/rand"
 	"gonum.org/v1/gonum/stat/distuv"
 )
 
 // User ...
 type User struct {
 	CredentialsHolder
+	ecdsaKey             *ecdsa.PrivateKey // in X.509 mode, instead of the credentials
+	certificate          []byte            // X.509 of the key
 	nonRevocationHandler *dac.GrothSignature
 	revocationPK         dac.PK
 	epoch                int
 	org                  int
+	class                helpers.ClassParameters
+	chaincodes           *helpers.ChaincodeMix // weighted for the class
 	poisson              distuv.Poisson
+	prg                  *amcl.RAND
+	keys                 *amcl.RAND // separate, so that key contention does not change the rest of the run
 }
 
-func (user *User) submitTransaction(message string) {
+// submitTransaction invokes the chaincode of the arrival with its payload, if they are set
+func (user *User) submitTransaction(message string, arrival helpers.Arrival) {
 
 	logger.Infof("user-%d starts transaction with a message %s", user.id, message)
 
+	scheduler := execParams.scheduler
+
 	timingInfo := TransactionTimingInfo{
-		start: time.Now(),
+		start: scheduler.Now(),
+		user:  user.id,
 	}
 
-	prg := helpers.NewRand()
+	prg := user.prg
 
 	hash := helpers.Sha3([]byte(message))
 	recordCryptoEvent(sha3hash)
-	endorsers := make([]int, sysParams.Endorsements)
+	var chaincode helpers.Chaincode
+	if arrival.Chaincode != "" {
+		chaincode = execParams.chaincodes.Get(arrival.Chaincode)
+	} else {
+		chaincode = user.chaincodes.Choose(user.keys)
+	}
 
+	// the policy decides how many endorsers and which; the hash spreads the load
 	endorser := helpers.PeerByHash(helpers.Sha3([]byte(message)), sysParams.Peers)
 	recordCryptoEvent(sha3hash)
 
-	for peer := 0; peer < sysParams.Endorsements; peer++ {
-		endorsers[peer] = (endorser + peer) % sysParams.Peers
+	endorsers, e := chaincode.Policy().Endorsers(&sysParams, endorser)
+	if e != nil {
+		panic(e)
 	}
 
-	proposal, pkNym, skNym := MakeTransactionProposal(hash, *user)
-	timingInfo.endorsementsStart = time.Now()
-	for _, endorser := range endorsers {
-		execParams.network.peers[endorser].endorsementChannel <- proposal
+	keys := execParams.keySpace.Choose(user.keys, chaincode.Keys())
+
+	var payload []byte
+	if arrival.Payload > 0 {
+		payload = helpers.PayloadFrom(hash, arrival.Payload)
 	}
 
-	schnorr := dac.MakeSchnorr(prg, false)
-	endorsements := make([]Endorsement, 0)
-	for i := 0; i < sysParams.Endorsements; i++ {
-		endorsement := <-proposal.doneChannel
-		if e := schnorr.Verify(execParams.network.peers[endorsement.endorser].pk, endorsement.signature, proposal.getMessage()); e != nil {
-			panic(e)
-		}
-		recordCryptoEvent(verifySchnorr)
-		endorsements = append(endorsements, endorsement)
+	proposal, pkNym, skNym := MakeTransactionProposal(prg, hash, *user, chaincode.Name(), keys, payload)
+	execParams.faults.track(proposal)
+	timingInfo.endorsementsStart = scheduler.Now()
+	endorsements, ok := user.collectEndorsements(proposal, chaincode.Policy(), endorsers, endorser, &timingInfo)
+	if !ok {
+		return
 	}
 
-	timingInfo.endorsementsEnd = time.Now()
+	timingInfo.endorsementsEnd = scheduler.Now()
+	if timingInfo.retries > 0 {
+		timingInfo.retryLatency = timingInfo.endorsementsEnd.Sub(timingInfo.firstFailure)
+	}
 
 	logger.Debugf("%s has got all endorsements", user.name())
 
-	if sysParams.Revoke {
+	if user.class.Revoke {
 		if user.epoch != execParams.network.epoch {
 			logger.Debugf("user-%d (%s) detected epoch change; requesting new handle...", user.id, message)
 			user.epoch = execParams.network.epoch
-			user.requestNonRevocation()
+			if !user.requestNonRevocation(proposal.faults) {
+				user.epoch = -1 // ask again next time
+				user.giveUp(proposal, fmt.Sprintf("no non-revocation handle in %d ms", sysParams.FaultTimeout))
+				return
+			}
 		}
 	}
 
 	tx := &Transaction{
-		signature:    dac.SignNym(prg, pkNym, skNym, user.sk, sysParams.H, proposal.getMessage()), // ideally we add endorsements here but its fine for simulations
+		signature:    signAsCreator(prg, *user, pkNym, skNym, proposal.getMessage()), // ideally we add endorsements here but its fine for simulations
 		proposal:     *proposal,
 		endorsements: endorsements,
+		rwset:        endorsements[0].rwset, // peers check that the endorsers agree
 		epoch:        user.epoch,
-		doneChannel:  make(chan bool, sysParams.Peers), // need to receive OK from all peers (50%+1, technically)
+		doneChannel:  scheduler.MakeQueue(), // need to receive OK from all peers (50%+1, technically)
 	}
-	recordCryptoEvent(signNym)
 
-	if sysParams.Revoke {
-		tx.nonRevocationProof = dac.RevocationProve(prg, *user.nonRevocationHandler, user.sk, skNym, FP256BN.NewBIGint(user.epoch), sysParams.H, sysParams.Ys[0])
-		recordCryptoEvent(nonRevokeProve)
+	if user.class.Revoke {
+		tx.nonRevocationProof = proveNonRevocation(prg, *user.nonRevocationHandler, user.sk, skNym, user.epoch)
 	}
 
 	if sysParams.Audit {
 
 		// fresh auditing encryption and proof every transaction
-		auditEnc, auditR := dac.AuditingEncrypt(helpers.NewRand(), execParams.network.auditor.pk, user.pk)
-		recordCryptoEvent(auditEncrypt)
+		auditEnc, auditR := auditingEncrypt(prg, execParams.network.auditor.pk, user.pk)
 
 		tx.auditEnc = auditEnc
-		tx.auditProof = dac.AuditingProve(prg, auditEnc, user.pk, user.sk, pkNym, skNym, execParams.network.auditor.pk, auditR, sysParams.H)
-		recordCryptoEvent(auditProve)
+		tx.auditProof = auditingProve(prg, auditEnc, *user, pkNym, skNym, execParams.network.auditor.pk, auditR)
 	}
 
-	orderer := helpers.PeerByHash(helpers.Sha3([]byte(fmt.Sprintf("%s-order", message))), sysParams.Peers)
+	orderer := helpers.PeerByHash(helpers.Sha3([]byte(fmt.Sprintf("%s-order", message))), sysParams.Orderers)
 	recordCryptoEvent(sha3hash)
-	timingInfo.validationStart = time.Now()
-	execParams.network.peers[orderer].orderingChannel <- tx
+	timingInfo.orderingStart = scheduler.Now()
+	execParams.network.liveOrderer(orderer).transactionChannel.Put(tx)
+	execParams.faults.arm(tx.doneChannel)
 
 	// wait for all peers to commit the transaction
 	for peer := 0; peer < sysParams.Peers; peer++ {
-		<-tx.doneChannel
+		outcome := tx.doneChannel.Get()
+		if _, expired := outcome.(timedOut); expired {
+			user.giveUp(proposal, fmt.Sprintf("not committed in %d ms", sysParams.FaultTimeout))
+			return
+		}
+		code := outcome.(validationCode)
+		if peer > 0 && code != timingInfo.code {
+			panic(fmt.Sprintf("peers disagree whether transaction %x is valid: %s and %s", tx.id(), timingInfo.code, code))
+		}
+		timingInfo.code = code
 	}
 
-	timingInfo.validationEnd = time.Now()
-	timingInfo.end = time.Now()
+	timingInfo.orderingEnd = tx.ordered
+	timingInfo.validationStart = tx.ordered
+	timingInfo.validationEnd = scheduler.Now()
+	timingInfo.end = scheduler.Now()
 	recordTransactionTimingInfo(timingInfo)
 
-	execParams.network.recordTransaction(tx)
+	execParams.network.recordTransaction()
+	execParams.faults.finish(proposal, false)
 
 	logger.Infof("%s transaction completed", user.name())
 }
 
-func (user *User) requestNonRevocation() {
+// runArrivals submits the transactions at the times of an open pattern, each in its own process,
+// so that a slow network makes them queue up instead of arrive later
+func (user *User) runArrivals(start time.Duration) {
+
+	scheduler := execParams.scheduler
+
+	src := rand.NewSource(helpers.RandomULong(helpers.NewRandDerived(sysParams.Seed, fmt.Sprintf("%s-arrivals", user.name()))))
+	schedule := sysParams.UserSchedule(user.id, src)
+
+	wgTransactions := scheduler.MakeWaitGroup()
+	wgTransactions.Add(len(schedule))
+	for _, arrival := range schedule {
+		scheduler.Sleep(start + arrival.At - scheduler.Elapsed())
+
+		message, arrival := helpers.RandomString(user.prg, 16), arrival
+		scheduler.Go(func() {
+			defer wgTransactions.Done()
+			user.submitTransaction(message, arrival)
+		})
+	}
+	wgTransactions.Wait()
+}
+
+// giveUp abandons a transaction held back for too long
+func (user *User) giveUp(proposal *TransactionProposal, reason string) {
+	logger.Warningf("%s gives up a transaction: %s", user.name(), reason)
+	execParams.faults.finish(proposal, true)
+}
+
+// endorsementTimeout is put on the proposal queue once a request to an endorser has waited too long
+type endorsementTimeout struct {
+	peer int
+}
+
+// collectEndorsements waits for the endorsers like the Fabric SDK: a request that times out, or an endorsement
+// with a bad signature, is retried with the fewest alternate peers that satisfy the policy together with the rest,
+// until the attempts run out
+func (user *User) collectEndorsements(proposal *TransactionProposal, policy *helpers.Policy, endorsers []int, start int, timingInfo *TransactionTimingInfo) (endorsements []Endorsement, ok bool) {
+
+	scheduler := execParams.scheduler
+
+	outstanding := make([]int, 0) // asked, not answered yet
+	answered := make([]int, 0)
+	expired := make([]int, 0) // timed out or rejected
+	attempts := 0
+
+	request := func(peers []int) {
+		for _, peer := range peers {
+			attempts++
+			outstanding = append(outstanding, peer)
+			execParams.network.peers[peer].endorsementChannel.Put(proposal)
+
+			peer := peer
+			scheduler.Go(func() {
+				scheduler.Sleep(time.Duration(sysParams.EndorsementTimeout) * time.Millisecond)
+				proposal.doneChannel.Put(endorsementTimeout{peer: peer})
+			})
+		}
+	}
+	request(endorsers)
+
+	// replace asks alternates in place of a peer that will not endorse, the error tells why there are none
+	replace := func(peer int, failure string) error {
+		expired = append(expired, peer)
+		if timingInfo.retries == 0 {
+			timingInfo.firstFailure = scheduler.Now()
+		}
+
+		alternates, e := policy.Alternates(&sysParams, start, append(append([]int{}, answered...), outstanding...), expired)
+		if e == nil && attempts+len(alternates) > sysParams.EndorsementAttempts {
+			e = fmt.Errorf("%d more requests exceed %d attempts", len(alternates), sysParams.EndorsementAttempts)
+		}
+		if e != nil {
+			return e
+		}
+
+		logger.Infof("%s %s, asks %v instead", user.name(), failure, alternates)
+		timingInfo.retries += len(alternates)
+		request(alternates)
+
+		return nil
+	}
+
+	endorsements = make([]Endorsement, 0)
+	for len(outstanding) > 0 {
+		switch message := proposal.doneChannel.Get().(type) {
+
+		case endorsementTimeout:
+			var waiting bool
+			if outstanding, waiting = withoutPeer(outstanding, message.peer); !waiting {
+				continue // answered in time
+			}
+
+			if e := replace(message.peer, fmt.Sprintf("has not heard from peer-%d in %d ms", message.peer, sysParams.EndorsementTimeout)); e != nil {
+				user.giveUp(proposal, fmt.Sprintf("peer-%d has not endorsed in %d ms and %v", message.peer, sysParams.EndorsementTimeout, e))
+				return nil, false
+			}
+
+		case Endorsement:
+			var waiting bool
+			if outstanding, waiting = withoutPeer(outstanding, message.endorser); !waiting {
+				logger.Debugf("%s ignores a late endorsement of peer-%d", user.name(), message.endorser)
+				continue
+			}
+
+			// the client trusts the key in the certificate, the chain is checked at validation
+			verifyStart := scheduler.Now()
+			if e := verifySchnorrMessage(user.prg, message.certificate.pk, message.signature, proposal.getMessage()); e != nil {
+				logger.Warningf("%s rejects the endorsement of %s: %v", user.name(), message.certificate.subject(), e)
+				spent := scheduler.Now().Sub(verifyStart)
+
+				// the transaction counts as rejected only if no other peer can take the place of this one
+				if e := replace(message.endorser, fmt.Sprintf("has rejected the endorsement of peer-%d", message.endorser)); e != nil {
+					logger.Warningf("%s cannot replace peer-%d: %v", user.name(), message.endorser, e)
+					recordInvalid(badEndorsementSignature, spent, true)
+					execParams.rejected++
+					execParams.faults.finish(proposal, false)
+					return nil, false
+				}
+				recordInvalid(badEndorsementSignature, spent, false)
+				continue
+			}
+
+			answered = append(answered, message.endorser)
+			endorsements = append(endorsements, message)
+		}
+	}
+
+	return endorsements, true
+}
+
+func withoutPeer(peers []int, peer int) (rest []int, found bool) {
+	for i, candidate := range peers {
+		if candidate == peer {
+			return append(peers[:i:i], peers[i+1:]...), true
+		}
+	}
+	return peers, false
+}
+
+// requestNonRevocation tells whether the handle has arrived in time; faults that hold it back are added to affected
+func (user *User) requestNonRevocation(affected faultSet) bool {
 
 	nrr := &NonRevocationRequest{
 		userPk:      user.revocationPK,
-		doneChannel: make(chan *NonRevocationHandle),
+		userID:      user.id,
+		doneChannel: execParams.scheduler.MakeQueue(),
+		faults:      affected,
+	}
+	execParams.network.revocationAuthority.requestChannel.Put(nrr)
+	execParams.faults.arm(nrr.doneChannel)
+
+	message := nrr.doneChannel.Get()
+	if _, expired := message.(timedOut); expired {
+		return false
 	}
-	execParams.network.revocationAuthority.requestChannel <- nrr
+	user.nonRevocationHandler = &message.(*NonRevocationHandle).handle
 
-	user.nonRevocationHandler = &(<-nrr.doneChannel).handle
+	return true
 }